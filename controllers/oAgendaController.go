@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	"super-lender/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetMyAgenda(c *gin.Context) {
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	// Fetch query parameters, date defaults to today
+	date := utils.QueryParamToStringWithDefault(c, "date", utils.CurrentDate())
+	agendaDate, err := time.ParseInLocation(utils.DateFormat, date, time.Local)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid date format, expected YYYY-MM-DD"})
+		return
+	}
+
+	// set db connection
+	db := utils.GetDBConn(c)
+
+	due, overdue, err := utils.GetAgenda(db, user.UID, agendaDate)
+	if err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"date":         agendaDate.Format(utils.DateFormat),
+		"dueCount":     len(due),
+		"overdueCount": len(overdue),
+		"due":          due,
+		"overdue":      overdue,
+	})
+}
+
+func GetMyNotifications(c *gin.Context) {
+
+	// set result schema
+	var notificationsResult []schemas.NotificationSchema
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	// Fetch query parameters
+	pageNo := utils.QueryParamToIntWithDefault(c, "pageNo", 1)
+	pageSize := utils.QueryParamToIntWithDefault(c, "pageSize", 10)
+	status := utils.QueryParamToIntWithDefault(c, "status", 0)
+
+	// build query
+	query := inits.CurrentDB.Table("o_notifications n")
+	query = query.Select("n.uid, n.subject, n.message, DATE_FORMAT(n.added_date, '%Y-%m-%d %H:%i:%s') AS added_date, n.status")
+	query = query.Where("n.user_id = ?", user.UID)
+	if status > 0 {
+		query = query.Where("n.status = ?", status)
+	} else {
+		query = query.Where("n.status != ?", models.DeletedNotification)
+	}
+	query = query.Order("n.uid DESC").Offset((pageNo - 1) * pageSize).Limit(pageSize)
+
+	if err := query.Scan(&notificationsResult).Error; err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": notificationsResult})
+}
+
+func MarkNotificationRead(c *gin.Context) {
+
+	// Fetch query parameters from /me/notifications/:uid/read
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid notification id"})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	result := inits.CurrentDB.Model(&models.ONotification{}).
+		Where("uid = ? AND user_id = ?", uid, user.UID).
+		Updates(map[string]interface{}{"status": models.ReadNotification, "read_date": time.Now()})
+	if result.Error != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "Notification not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": "Notification marked as read"})
+}
@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	customTypes "super-lender/types"
+	"super-lender/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+func FindManyServiceAccounts(c *gin.Context) {
+
+	// set result schema
+	var serviceAccounts []schemas.ServiceAccountSchema
+
+	// build query
+	query := inits.CurrentDB.Table("o_users u")
+	query = query.Select("u.uid, u.name, u.email, ug.name AS user_group, u.branch, u.status, (SELECT COUNT(k.uid) FROM o_api_keys k WHERE k.user_id = u.uid AND k.status = ? AND (k.expiry_date IS NULL OR k.expiry_date > NOW())) AS active_keys", models.ActiveApiKey)
+	query = query.Joins("LEFT JOIN o_user_groups ug ON ug.uid = u.user_group")
+	query = query.Where("u.account_type = ? AND u.status != ?", models.ServiceAccount, models.Delete)
+	query = query.Order("u.name ASC")
+
+	// execute query
+	if err := query.Scan(&serviceAccounts).Error; err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": serviceAccounts})
+}
+
+// CreateServiceAccount adds a user that can't log in and only authenticates with api keys,
+// what it may do comes from its user group like any other user
+func CreateServiceAccount(c *gin.Context) {
+
+	// set necessary variables
+	var serviceAccountInput schemas.ServiceAccountInputSchema
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&serviceAccountInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	email := strings.TrimSpace(serviceAccountInput.Email)
+	var count int64
+	inits.CurrentDB.Model(&models.OUser{}).Where("email = ?", email).Count(&count)
+	if count > 0 {
+		c.JSON(400, gin.H{"error": "User with that email already exists"})
+		return
+	}
+
+	// same rules as for staff, only admins may add an account to the admin group
+	userGroup, ok := checkStaffAssignment(c, serviceAccountInput.UserGroup, serviceAccountInput.Branch, nil)
+	if !ok {
+		return
+	}
+
+	// the password is never handed out, it only fills the required column
+	hash, err := utils.HashPassword(utils.SecureRandomString(32))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error hashing password"})
+		return
+	}
+
+	serviceAccount := models.OUser{
+		Name:        strings.TrimSpace(serviceAccountInput.Name),
+		Email:       email,
+		Phone:       "svc" + utils.SecureRandomNumber(12),
+		Pass1:       hash,
+		UserGroup:   serviceAccountInput.UserGroup,
+		Branch:      serviceAccountInput.Branch,
+		Company:     user.Company,
+		Status:      models.Active,
+		AccountType: models.ServiceAccount,
+	}
+
+	if err := inits.CurrentDB.Create(&serviceAccount).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error creating service account"})
+		return
+	}
+
+	utils.LogEvent("o_users", serviceAccount.UID, fmt.Sprintf("Service account %s(%d) created in group %s by %s(%d)", serviceAccount.Name, serviceAccount.UID, userGroup.Name, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"message": "Service account created successfully", "uid": serviceAccount.UID})
+}
+
+// DeactivateServiceAccount blocks a service account and revokes all of its api keys, for when the
+// integration is retired or a key may have leaked
+func DeactivateServiceAccount(c *gin.Context) {
+
+	serviceAccount, ok := findServiceAccount(c)
+	if !ok {
+		return
+	}
+	if serviceAccount.Status != models.Active {
+		c.JSON(400, gin.H{"error": "Service account is not active"})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	var revoked int64
+	err := inits.CurrentDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.OUser{}).Where("uid = ?", serviceAccount.UID).Update("status", models.Blocke).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&models.OApiKey{}).Where("user_id = ? AND status = ?", serviceAccount.UID, models.ActiveApiKey).Update("status", models.RevokedApiKey)
+		revoked = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error deactivating service account"})
+		return
+	}
+
+	utils.LogEvent("o_users", serviceAccount.UID, fmt.Sprintf("Service account %s(%d) deactivated and %d api key(s) revoked by %s(%d)", serviceAccount.Name, serviceAccount.UID, revoked, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"message": "Service account deactivated successfully", "revokedKeys": revoked})
+}
+
+// findServiceAccount loads a service account by the uid path parameter, it responds itself when there is none
+func findServiceAccount(c *gin.Context) (models.OUser, bool) {
+	var serviceAccount models.OUser
+
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid service account id"})
+		return serviceAccount, false
+	}
+
+	if err := inits.CurrentDB.Where("uid = ? AND account_type = ? AND status != ?", uid, models.ServiceAccount, models.Delete).First(&serviceAccount).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Service account not found"})
+		return serviceAccount, false
+	}
+
+	return serviceAccount, true
+}
+
+// findAPIKey loads an active key by the uid path parameter, it responds itself when there is none
+func findAPIKey(c *gin.Context) (models.OApiKey, bool) {
+	var apiKey models.OApiKey
+
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid api key id"})
+		return apiKey, false
+	}
+
+	if err := inits.CurrentDB.Where("uid = ? AND status = ?", uid, models.ActiveApiKey).First(&apiKey).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Api key not found"})
+		return apiKey, false
+	}
+
+	return apiKey, true
+}
+
+func GetServiceAccountKeys(c *gin.Context) {
+
+	serviceAccount, ok := findServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	var apiKeys []models.OApiKey
+	if err := inits.CurrentDB.Where("user_id = ?", serviceAccount.UID).Order("uid DESC").Find(&apiKeys).Error; err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	keys := make([]schemas.ApiKeySchema, len(apiKeys))
+	for i, apiKey := range apiKeys {
+		keys[i] = utils.APIKeyRow(apiKey)
+	}
+
+	c.JSON(200, gin.H{"data": keys})
+}
+
+// IssueAPIKey creates a key for the service account, the key itself is only returned in this response
+func IssueAPIKey(c *gin.Context) {
+
+	// set necessary variables
+	var apiKeyInput schemas.ApiKeyInputSchema
+
+	serviceAccount, ok := findServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&apiKeyInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	var expiry *time.Time
+	if apiKeyInput.ExpiryDays > 0 {
+		expiryDate := time.Now().AddDate(0, 0, apiKeyInput.ExpiryDays)
+		expiry = &expiryDate
+	}
+
+	apiKey, key, err := utils.IssueAPIKey(serviceAccount, strings.TrimSpace(apiKeyInput.Name), apiKeyInput.Scope, apiKeyInput.AllowedIPs, expiry, user.UID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error issuing api key"})
+		return
+	}
+
+	utils.LogEvent("o_api_keys", apiKey.UID, fmt.Sprintf("Api key %s (%s) issued to service account %s(%d) by %s(%d)", apiKey.Name, apiKey.Prefix, serviceAccount.Name, serviceAccount.UID, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"message": "Api key issued successfully, it will not be shown again", "data": gin.H{"key": key, "apiKey": utils.APIKeyRow(apiKey)}})
+}
+
+// RotateAPIKey replaces a key with a new one with the same scope, allowlist and expiry, the old key stops working at once
+func RotateAPIKey(c *gin.Context) {
+
+	apiKey, ok := findAPIKey(c)
+	if !ok {
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	newKey, key, err := utils.RotateAPIKey(apiKey, user.UID)
+	if err != nil {
+		if errors.Is(err, utils.ErrInvalidAPIKey) {
+			c.JSON(404, gin.H{"error": "Api key not found"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Error rotating api key"})
+		return
+	}
+
+	utils.LogEvent("o_api_keys", apiKey.UID, fmt.Sprintf("Api key %s (%s) rotated to %s by %s(%d)", apiKey.Name, apiKey.Prefix, newKey.Prefix, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"message": "Api key rotated successfully, it will not be shown again", "data": gin.H{"key": key, "apiKey": utils.APIKeyRow(newKey)}})
+}
+
+func RevokeAPIKey(c *gin.Context) {
+
+	apiKey, ok := findAPIKey(c)
+	if !ok {
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	if err := inits.CurrentDB.Model(&models.OApiKey{}).Where("uid = ?", apiKey.UID).Update("status", models.RevokedApiKey).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error revoking api key"})
+		return
+	}
+
+	utils.LogEvent("o_api_keys", apiKey.UID, fmt.Sprintf("Api key %s (%s) revoked by %s(%d)", apiKey.Name, apiKey.Prefix, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"message": "Api key revoked successfully"})
+}
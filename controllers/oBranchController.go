@@ -0,0 +1,373 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	customTypes "super-lender/types"
+	"super-lender/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// checkManager makes sure a manager is an active staff member, 0 means no manager. It responds itself when not.
+func checkManager(c *gin.Context, userID int) bool {
+	if userID == 0 {
+		return true
+	}
+
+	var count int64
+	inits.CurrentDB.Model(&models.OUser{}).Where("uid = ? AND status = ? AND account_type = ?", userID, models.Active, models.StaffAccount).Count(&count)
+	if count == 0 {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Manager %d is not an active staff member", userID)})
+		return false
+	}
+	return true
+}
+
+// checkRegion makes sure a region exists, 0 means no region. It responds itself when not.
+func checkRegion(c *gin.Context, regionID int) bool {
+	if regionID == 0 {
+		return true
+	}
+
+	var count int64
+	inits.CurrentDB.Model(&models.ORegion{}).Where("uid = ? AND status = 1", regionID).Count(&count)
+	if count == 0 {
+		c.JSON(404, gin.H{"error": "Region not found"})
+		return false
+	}
+	return true
+}
+
+// findBranch loads a branch that is not deleted by the uid path parameter, it responds itself when there is none
+func findBranch(c *gin.Context) (models.OBranch, bool) {
+	var branch models.OBranch
+
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid branch id"})
+		return branch, false
+	}
+
+	if err := inits.CurrentDB.Where("uid = ? AND status != ?", uid, models.DeletedBranch).First(&branch).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Branch not found"})
+		return branch, false
+	}
+
+	return branch, true
+}
+
+// FindManyBranches lists every branch to users with read_ on o_branches, and otherwise the branches they can see
+func FindManyBranches(c *gin.Context) {
+
+	// set result schema
+	var branchesResult []schemas.BranchSchema
+
+	// Fetch query parameters
+	status := utils.QueryParamToIntWithDefault(c, "status", int(models.ActiveBranch))
+	region := utils.QueryParamToIntWithDefault(c, "region", 0)
+	searchTerm := utils.QueryParamToStringWithDefault(c, "searchTerm", "")
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	var branches []int
+	if !utils.HasPermission(c, "o_branches", "read_") {
+		branches = utils.GetBranches(c, user, false)
+	}
+
+	// set db connection
+	db := utils.GetDBConn(c)
+
+	query := utils.BranchesQueryBuilder(db, status, region, branches, searchTerm)
+	if err := query.Scan(&branchesResult).Error; err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": branchesResult})
+}
+
+func FindBranchByID(c *gin.Context) {
+
+	// set result schema
+	var branchResult schemas.BranchSchema
+
+	// Fetch query parameters from /branches/:uid
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid branch id"})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	branches := utils.GetBranches(c, user, utils.HasPermission(c, "o_branches", "read_"))
+	if !utils.IntSliceContains(branches, 0) && !utils.IntSliceContains(branches, uid) {
+		utils.AbortForbidden(c, "o_branches", "read_")
+		return
+	}
+
+	// set db connection
+	db := utils.GetDBConn(c)
+
+	query := utils.BranchesQueryBuilder(db, -1, 0, []int{uid}, "")
+	if err := query.Scan(&branchResult).Error; err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+	if branchResult.UID == 0 {
+		c.JSON(404, gin.H{"error": "Branch not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": branchResult})
+}
+
+func CreateBranch(c *gin.Context) {
+
+	// set necessary variables
+	var branchInput schemas.BranchInputSchema
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&branchInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkRegion(c, branchInput.RegionID) {
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	branch := models.OBranch{
+		Name:     strings.TrimSpace(branchInput.Name),
+		Address:  strings.TrimSpace(branchInput.Address),
+		RegionID: branchInput.RegionID,
+		Status:   models.ActiveBranch,
+	}
+
+	var count int64
+	inits.CurrentDB.Model(&models.OBranch{}).Where("name = ? AND status != ?", branch.Name, models.DeletedBranch).Count(&count)
+	if count > 0 {
+		c.JSON(400, gin.H{"error": "Branch already exists"})
+		return
+	}
+
+	if err := inits.CurrentDB.Create(&branch).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error creating branch"})
+		return
+	}
+
+	utils.LogEvent("o_branches", branch.UID, fmt.Sprintf("Branch %s(%d) created by %s(%d)", branch.Name, branch.UID, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"message": "Branch created successfully", "uid": branch.UID})
+}
+
+func UpdateBranch(c *gin.Context) {
+
+	// set necessary variables
+	var branchInput schemas.BranchInputSchema
+
+	existingBranch, ok := findBranch(c)
+	if !ok {
+		return
+	}
+	if !utils.HasRecordPermission(c, "o_branches", existingBranch.UID, "update_") {
+		utils.AbortForbidden(c, "o_branches", "update_")
+		return
+	}
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&branchInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkRegion(c, branchInput.RegionID) {
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	branch := existingBranch
+	branch.Name = strings.TrimSpace(branchInput.Name)
+	branch.Address = strings.TrimSpace(branchInput.Address)
+	branch.RegionID = branchInput.RegionID
+
+	var count int64
+	inits.CurrentDB.Model(&models.OBranch{}).Where("name = ? AND status != ? AND uid != ?", branch.Name, models.DeletedBranch, branch.UID).Count(&count)
+	if count > 0 {
+		c.JSON(400, gin.H{"error": "Branch already exists"})
+		return
+	}
+
+	err := inits.CurrentDB.Model(&models.OBranch{}).Where("uid = ?", branch.UID).
+		Updates(map[string]interface{}{"name": branch.Name, "address": branch.Address, "region_id": branch.RegionID}).Error
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error updating branch"})
+		return
+	}
+
+	utils.CreateChangesLog("o_branches", "branch", branch.UID, branch.UID, "Update", existingBranch, branch, user, []string{"UID", "AddedDate"})
+
+	c.JSON(200, gin.H{"message": "Branch updated successfully"})
+}
+
+func SetBranchManagers(c *gin.Context) {
+
+	// set necessary variables
+	var managersInput schemas.BranchManagersSchema
+
+	existingBranch, ok := findBranch(c)
+	if !ok {
+		return
+	}
+	if !utils.HasRecordPermission(c, "o_branches", existingBranch.UID, "update_") {
+		utils.AbortForbidden(c, "o_branches", "update_")
+		return
+	}
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&managersInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if managersInput.ManagerID > 0 && managersInput.ManagerID == managersInput.AssistantManagerID {
+		c.JSON(400, gin.H{"error": "The manager and assistant manager must be different staff members"})
+		return
+	}
+	if !checkManager(c, managersInput.ManagerID) || !checkManager(c, managersInput.AssistantManagerID) {
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	branch := existingBranch
+	branch.ManagerID = managersInput.ManagerID
+	branch.AssistantManagerID = managersInput.AssistantManagerID
+
+	err := inits.CurrentDB.Model(&models.OBranch{}).Where("uid = ?", branch.UID).
+		Updates(map[string]interface{}{"manager_id": branch.ManagerID, "assistant_manager_id": branch.AssistantManagerID}).Error
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error updating branch managers"})
+		return
+	}
+
+	utils.CreateChangesLog("o_branches", "branch", branch.UID, branch.UID, "Update", existingBranch, branch, user, []string{"UID", "AddedDate"})
+
+	c.JSON(200, gin.H{"message": "Branch managers updated successfully"})
+}
+
+// SetBranchStatus blocks, deletes or reopens a branch. Blocking needs block_, reopening unblock_ and deleting delete_ on the branch.
+func SetBranchStatus(c *gin.Context) {
+
+	// set necessary variables
+	var statusInput schemas.BranchStatusSchema
+
+	// Fetch query parameters from /branches/:uid/status
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid branch id"})
+		return
+	}
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&statusInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status := models.BranchStatus(*statusInput.Status)
+	action, verb := "unblock_", "reopened"
+	switch status {
+	case models.BlockedBranch:
+		action, verb = "block_", "blocked"
+	case models.DeletedBranch:
+		action, verb = "delete_", "deleted"
+	}
+	if !utils.HasRecordPermission(c, "o_branches", uid, action) {
+		utils.AbortForbidden(c, "o_branches", action)
+		return
+	}
+
+	var branch models.OBranch
+	if err := inits.CurrentDB.First(&branch, uid).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": "Branch not found"})
+			return
+		}
+		c.JSON(500, gin.H{"message": "Internal Server Error"})
+		return
+	}
+	if branch.Status == status {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Branch is already %s", verb)})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	if err := inits.CurrentDB.Model(&models.OBranch{}).Where("uid = ?", branch.UID).Update("status", status).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error updating branch status"})
+		return
+	}
+
+	reason := utils.DefaultIfEmpty(strings.TrimSpace(statusInput.Reason), "no reason given")
+	utils.LogEvent("o_branches", branch.UID, fmt.Sprintf("Branch %s(%d) %s by %s(%d): %s", branch.Name, branch.UID, verb, user.Name, user.UID, reason), user.UID)
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Branch %s successfully", verb)})
+}
@@ -23,15 +23,6 @@ func GetCustomerContact(c *gin.Context) {
 	// Fetch query parameters from /customers/:uid
 	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
 
-	// Get user and permissions
-	user := c.MustGet("user").(models.OUser)
-	userId := user.UID
-	readPermi := utils.GetPermission(userId, "o_customers", 0, "read_")
-	if !readPermi {
-		c.JSON(403, gin.H{"error": "Forbidden"})
-		return
-	}
-
 	// set db connection
 	db := utils.GetDBConn(c)
 
@@ -63,20 +54,14 @@ func GetCustomerContacts(c *gin.Context) {
 
 	// Get user and permissions
 	user := c.MustGet("user").(models.OUser)
-	userId := user.UID
-	readAll := utils.GetPermission(userId, "o_customers", 0, "read_")
-	branches := utils.GetBranches(c, user, readAll)
+	scope := utils.GetCustomerScope(c, user)
 
 	// Build query
 	db := utils.GetDBConn(c)
-	query := db.Table("o_customer_contacts c")
-	query = query.Select("c.uid, c.contact_type, c.value, DATE_FORMAT(c.last_update, '%Y-%m-%d %H:%i:%s') AS last_update")
+	query := utils.CustomerContactsQueryBuilder(db, uid)
 
 	// Apply filters
-	query = query.Where("c.customer_id = ?", uid)
-	if !readAll {
-		query = query.Where("c.branch IN (?)", branches)
-	}
+	query = scope.Apply(query, "c.branch", "c.customer_id")
 
 	// Execute query
 	err := query.Scan(&customerContactResult).Error
@@ -149,20 +134,6 @@ func CreateCustomerContact(c *gin.Context) {
 		isEmail = true
 	}
 
-	// Get user and permissions
-	user := c.MustGet("user").(models.OUser)
-	userId := user.UID
-
-	// check if user has necessary permissions permission to create customer contact
-	createPermi := utils.GetPermission(userId, "o_customer_contacts", 0, "create_")
-	if !createPermi {
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
-			"status":  403,
-			"message": "You don't have permission to create customer contact!",
-		})
-		return
-	}
-
 	// set db connection
 	db := inits.CurrentDB
 
@@ -292,19 +263,8 @@ func UpdateCustomerContact(c *gin.Context) {
 		isEmail = true
 	}
 
-	// Get user and permissions
+	// Get user
 	user := c.MustGet("user").(models.OUser)
-	userId := user.UID
-
-	// check if user has necessary permissions permission to update customer contact
-	updatePermi := utils.GetPermission(userId, "o_customer_contacts", 0, "update_")
-	if !updatePermi {
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
-			"status":  403,
-			"message": "You don't have permission to update customer contact!",
-		})
-		return
-	}
 
 	// set db connection
 	db := inits.CurrentDB
@@ -389,6 +349,11 @@ func UpdateCustomerContact(c *gin.Context) {
 		return
 	}
 
+	// a changed contact has to be verified again
+	if originalContact.Value != customerContactInput.Value {
+		db.Model(&models.OCustomerContacts{}).Where("uid = ?", customerContactInput.UID).Updates(map[string]interface{}{"verified_by": 0, "verified_date": nil})
+	}
+
 	// log changes
 	utils.CreateChangesLog("o_customers", "contact", customerContactInput.UID, customerContactInput.CustomerID, "Update", originalContact, customerContactInput, user, []string{"UID", "EncPhone", "LastUpdate"})
 
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 	"super-lender/inits"
 	"super-lender/models"
@@ -33,17 +34,28 @@ func FindManyCustomers(c *gin.Context) {
 	agent := utils.QueryParamToIntWithDefault(c, "agent", 0)
 	status := utils.QueryParamToIntWithDefault(c, "status", 0)
 
+	// deleted customers are left out unless asked for with deleted=1
+	if utils.QueryParamToIntWithDefault(c, "deleted", 0) == 1 {
+		status = int(models.DELETED)
+	} else if status == int(models.DELETED) {
+		status = -1
+	}
+
 	// Get user and permissions
 	user := c.MustGet("user").(models.OUser)
-	userId := user.UID
-	readAll := utils.GetPermission(userId, "o_customers", 0, "read_")
-	branches := utils.GetBranches(c, user, readAll)
+	scope := utils.GetCustomerScope(c, user)
 
 	// Build select query
-	selectQuery := utils.FindManyCustomersQueryBuilder(db, branch, agent, status, branches, readAll, searchTerm, "select")
+	selectQuery := utils.FindManyCustomersQueryBuilder(db, branch, agent, status, scope, searchTerm, "select")
 
 	// Apply order and pagination
 	selectQuery = selectQuery.Order("c." + orderBy + " " + dir)
+
+	// format=csv|xlsx streams every matching customer instead of a page
+	if isListExport(c) {
+		exportList(c, "o_customers", "customers", selectQuery)
+		return
+	}
 	selectQuery = selectQuery.Limit(pageSize).Offset((pageNo - 1) * pageSize)
 
 	// Execute selectQuery
@@ -56,7 +68,7 @@ func FindManyCustomers(c *gin.Context) {
 	}
 
 	// count query
-	countQuery := utils.FindManyCustomersQueryBuilder(db, branch, agent, status, branches, readAll, searchTerm, "count")
+	countQuery := utils.FindManyCustomersQueryBuilder(db, branch, agent, status, scope, searchTerm, "count")
 	var count int64
 	if countLimit > 0 {
 		/// ===== option 1: proves to work well when dealing large datasets
@@ -93,20 +105,11 @@ func FindCustomerById(c *gin.Context) {
 
 	// Get user and permissions
 	user := c.MustGet("user").(models.OUser)
-	userId := user.UID
-	readAll := utils.GetPermission(userId, "o_customers", 0, "read_")
-	branches := utils.GetBranches(c, user, readAll)
+	scope := utils.GetCustomerScope(c, user)
 
 	// Build query
 	db := utils.GetDBConn(c)
-	query := db.Table("o_customers c")
-	query = query.Select("c.uid, c.passport_photo, c.full_name, c.gender, c.dob, c.national_id, u.name AS added_by, c.loan_limit, c.email_address, c.primary_mobile, t.name AS phone_number_provider, b.name AS branch, c.physical_address, c.total_loans, p.name AS product, c.geolocation AS location_map, c.added_date, bd.icon AS badge_icon, bd.title AS badge_title, bd.description AS badge_description,  cs.name AS status")
-	query = query.Joins("LEFT JOIN o_telecomms t ON c.phone_number_provider = t.uid")
-	query = query.Joins("LEFT JOIN o_users u ON c.added_by = u.uid")
-	query = query.Joins("LEFT JOIN o_branches b ON c.branch = b.uid")
-	query = query.Joins("LEFT JOIN o_loan_products p ON c.primary_product = p.uid")
-	query = query.Joins("LEFT JOIN o_badges bd ON c.badge_id = bd.uid")
-	query = query.Joins("LEFT JOIN o_customer_statuses cs ON c.status = cs.code")
+	query := utils.CustomerProfileQueryBuilder(db)
 
 	// Apply filters
 	if uid != 0 {
@@ -120,9 +123,7 @@ func FindCustomerById(c *gin.Context) {
 		return
 	}
 
-	if !readAll {
-		query = query.Where("c.branch IN (?)", branches)
-	}
+	query = scope.Apply(query, "c.branch", "c.uid")
 
 	// Execute query
 	err := query.Scan(&customerResult).Error
@@ -141,14 +142,7 @@ func FindCustomerById(c *gin.Context) {
 		return
 	}
 
-	customerResult.CurrentLO = customerResult.AddedBy
-	customerResult.CurrentCO = customerResult.AddedBy
-
-	// parse dob into date formatted as yyyy-mm-dd
-	customerResult.Dob = utils.DateFormatter(customerResult.Dob)
-
-	// format added_date into yyyy-mm-dd hh:mm:ss and should be in Nairobi TZ want 2024-04-01 10:48:08 not 2024-04-01T10:48:08
-	customerResult.AddedDate = utils.DatetimeFormatter(customerResult.AddedDate)
+	utils.FormatCustomerProfile(&customerResult)
 
 	c.JSON(200, gin.H{
 		"customer": customerResult,
@@ -173,86 +167,26 @@ func CreateCustomer(c *gin.Context) {
 		return
 	}
 
-	// get country code
-	countryCode, err := utils.GetCountryCode()
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-			"message": "Internal Server Error: " + err.Error(),
-		})
-		return
-	}
-
-	if countryCode == "254" {
-		// will use default of 1 for safaricom
-	} else {
-		// check if nonempty phone number provider is provided
-		phoneNumberProvider := createCustomerInput.PhoneNumberProvider
-		if phoneNumberProvider == 0 || phoneNumberProvider == 1 {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-				"message": "Phone number provider is required",
-			})
-			return
-
-		}
-	}
-
 	// Get user and permissions
 	user := c.MustGet("user").(models.OUser)
-	userId := user.UID
 
-	// check if user with the same primary mobile exists
+	// normalise the phone number and check for an open branch and existing customers
 	db := inits.CurrentDB
-	var otherWithSimilarPrimaryMobile models.OCustomer
-	primaryMobile := utils.MakePhoneValid(createCustomerInput.PrimaryMobile)
-	createCustomerInput.PrimaryMobile = primaryMobile
-	if err := db.Where("primary_mobile = ?", primaryMobile).First(&otherWithSimilarPrimaryMobile).Error; err == nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"message": "Customer with the same primary mobile already exists",
-		})
-		return
-
-	}
-
-	// national id is not empty
-	nationalId := strings.TrimSpace(createCustomerInput.NationalID)
-	createCustomerInput.NationalID = nationalId
-	if nationalId != "" {
-		// check if user with the same national id exists
-		var otherWithSimilarNationalId models.OCustomer
-		if err := db.Where("national_id = ?", nationalId).First(&otherWithSimilarNationalId).Error; err == nil {
+	if err := utils.PrepareNewCustomer(db, &createCustomerInput, user.UID); err != nil {
+		var inputErr *utils.CustomerInputError
+		if errors.As(err, &inputErr) {
 			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-				"message": "Customer with the same national id already exists",
+				"message": inputErr.Message,
 			})
 			return
 		}
-
-	}
-
-	// if email address is not empty
-	emailAddress := strings.TrimSpace(createCustomerInput.EmailAddress)
-	createCustomerInput.EmailAddress = emailAddress
-	if emailAddress != "" {
-		// check if user with the same email address exists
-		var otherWithSimilarEmail models.OCustomer
-		if err := db.Where("email_address = ?", emailAddress).First(&otherWithSimilarEmail).Error; err == nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-				"message": "Customer with the same email address already exists",
-			})
-			return
-		}
-
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
 	}
 
-	createCustomerInput.FullName = strings.TrimSpace(createCustomerInput.FullName)
-	createCustomerInput.PhysicalAddress = strings.TrimSpace(createCustomerInput.PhysicalAddress)
-	createCustomerInput.Geolocation = strings.TrimSpace(createCustomerInput.Geolocation)
-	createCustomerInput.EncPhone = utils.Sha256Hash(primaryMobile)
-	createCustomerInput.DOB = utils.DateFormatter(createCustomerInput.DOB)
-	createCustomerInput.AddedBy = userId
-	createCustomerInput.CurrentAgent = userId
-	createCustomerInput.AddedDate = time.Now().Format("2006-01-02 15:04:05")
-
-	if err := db.Create(&createCustomerInput).Error; err != nil {
+	if err := utils.CreateNewCustomer(db, &createCustomerInput); err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 			"message": "Internal Server Error",
 		})
@@ -314,18 +248,7 @@ func UpdateCustomer(c *gin.Context) {
 
 	// Get user and permissions
 	user := c.MustGet("user").(models.OUser)
-	userId := user.UID
 
-	//==== check if user has necessary permissions permission to update customer
-
-	updatePermi := utils.GetPermission(userId, "o_customers", 0, "update_")
-	if !updatePermi {
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
-			"status":  403,
-			"message": "You don't have permission to update customer!",
-		})
-		return
-	}
 	// retrieve original customer details for event logging
 	if err := db.Model(&models.OCustomer{}).Where("uid = ?", updateCustomerInput.UID).First(&existingCustomer).Error; err != nil {
 		// check if its a record not found error
@@ -344,41 +267,32 @@ func UpdateCustomer(c *gin.Context) {
 		}
 	}
 
+	// the route also admits users granted update_ on single customers
+	if !utils.HasCustomerPermission(c, existingCustomer, "update_") {
+		utils.AbortForbidden(c, "o_customers", "update_")
+		return
+	}
+
+	if existingCustomer.Status == models.DELETED {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"message": "Customer is deleted, restore them first",
+		})
+		return
+	}
+
 	// handle blocking && unblocking permission
 	currentCustomerStatus := existingCustomer.Status
 	incomingCustomerStatus := updateCustomerInput.Status
 	if incomingCustomerStatus == models.BLOCKED {
-		blockPermi := utils.GetPermission(userId, "o_customers", 0, "block_")
-		if !blockPermi {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
-				"status":  403,
-				"message": "You don't have permission to block customer!",
-			})
+		if !utils.HasCustomerPermission(c, existingCustomer, "block_") {
+			utils.AbortForbidden(c, "o_customers", "block_")
 			return
 		}
 	} else if incomingCustomerStatus == models.ACTIVE && currentCustomerStatus == models.BLOCKED {
-		unblockPermi := utils.GetPermission(userId, "o_customers", 0, "unblock_")
-		if !unblockPermi {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
-				"status":  403,
-				"message": "You don't have permission to unblock customer!",
-			})
+		if !utils.HasCustomerPermission(c, existingCustomer, "unblock_") {
+			utils.AbortForbidden(c, "o_customers", "unblock_")
 			return
 		}
-	} else {
-		// handle permission check for other statuses
-		if incomingCustomerStatus != currentCustomerStatus {
-			currentStatusName := utils.CustomerStatusName(int(currentCustomerStatus))
-			updateStatusPermi := utils.GetPermission(userId, "o_customers", 0, "update_")
-			if !updateStatusPermi {
-				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
-					"status":  403,
-					"message": "You don't have permission to update customer who is " + currentStatusName,
-				})
-				return
-			}
-		}
-
 	}
 
 	// handle primary mobile update permission
@@ -400,13 +314,8 @@ func UpdateCustomer(c *gin.Context) {
 	}
 
 	if incomingPrimaryMobile != existingPrimaryMobile {
-		updatePrimaryPhonePermi := utils.GetPermission(userId, "o_customer_contacts", 0, "update_")
-
-		if currentCustomerStatus == 1 && !updatePrimaryPhonePermi {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
-				"status":  403,
-				"message": "You don't have permission to update customer phone number!",
-			})
+		if currentCustomerStatus == 1 && !utils.HasPermission(c, "o_customer_contacts", "update_") {
+			utils.AbortForbidden(c, "o_customer_contacts", "update_")
 			return
 		}
 
@@ -463,6 +372,33 @@ func UpdateCustomer(c *gin.Context) {
 		}
 	}
 
+	// leads and drafts only become active once they pass the KYC checklist, empty fields are not updated
+	if incomingCustomerStatus == models.ACTIVE && (currentCustomerStatus == models.LEAD || currentCustomerStatus == models.DRAFT) {
+		kycCustomer := existingCustomer
+		if updateCustomerInput.NationalID != "" {
+			kycCustomer.NationalID = updateCustomerInput.NationalID
+		}
+		if updateCustomerInput.PassportPhoto != "" {
+			kycCustomer.PassportPhoto = updateCustomerInput.PassportPhoto
+		}
+		kycCustomer.PrimaryProduct = updateCustomerInput.PrimaryProduct
+
+		kycStatus, err := utils.CheckCanActivate(db, kycCustomer)
+		if err != nil {
+			if errors.Is(err, utils.ErrKycIncomplete) {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+					"message": "KYC checklist is incomplete",
+					"missing": kycStatus.Missing,
+				})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"message": "Internal Server Error",
+			})
+			return
+		}
+	}
+
 	dobUpdate, err := utils.FormatDate(updateCustomerInput.DOB, 10)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
@@ -495,3 +431,441 @@ func UpdateCustomer(c *gin.Context) {
 	})
 
 }
+
+// ReassignCustomers moves customers picked by filter or uid to another agent in batches, e.g. when an LO leaves.
+// A dry run returns what would move without changing anything.
+func ReassignCustomers(c *gin.Context) {
+
+	// set necessary variables
+	var reassignInput schemas.CustomerReassignSchema
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&reassignInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// never reassign every customer by accident
+	if len(reassignInput.UIDs) == 0 && reassignInput.Branch == 0 && reassignInput.Agent == 0 && reassignInput.Status == nil && reassignInput.Flag == 0 {
+		c.JSON(400, gin.H{"error": "A filter or a list of customer uids is required"})
+		return
+	}
+	if reassignInput.IncludeLoans && !utils.HasPermission(c, "o_loans", "update_") {
+		utils.AbortForbidden(c, "o_loans", "update_")
+		return
+	}
+
+	var toAgent models.OUser
+	if err := inits.CurrentDB.Where("uid = ? AND status = ? AND account_type = ?", reassignInput.ToAgent, models.Active, models.StaffAccount).First(&toAgent).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Target agent not found"})
+		return
+	}
+
+	// Get user, only customers they can see are moved
+	user := c.MustGet("user").(models.OUser)
+	scope := utils.GetCustomerScope(c, user)
+	db := inits.CurrentDB
+
+	if reassignInput.DryRun {
+		var count int64
+		if err := utils.CustomerReassignQueryBuilder(db, reassignInput, scope).Count(&count).Error; err != nil {
+			c.JSON(500, gin.H{"message": "Internal Server Error"})
+			return
+		}
+
+		var loans int64
+		if reassignInput.IncludeLoans {
+			customerUIDs := utils.CustomerReassignQueryBuilder(db, reassignInput, scope).Select("c.uid")
+			var err error
+			if loans, err = utils.CountReassignLoans(db, customerUIDs); err != nil {
+				c.JSON(500, gin.H{"message": "Internal Server Error"})
+				return
+			}
+		}
+
+		var preview []schemas.CustomerReassignPreviewSchema
+		previewQuery := utils.CustomerReassignQueryBuilder(db, reassignInput, scope)
+		previewQuery = previewQuery.Joins("LEFT JOIN o_users u ON u.uid = c.current_agent").Joins("LEFT JOIN o_branches b ON b.uid = c.branch")
+		previewQuery = previewQuery.Select("c.uid, c.full_name, b.name AS branch, IFNULL(u.name, '') AS current_agent").Order("c.uid ASC").Limit(20)
+		if err := previewQuery.Scan(&preview).Error; err != nil {
+			c.JSON(500, gin.H{"message": "Internal Server Error"})
+			return
+		}
+
+		c.JSON(200, gin.H{"dryRun": true, "data": gin.H{"customers": count, "loans": loans, "preview": preview}})
+		return
+	}
+
+	var uids []int
+	if err := utils.CustomerReassignQueryBuilder(db, reassignInput, scope).Order("c.uid ASC").Pluck("c.uid", &uids).Error; err != nil {
+		c.JSON(500, gin.H{"message": "Internal Server Error"})
+		return
+	}
+	if len(uids) == 0 {
+		c.JSON(200, gin.H{"dryRun": false, "data": schemas.CustomerReassignResultSchema{}})
+		return
+	}
+
+	result, err := utils.ReassignCustomers(uids, toAgent, reassignInput.IncludeLoans, user)
+
+	// batches that went through stay moved, the summary says how far it got
+	filter := fmt.Sprintf("branch %d, agent %d, flag %d, %d listed uid(s)", reassignInput.Branch, reassignInput.Agent, reassignInput.Flag, len(reassignInput.UIDs))
+	if reassignInput.Status != nil {
+		filter += fmt.Sprintf(", status %d", *reassignInput.Status)
+	}
+	summary := fmt.Sprintf("Bulk reassignment to %s(%d) by %s(%d): %d customer(s), %d loan(s) in %d batch(es) [%s]. Reason: %s",
+		toAgent.Name, toAgent.UID, user.Name, user.UID, result.Customers, result.Loans, result.Batches, filter, utils.DefaultIfEmpty(strings.TrimSpace(reassignInput.Reason), "no reason given"))
+	utils.LogEvent("o_users", toAgent.UID, summary, user.UID)
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error reassigning customers, some batches may have completed", "data": result})
+		return
+	}
+
+	c.JSON(200, gin.H{"dryRun": false, "data": result})
+}
+
+// DeleteCustomer soft deletes a customer who has no open loans, RestoreCustomer undoes it
+func DeleteCustomer(c *gin.Context) {
+
+	// Fetch query parameters from /customers/:uid
+	customer, ok := findScopedCustomer(c, utils.PathParamToIntWithDefault(c, "uid", 0), false)
+	if !ok {
+		return
+	}
+
+	if !utils.HasCustomerPermission(c, customer, "delete_") {
+		utils.AbortForbidden(c, "o_customers", "delete_")
+		return
+	}
+
+	openLoans, err := utils.CountOpenLoans(inits.CurrentDB, customer.UID)
+	if err != nil {
+		c.JSON(500, gin.H{"message": "Internal Server Error"})
+		return
+	}
+	if openLoans > 0 {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Customer has %d open loan(s)", openLoans)})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	if err := inits.CurrentDB.Model(&models.OCustomer{}).Where("uid = ?", customer.UID).Updates(map[string]interface{}{
+		"status":               models.DELETED,
+		"status_before_delete": customer.Status,
+		"deleted_by":           user.UID,
+		"deleted_date":         time.Now(),
+	}).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error deleting customer"})
+		return
+	}
+
+	utils.LogEvent("o_customers", customer.UID, fmt.Sprintf("Customer %s(%d) deleted by %s(%d)", customer.FullName, customer.UID, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"message": "Customer deleted successfully"})
+}
+
+// RestoreCustomer returns a deleted customer to the status they had before, erased and merged customers stay deleted
+func RestoreCustomer(c *gin.Context) {
+
+	// Fetch query parameters from /customers/:uid/restore
+	customer, ok := findScopedCustomer(c, utils.PathParamToIntWithDefault(c, "uid", 0), true)
+	if !ok {
+		return
+	}
+
+	if !utils.HasCustomerPermission(c, customer, "delete_") {
+		utils.AbortForbidden(c, "o_customers", "delete_")
+		return
+	}
+
+	if customer.Status != models.DELETED {
+		c.JSON(400, gin.H{"error": "Customer is not deleted"})
+		return
+	}
+
+	var erasures int64
+	inits.CurrentDB.Model(&models.OCustomerErasure{}).Where("customer_id = ?", customer.UID).Count(&erasures)
+	if erasures > 0 {
+		c.JSON(400, gin.H{"error": "Customer was erased and cannot be restored"})
+		return
+	}
+
+	var merges int64
+	inits.CurrentDB.Model(&models.OCustomerMerge{}).Where("merged_id = ?", customer.UID).Count(&merges)
+	if merges > 0 {
+		c.JSON(400, gin.H{"error": "Customer was merged into another customer and cannot be restored"})
+		return
+	}
+
+	// customers deleted before deletions were recorded go back to being leads
+	status := customer.StatusBeforeDelete
+	if status == models.DELETED {
+		status = models.LEAD
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	if err := inits.CurrentDB.Model(&models.OCustomer{}).Where("uid = ? AND status = ?", customer.UID, models.DELETED).Updates(map[string]interface{}{
+		"status":               status,
+		"status_before_delete": models.DELETED,
+		"deleted_by":           0,
+		"deleted_date":         nil,
+	}).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error restoring customer"})
+		return
+	}
+
+	utils.LogEvent("o_customers", customer.UID, fmt.Sprintf("Customer %s(%d) restored as %s by %s(%d)", customer.FullName, customer.UID, utils.CustomerStatusName(int(status)), user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"message": "Customer restored successfully"})
+}
+
+// EraseCustomer carries out a data subject erasure request, anonymising the customer's personal data for good
+func EraseCustomer(c *gin.Context) {
+
+	// set necessary variables
+	var erasureInput schemas.CustomerErasureSchema
+
+	// Fetch query parameters from /customers/:uid/erase
+	customer, ok := findScopedCustomer(c, utils.PathParamToIntWithDefault(c, "uid", 0), true)
+	if !ok {
+		return
+	}
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&erasureInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var erasures int64
+	inits.CurrentDB.Model(&models.OCustomerErasure{}).Where("customer_id = ?", customer.UID).Count(&erasures)
+	if erasures > 0 {
+		c.JSON(400, gin.H{"error": "Customer has already been erased"})
+		return
+	}
+
+	openLoans, err := utils.CountOpenLoans(inits.CurrentDB, customer.UID)
+	if err != nil {
+		c.JSON(500, gin.H{"message": "Internal Server Error"})
+		return
+	}
+	if openLoans > 0 {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Customer has %d open loan(s)", openLoans)})
+		return
+	}
+
+	storage, err := utils.GetStorage()
+	if err != nil {
+		c.JSON(500, gin.H{"message": "Internal Server Error"})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	erasure, err := utils.EraseCustomer(storage, customer, strings.TrimSpace(erasureInput.Reason), strings.TrimSpace(erasureInput.Reference), user.UID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error erasing customer"})
+		return
+	}
+
+	utils.LogEvent("o_customers", customer.UID, fmt.Sprintf("Customer %d erased by %s(%d), request %s. Reason: %s", customer.UID, user.Name, user.UID, utils.DefaultIfEmpty(erasure.Reference, "without reference"), erasure.Reason), user.UID)
+
+	c.JSON(200, gin.H{"message": "Customer erased successfully", "data": erasure})
+}
+
+// ExportCustomerData answers a data subject access request with a zip of everything held on the customer
+func ExportCustomerData(c *gin.Context) {
+
+	// Fetch query parameters from /customers/:uid/data-export
+	customer, ok := findScopedCustomer(c, utils.PathParamToIntWithDefault(c, "uid", 0), true)
+	if !ok {
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	export, err := utils.BuildCustomerExport(customer.UID, user.UID)
+	if err != nil {
+		fmt.Println("Error exporting customer data:", err)
+		c.JSON(500, gin.H{"message": "Internal Server Error"})
+		return
+	}
+
+	utils.LogEvent("o_customers", customer.UID, fmt.Sprintf("Customer %d data exported by %s(%d)", customer.UID, user.Name, user.UID), user.UID)
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"customer-%d-data-%s.zip\"", customer.UID, time.Now().Format("20060102")))
+	c.Header("Cache-Control", "private, no-store")
+	c.Status(200)
+	if err := utils.WriteCustomerExportZip(c.Writer, export); err != nil {
+		// the headers are gone by now, all that is left is to log it
+		fmt.Println("Error writing customer data export:", err)
+	}
+}
+
+func GetPossibleDuplicates(c *gin.Context) {
+
+	// Fetch query parameters from /customers/:uid/possible-duplicates
+	customer, ok := findScopedCustomer(c, utils.PathParamToIntWithDefault(c, "uid", 0), false)
+	if !ok {
+		return
+	}
+
+	// Get user and permissions, only customers the user may read are compared
+	user := c.MustGet("user").(models.OUser)
+	scope := utils.GetCustomerScope(c, user)
+
+	duplicates, err := utils.FindPossibleDuplicates(utils.GetDBConn(c), customer, scope)
+	if err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": duplicates})
+}
+
+// MergeCustomers merges a duplicate into the customer in the path, moving their loans, contacts, referees,
+// guarantors, interactions and documents across and deleting the duplicate
+func MergeCustomers(c *gin.Context) {
+
+	// set necessary variables
+	var mergeInput schemas.CustomerMergeSchema
+
+	// Fetch query parameters from /customers/:uid/merge
+	survivor, ok := findScopedCustomer(c, utils.PathParamToIntWithDefault(c, "uid", 0), false)
+	if !ok {
+		return
+	}
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&mergeInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if mergeInput.DuplicateID == survivor.UID {
+		c.JSON(400, gin.H{"error": "Cannot merge a customer into themselves"})
+		return
+	}
+
+	duplicate, ok := findScopedCustomer(c, mergeInput.DuplicateID, false)
+	if !ok {
+		return
+	}
+
+	// the survivor is updated and the duplicate deleted
+	if !utils.HasCustomerPermission(c, survivor, "update_") {
+		utils.AbortForbidden(c, "o_customers", "update_")
+		return
+	}
+	if !utils.HasCustomerPermission(c, duplicate, "delete_") {
+		utils.AbortForbidden(c, "o_customers", "delete_")
+		return
+	}
+
+	// the duplicate's loans are moved to the survivor
+	var loans int64
+	if err := inits.CurrentDB.Model(&models.OLoan{}).Where("customer_id = ?", duplicate.UID).Count(&loans).Error; err != nil {
+		c.JSON(500, gin.H{"message": "Internal Server Error"})
+		return
+	}
+	if loans > 0 && !utils.HasPermission(c, "o_loans", "update_") {
+		utils.AbortForbidden(c, "o_loans", "update_")
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	merge, moved, err := utils.MergeCustomers(survivor, duplicate, strings.TrimSpace(mergeInput.Reason), user.UID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error merging customers"})
+		return
+	}
+
+	counts := make([]string, 0, len(moved))
+	for name, uids := range moved {
+		counts = append(counts, fmt.Sprintf("%d %s", len(uids), name))
+	}
+	sort.Strings(counts)
+	movedSummary := utils.DefaultIfEmpty(strings.Join(counts, ", "), "no records")
+
+	utils.LogEvent("o_customers", survivor.UID, fmt.Sprintf("Customer %s(%d) merged into this customer by %s(%d), moved %s. Reason: %s", duplicate.FullName, duplicate.UID, user.Name, user.UID, movedSummary, merge.Reason), user.UID)
+	utils.LogEvent("o_customers", duplicate.UID, fmt.Sprintf("Customer merged into %s(%d) and deleted by %s(%d), merge %d", survivor.FullName, survivor.UID, user.Name, user.UID, merge.UID), user.UID)
+
+	c.JSON(200, gin.H{"message": "Customers merged successfully", "uid": merge.UID, "moved": moved})
+}
+
+// GetCustomerOverview returns what the customer page shows in one call, include= picks the sections
+func GetCustomerOverview(c *gin.Context) {
+
+	// Fetch query parameters from /customers/:uid/overview
+	customer, ok := findScopedCustomer(c, utils.PathParamToIntWithDefault(c, "uid", 0), false)
+	if !ok {
+		return
+	}
+	include := utils.QueryParamToStringWithDefault(c, "include", "")
+	sections, err := utils.ParseOverviewInclude(include)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	// sections asked for by name need their permission, the default set leaves them out
+	allowed := make([]string, 0, len(sections))
+	for _, section := range sections {
+		if tbl, ok := utils.CustomerOverviewPermissions[section]; ok && !utils.HasPermission(c, tbl, "read_") {
+			if include != "" {
+				utils.AbortForbidden(c, tbl, "read_")
+				return
+			}
+			continue
+		}
+		allowed = append(allowed, section)
+	}
+
+	overview, err := utils.BuildCustomerOverview(utils.GetDBConn(c), customer.UID, allowed)
+	if err != nil {
+		fmt.Println("Error building customer overview:", err)
+		c.JSON(500, gin.H{"message": "Internal Server Error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": overview})
+}
@@ -1,7 +1,9 @@
 package controllers
 
 import (
-	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	"super-lender/utils"
 	"time"
 
 	"strconv"
@@ -34,48 +36,97 @@ func GetCustomerConversations(c *gin.Context) {
 		NextInteraction  time.Time `json:"next_interaction"`
 	}
 
-	// Fetch 10 rows ordered by UID column in descending order with an offset
-	offset := (pageNo - 1) * rpp
-	query := `
-        SELECT cc.uid, c.full_name, c.branch, cc.transcript, cc.conversation_date, cc.next_interaction
-        FROM o_customer_conversations cc
-        INNER JOIN o_customers c ON c.uid = cc.customer_id
-        WHERE c.full_name LIKE ?
-        ORDER BY cc.` + orderby + ` ` + dir + `
-        LIMIT ? OFFSET ?
-    `
-
-	// Execute raw SQL query to fetch data
+	// Get user and permissions
+	user := c.MustGet("user").(models.OUser)
+	scope := utils.GetCustomerScope(c, user)
+
+	// set db connection
+	db := utils.GetDBConn(c)
+
+	selectQuery := utils.CustomerConversationsQueryBuilder(db, searchTerm, scope, "select")
+	selectQuery = selectQuery.Order("cc." + orderby + " " + dir)
+
+	// format=csv|xlsx streams every matching interaction instead of a page
+	if isListExport(c) {
+		exportList(c, "o_customer_conversations", "interactions", selectQuery)
+		return
+	}
+
+	// Fetch a page of rows with an offset
 	var customerConversations []ConversationResult
-	result := inits.CurrentDB.Raw(query, "%"+searchTerm+"%", rpp, offset).Scan(&customerConversations)
+	offset := (pageNo - 1) * rpp
+	if err := selectQuery.Limit(rpp).Offset(offset).Scan(&customerConversations).Error; err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
 
-	if result.Error != nil {
+	// Fetch total count of rows with limit
+	var totalCount int64
+	var uidResults []schemas.UIDCountResultsSchema
+	countQuery := utils.CustomerConversationsQueryBuilder(db, searchTerm, scope, "count")
+	var err error
+	if countLimit > 0 {
+		err = countQuery.Limit(countLimit).Scan(&uidResults).Error
+		totalCount = int64(len(uidResults))
+	} else {
+		err = countQuery.Count(&totalCount).Error
+	}
+	if err != nil {
 		c.JSON(500, gin.H{
 			"message": "Internal Server Error",
 		})
 		return
 	}
 
-	// // Fetch total count of rows with limit
-	countQuery := `
-	SELECT cc.uid
-	FROM o_customer_conversations cc
-	INNER JOIN o_customers c ON c.uid = cc.customer_id
-	WHERE c.full_name LIKE ?
-	LIMIT ?`
+	c.JSON(200, gin.H{
+		"count": totalCount,
+		"data":  customerConversations,
+	})
+}
 
-	var totalCount int64
-	countResult := inits.CurrentDB.Raw(countQuery, "%"+searchTerm+"%", countLimit).Count(&totalCount)
+func SearchCustomerConversations(c *gin.Context) {
+
+	// Fetch query parameters
+	filter := utils.ConversationSearchFilter{
+		Query:      utils.QueryParamToStringWithDefault(c, "q", ""),
+		From:       utils.QueryParamToStringWithDefault(c, "from", ""),
+		To:         utils.QueryParamToStringWithDefault(c, "to", ""),
+		Agent:      utils.QueryParamToIntWithDefault(c, "agent", 0),
+		Method:     utils.QueryParamToIntWithDefault(c, "method", 0),
+		Outcome:    utils.QueryParamToIntWithDefault(c, "outcome", 0),
+		Flag:       utils.QueryParamToIntWithDefault(c, "flag", 0),
+		PageNo:     utils.QueryParamToIntWithDefault(c, "pageNo", 1),
+		PageSize:   utils.QueryParamToIntWithDefault(c, "pageSize", 10),
+		CountLimit: utils.QueryParamToIntWithDefault(c, "countLimit", 1000),
+	}
 
-	// countQuery := `
-	// SELECT COUNT(cc.uid)
-	// FROM o_customer_conversations cc
-	// INNER JOIN o_customers c ON c.uid = cc.customer_id
-	// WHERE c.full_name LIKE ?`
+	// validate date range
+	for _, date := range []string{filter.From, filter.To} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(utils.DateFormat, date); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid date format, expected YYYY-MM-DD"})
+			return
+		}
+	}
 
-	// countResult := inits.CurrentDB.Raw(countQuery, "%"+searchTerm+"%").Scan(&totalCount)
+	// the FULLTEXT index is only kept on the current database
+	if filter.Query != "" && utils.IsArchiveConn(c) {
+		c.JSON(400, gin.H{"error": "Transcript search is not available on archived data"})
+		return
+	}
+
+	// Get user and scope
+	user := c.MustGet("user").(models.OUser)
+	filter.Scope = utils.GetCustomerScope(c, user)
 
-	if countResult.Error != nil {
+	// search transcripts
+	var searcher utils.ConversationSearcher = utils.MySQLConversationSearcher{DB: utils.GetDBConn(c)}
+	results, count, err := searcher.Search(filter)
+	if err != nil {
 		c.JSON(500, gin.H{
 			"message": "Internal Server Error",
 		})
@@ -83,7 +134,7 @@ func GetCustomerConversations(c *gin.Context) {
 	}
 
 	c.JSON(200, gin.H{
-		"count": totalCount, // 57984
-		"data":  customerConversations,
+		"count": count,
+		"data":  results,
 	})
 }
@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	customTypes "super-lender/types"
+	"super-lender/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+func FindCustomerDocuments(c *gin.Context) {
+
+	// set result schema
+	var documentsResult []schemas.CustomerDocumentSchema
+
+	// Fetch query parameters from /customers/:uid/documents
+	customer, ok := findScopedCustomer(c, utils.PathParamToIntWithDefault(c, "uid", 0), false)
+	if !ok {
+		return
+	}
+	includeReplaced := utils.QueryParamToIntWithDefault(c, "replaced", 0) == 1
+
+	// documents are stored on the current database only, as uploads, deletes and downloads are
+	db := inits.CurrentDB
+
+	if err := utils.CustomerDocumentsQueryBuilder(db, customer.UID, includeReplaced).Scan(&documentsResult).Error; err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	for i := range documentsResult {
+		documentsResult[i].URL = utils.SignedDocumentURL(documentsResult[i].UID, false)
+		if documentsResult[i].HasThumbnail {
+			documentsResult[i].ThumbnailURL = utils.SignedDocumentURL(documentsResult[i].UID, true)
+		}
+	}
+
+	c.JSON(200, gin.H{"data": documentsResult})
+}
+
+// UploadCustomerDocument takes a multipart upload with the file in "file", its type in "documentType" and an optional "description"
+func UploadCustomerDocument(c *gin.Context) {
+
+	// set necessary variables
+	var documentInput schemas.CustomerDocumentInputSchema
+
+	// Fetch query parameters from /customers/:uid/documents
+	customer, ok := findScopedCustomer(c, utils.PathParamToIntWithDefault(c, "uid", 0), false)
+	if !ok {
+		return
+	}
+
+	if !utils.HasCustomerPermission(c, customer, "update_") {
+		utils.AbortForbidden(c, "o_customers", "update_")
+		return
+	}
+
+	// leave room for the other form fields on top of the file
+	maxBytes := utils.DocumentMaxBytes()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+(1<<20))
+
+	// bind form fields to schema
+	if err := c.ShouldBind(&documentInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("File is larger than %d MB", maxBytes>>20)})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(400, gin.H{"error": "File is required"})
+		return
+	}
+	if fileHeader.Size > maxBytes {
+		c.JSON(413, gin.H{"error": fmt.Sprintf("File is larger than %d MB", maxBytes>>20)})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Could not read file"})
+		return
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Could not read file"})
+		return
+	}
+
+	storage, err := utils.GetStorage()
+	if err != nil {
+		c.JSON(500, gin.H{"message": "Internal Server Error"})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	document, err := utils.SaveCustomerDocument(storage, customer.UID, models.DocumentType(documentInput.DocumentType), fileHeader.Filename, content, strings.TrimSpace(documentInput.Description), user.UID)
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrDocumentTooLarge):
+			c.JSON(413, gin.H{"error": fmt.Sprintf("File is larger than %d MB", maxBytes>>20)})
+		case errors.Is(err, utils.ErrDocumentTypeNotAllowed):
+			c.JSON(400, gin.H{"error": "Only JPEG, PNG and PDF files are accepted, passport photos must be JPEG or PNG"})
+		default:
+			c.JSON(500, gin.H{"error": "Error saving document"})
+		}
+		return
+	}
+
+	utils.LogEvent("o_customers", customer.UID, fmt.Sprintf("Document %s %s(%d) uploaded by %s(%d)", document.DocumentType, document.FileName, document.UID, user.Name, user.UID), user.UID)
+
+	response := gin.H{"message": "Document uploaded successfully", "uid": document.UID, "url": utils.SignedDocumentURL(document.UID, false)}
+	if document.ThumbnailKey != "" {
+		response["thumbnailUrl"] = utils.SignedDocumentURL(document.UID, true)
+	}
+	c.JSON(200, response)
+}
+
+func DeleteCustomerDocument(c *gin.Context) {
+
+	// Fetch query parameters from /documents/:uid
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid document id"})
+		return
+	}
+
+	var document models.OCustomerDocument
+	if err := inits.CurrentDB.Where("uid = ? AND status != ?", uid, models.DeletedDocument).First(&document).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Document not found"})
+		return
+	}
+
+	customer, ok := findScopedCustomer(c, document.CustomerID, false)
+	if !ok {
+		return
+	}
+	if !utils.HasCustomerPermission(c, customer, "update_") {
+		utils.AbortForbidden(c, "o_customers", "update_")
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	// the file stays in storage for the audit trail, only the metadata is marked deleted
+	if err := inits.CurrentDB.Model(&document).Update("status", models.DeletedDocument).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error deleting document"})
+		return
+	}
+	if customer.PassportPhoto == document.StorageKey {
+		inits.CurrentDB.Model(&models.OCustomer{}).Where("uid = ?", customer.UID).Update("passport_photo", "")
+	}
+
+	utils.LogEvent("o_customers", customer.UID, fmt.Sprintf("Document %s %s(%d) deleted by %s(%d)", document.DocumentType, document.FileName, document.UID, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"message": "Document deleted successfully"})
+}
+
+// DownloadCustomerDocument serves a file through a link from SignedDocumentURL, the signature stands in for authentication
+func DownloadCustomerDocument(c *gin.Context) {
+
+	// Fetch query parameters from /documents/:uid/download
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	thumb := utils.QueryParamToIntWithDefault(c, "thumb", 0) == 1
+	expires := int64(utils.QueryParamToIntWithDefault(c, "expires", 0))
+	signature := utils.QueryParamToStringWithDefault(c, "signature", "")
+
+	if uid == 0 || !utils.VerifyDocumentSignature(uid, thumb, expires, signature) {
+		c.JSON(403, gin.H{"error": "Link is invalid or has expired"})
+		return
+	}
+
+	var document models.OCustomerDocument
+	if err := inits.CurrentDB.Where("uid = ? AND status != ?", uid, models.DeletedDocument).First(&document).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Document not found"})
+		return
+	}
+
+	key, size, mimeType := document.StorageKey, document.Size, document.MimeType
+	if thumb {
+		if document.ThumbnailKey == "" {
+			c.JSON(404, gin.H{"error": "Document has no thumbnail"})
+			return
+		}
+		key, size, mimeType = document.ThumbnailKey, -1, "image/jpeg"
+	}
+
+	storage, err := utils.GetStorage()
+	if err != nil {
+		c.JSON(500, gin.H{"message": "Internal Server Error"})
+		return
+	}
+
+	reader, err := storage.Get(key)
+	if err != nil {
+		if errors.Is(err, utils.ErrObjectNotFound) {
+			c.JSON(404, gin.H{"error": "Document file is missing"})
+			return
+		}
+		c.JSON(500, gin.H{"message": "Internal Server Error"})
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(200, size, mimeType, reader, map[string]string{
+		"Content-Disposition":    fmt.Sprintf("inline; filename=%q", document.FileName),
+		"Cache-Control":          "private, no-store",
+		"X-Content-Type-Options": "nosniff",
+	})
+}
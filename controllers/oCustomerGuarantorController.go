@@ -26,16 +26,6 @@ func GetCustomerGuarantor(c *gin.Context) {
 	// Fetch query parameters from /customers/:uid
 	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
 
-	// get user permission
-	// Get user and permissions
-	user := c.MustGet("user").(models.OUser)
-	userId := user.UID
-	readPermi := utils.GetPermission(userId, "o_customers", 0, "read_")
-	if !readPermi {
-		c.JSON(403, gin.H{"error": "Forbidden"})
-		return
-	}
-
 	// set db connection
 	db := utils.GetDBConn(c)
 
@@ -45,8 +35,11 @@ func GetCustomerGuarantor(c *gin.Context) {
 	query = query.Joins("LEFT JOIN o_customer_guarantor_relationships gr ON gr.uid =g.relationship")
 	query = query.Select("g.uid, g.guarantor_name, g.customer_id, g.mobile_no, g.national_id, g.physical_address, g.amount_guaranteed, g.added_date, gr.name AS relationship, g.status")
 
-	// Apply filters
+	// Apply filters, the guarantor's customer must be within the user's scope
+	user := c.MustGet("user").(models.OUser)
+	query = query.Joins("INNER JOIN o_customers c ON c.uid = g.customer_id")
 	query = query.Where("g.uid = ?", uid)
+	query = utils.GetCustomerScope(c, user).Apply(query, "c.branch", "c.uid")
 
 	// execute query
 	err := query.Scan(&customerGuarantorResult).Error
@@ -77,20 +70,6 @@ func CreateCustomerGuarantor(c *gin.Context) {
 		return
 	}
 
-	// Get user and permissions
-	user := c.MustGet("user").(models.OUser)
-	userId := user.UID
-
-	// check if user has necessary permissions permission to create customer guarantor
-	createPermi := utils.GetPermission(userId, "o_customers", 0, "update_")
-	if !createPermi {
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
-			"status":  403,
-			"message": "You don't have permission to create customer guarantor!",
-		})
-		return
-	}
-
 	// set db connection
 	db := inits.CurrentDB
 	guarantorName := utils.TrimString(customerGuarantorInput.GuarantorName)
@@ -181,16 +160,6 @@ func UpdateCustomerGuarantor(c *gin.Context) {
 	user := c.MustGet("user").(models.OUser)
 	userId := user.UID
 
-	// Check if user has necessary permissions to update customer guarantor
-	updatePermi := utils.GetPermission(userId, "o_customers", 0, "update_")
-	if !updatePermi {
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
-			"status":  403,
-			"message": "You don't have permission to update customer guarantor!",
-		})
-		return
-	}
-
 	// Set db connection
 	db := inits.CurrentDB
 
@@ -323,15 +292,8 @@ func GetCustomerGuarantors(c *gin.Context) {
 	// Fetch query parameters from /customers/:uid/guarantors
 	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
 
-	// Get user and permissions
-	user := c.MustGet("user").(models.OUser)
-	userId := user.UID
-	readPermi := utils.GetPermission(userId, "o_customers", 0, "read_")
-	if !readPermi {
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
-			"status":  403,
-			"message": "You don't have permission to read customer guarantors!",
-		})
+	// the customer must be within the user's scope
+	if _, ok := findScopedCustomer(c, uid, true); !ok {
 		return
 	}
 
@@ -339,13 +301,7 @@ func GetCustomerGuarantors(c *gin.Context) {
 	db := utils.GetDBConn(c)
 
 	// build query
-	query := db.Table("o_customer_guarantors g")
-	// join with o_customer_guarantor_relationships to get relationship name
-	query = query.Joins("LEFT JOIN o_customer_guarantor_relationships gr ON gr.uid =g.relationship")
-	query = query.Select("g.uid, g.guarantor_name, g.customer_id, g.mobile_no, g.national_id, g.physical_address, g.amount_guaranteed, g.added_date, gr.name AS relationship, g.status")
-
-	// Apply filters
-	query = query.Where("g.customer_id = ?", uid)
+	query := utils.CustomerGuarantorsQueryBuilder(db, uid)
 
 	// Execute query
 	err := query.Scan(&customerGuarantorResult).Error
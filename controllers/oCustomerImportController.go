@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	"super-lender/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// customerImportMaxBytes is the largest spreadsheet accepted
+const customerImportMaxBytes = 10 << 20
+
+// customerImportMaxRows is the most data rows one import may have, IMPORT_MAX_ROWS (default 5000)
+func customerImportMaxRows() int {
+	rows, err := strconv.Atoi(os.Getenv("IMPORT_MAX_ROWS"))
+	if err != nil || rows <= 0 {
+		rows = 5000
+	}
+	return rows
+}
+
+// ImportCustomers takes a CSV or XLSX file in "file" and starts a background job that creates a lead for every
+// valid row. With dryRun=1 the rows are only checked. The job is followed through GetCustomerImport.
+func ImportCustomers(c *gin.Context) {
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, customerImportMaxBytes+(1<<20))
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			c.JSON(413, gin.H{"error": fmt.Sprintf("File is larger than %d MB", customerImportMaxBytes>>20)})
+			return
+		}
+		c.JSON(400, gin.H{"error": "File is required"})
+		return
+	}
+	dryRun := c.PostForm("dryRun") == "1" || strings.EqualFold(c.PostForm("dryRun"), "true")
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Could not read file"})
+		return
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, customerImportMaxBytes+1))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Could not read file"})
+		return
+	}
+	if len(content) > customerImportMaxBytes {
+		c.JSON(413, gin.H{"error": fmt.Sprintf("File is larger than %d MB", customerImportMaxBytes>>20)})
+		return
+	}
+
+	// the header row comes on top of the data rows
+	rows, err := utils.ReadSpreadsheet(fileHeader.Filename, content, customerImportMaxRows()+1)
+	if err != nil {
+		if errors.Is(err, utils.ErrUnsupportedSpreadsheet) {
+			c.JSON(400, gin.H{"error": "Only .csv and .xlsx files are supported"})
+			return
+		}
+		if errors.Is(err, utils.ErrSpreadsheetTooLarge) {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("File has more than %d rows or too many columns, split it up", customerImportMaxRows())})
+			return
+		}
+		c.JSON(400, gin.H{"error": "File could not be read as a spreadsheet"})
+		return
+	}
+	if len(rows) < 2 {
+		c.JSON(400, gin.H{"error": "File has no rows to import"})
+		return
+	}
+	if len(rows)-1 > customerImportMaxRows() {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("File has more than %d rows, split it up", customerImportMaxRows())})
+		return
+	}
+
+	header, err := utils.ParseCustomerImportHeader(rows[0])
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid header row, " + err.Error()})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	job := models.OImportJob{
+		Kind:      "customers",
+		FileName:  utils.TruncateString(fileHeader.Filename, 255),
+		DryRun:    utils.BoolToInt(dryRun),
+		TotalRows: len(rows) - 1,
+		CreatedBy: user.UID,
+		Status:    models.QueuedImport,
+	}
+	if err := inits.CurrentDB.Create(&job).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error starting import"})
+		return
+	}
+
+	go utils.RunCustomerImport(job, header, rows, user)
+
+	c.JSON(202, gin.H{"message": "Import started", "uid": job.UID, "dryRun": dryRun, "ignoredColumns": header.Ignored})
+}
+
+// GetCustomerImport returns an import job with its per-row report once it has completed
+func GetCustomerImport(c *gin.Context) {
+
+	// Fetch query parameters from /customers/import/:uid
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid import id"})
+		return
+	}
+
+	// Get user, only the user who started an import or an admin may see it
+	user := c.MustGet("user").(models.OUser)
+
+	var job models.OImportJob
+	if err := inits.CurrentDB.Where("uid = ? AND kind = ?", uid, "customers").First(&job).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Import not found"})
+		return
+	}
+	if job.CreatedBy != user.UID && !utils.RequestPermissions(c).Admin {
+		c.JSON(404, gin.H{"error": "Import not found"})
+		return
+	}
+
+	var report *schemas.CustomerImportReportSchema
+	if job.Report != "" {
+		report = &schemas.CustomerImportReportSchema{}
+		if err := json.Unmarshal([]byte(job.Report), report); err != nil {
+			c.JSON(500, gin.H{"message": "Internal Server Error"})
+			return
+		}
+	}
+
+	c.JSON(200, gin.H{"data": gin.H{"job": job, "report": report}})
+}
@@ -26,15 +26,6 @@ func GetCustomerReferee(c *gin.Context) {
 		return
 	}
 
-	// Get user and permissions
-	user := c.MustGet("user").(models.OUser)
-	userId := user.UID
-	readPermi := utils.GetPermission(userId, "o_customers", 0, "read_")
-	if !readPermi {
-		c.JSON(403, gin.H{"error": "Forbidden"})
-		return
-	}
-
 	// set db connection
 	db := utils.GetDBConn(c)
 
@@ -44,6 +35,11 @@ func GetCustomerReferee(c *gin.Context) {
 	query = query.Select("r.uid, r.referee_name, r.customer_id, r.mobile_no, r.physical_address, rr.name AS relationship, r.added_date")
 	query = query.Where("r.uid = ?", uid)
 
+	// the referee's customer must be within the user's scope
+	user := c.MustGet("user").(models.OUser)
+	query = query.Joins("INNER JOIN o_customers c ON c.uid = r.customer_id")
+	query = utils.GetCustomerScope(c, user).Apply(query, "c.branch", "c.uid")
+
 	// execute query
 	err := query.Scan(&customerRefereeResult).Error
 	if err != nil {
@@ -65,12 +61,8 @@ func GetCustomerReferees(c *gin.Context) {
 	// Fetch query parameters from /customers/:uid/referees
 	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
 
-	// Get user and permissions
-	user := c.MustGet("user").(models.OUser)
-	userId := user.UID
-	readPermi := utils.GetPermission(userId, "o_customers", 0, "read_")
-	if !readPermi {
-		c.JSON(403, gin.H{"error": "Forbidden"})
+	// the customer must be within the user's scope
+	if _, ok := findScopedCustomer(c, uid, true); !ok {
 		return
 	}
 
@@ -78,10 +70,7 @@ func GetCustomerReferees(c *gin.Context) {
 	db := utils.GetDBConn(c)
 
 	// build query
-	query := db.Table("o_customer_referees r")
-	query = query.Joins("LEFT JOIN o_customer_referee_relationships rr ON r.relationship = rr.uid")
-	query = query.Select("r.uid, r.referee_name, r.customer_id, r.mobile_no, r.physical_address, rr.name AS relationship, r.added_date")
-	query = query.Where("r.customer_id = ?", uid)
+	query := utils.CustomerRefereesQueryBuilder(db, uid)
 
 	// execute query
 	err := query.Scan(&customerRefereesResult).Error
@@ -117,15 +106,6 @@ func CreateCustomerReferee(c *gin.Context) {
 		return
 	}
 
-	// Get user and permissions
-	user := c.MustGet("user").(models.OUser)
-	userId := user.UID
-	writePermi := utils.GetPermission(userId, "o_customers", 0, "create_")
-	if !writePermi {
-		c.JSON(403, gin.H{"error": "Forbidden"})
-		return
-	}
-
 	/// trim & sanitize inputs inputs
 	customerRefereeInput.MobileNo = utils.MakePhoneValid(customerRefereeInput.MobileNo)
 
@@ -192,14 +172,8 @@ func UpdateCustomerReferee(c *gin.Context) {
 
 	///======= End of input validation
 
-	// Get user and permissions
+	// Get user
 	user := c.MustGet("user").(models.OUser)
-	userId := user.UID
-	writePermi := utils.GetPermission(userId, "o_customers", 0, "update_")
-	if !writePermi {
-		c.JSON(403, gin.H{"error": "Forbidden"})
-		return
-	}
 
 	/// trim & sanitize inputs
 	customerRefereeInput.MobileNo = utils.MakePhoneValid(customerRefereeInput.MobileNo)
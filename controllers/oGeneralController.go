@@ -1,9 +1,60 @@
 package controllers
 
-import "github.com/gin-gonic/gin"
+import (
+	"fmt"
+	"super-lender/models"
+	"super-lender/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
 
 func HeathCheck(c *gin.Context) {
 	c.JSON(200, gin.H{
 		"message": "pong",
 	})
 }
+
+// isListExport tells whether a list was asked for as a file with format=csv or format=xlsx
+func isListExport(c *gin.Context) bool {
+	format := utils.QueryParamToStringWithDefault(c, "format", "")
+	return format == "csv" || format == "xlsx"
+}
+
+// exportList streams every row of a list query as a csv or xlsx download. Exports need export_ on
+// the table and each one is logged, the filters used included.
+func exportList(c *gin.Context, tbl, name string, query *gorm.DB) {
+	if !utils.HasPermission(c, tbl, "export_") {
+		utils.AbortForbidden(c, tbl, "export_")
+		return
+	}
+
+	format := utils.QueryParamToStringWithDefault(c, "format", "")
+	exporter, err := utils.NewListExporter(format, c.Writer)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	c.Header("Content-Type", utils.ExportContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-%s.%s\"", name, time.Now().Format("20060102-150405"), format))
+	c.Header("Cache-Control", "private, no-store")
+	c.Status(200)
+
+	count, err := utils.StreamQueryExport(query, exporter)
+	if err == nil {
+		err = exporter.Close()
+	}
+	// the headers are gone by now, all that is left is to log it and say so in the event
+	outcome := ""
+	if err != nil {
+		fmt.Println("Error exporting "+name+":", err)
+		outcome = " Export failed after these rows, the file is incomplete."
+	}
+
+	utils.LogEvent(tbl, 0, fmt.Sprintf("%d %s exported as %s by %s(%d).%s Filters: %s", count, name, format, user.Name, user.UID, outcome, utils.DefaultIfEmpty(c.Request.URL.RawQuery, "none")), user.UID)
+}
@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	customTypes "super-lender/types"
+	"super-lender/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+func FindManyKycRequirements(c *gin.Context) {
+
+	// set result schema
+	var requirementsResult []schemas.KycRequirementSchema
+
+	// set db connection
+	db := utils.GetDBConn(c)
+
+	if err := utils.KycRequirementsQueryBuilder(db).Scan(&requirementsResult).Error; err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": requirementsResult})
+}
+
+// SetKycRequirement creates or replaces the checklist of a product, product 0 is the default checklist
+func SetKycRequirement(c *gin.Context) {
+
+	// set necessary variables
+	var requirementInput schemas.KycRequirementInputSchema
+
+	// Fetch query parameters from /kyc-requirements/:product
+	productID := utils.PathParamToIntWithDefault(c, "product", -1)
+	if productID < 0 {
+		c.JSON(400, gin.H{"error": "Invalid product id"})
+		return
+	}
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&requirementInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if productID > 0 {
+		var count int64
+		inits.CurrentDB.Table("o_loan_products").Where("uid = ?", productID).Count(&count)
+		if count == 0 {
+			c.JSON(404, gin.H{"error": "Product not found"})
+			return
+		}
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	var existingRequirement models.OKycRequirement
+	if err := inits.CurrentDB.Where("product_id = ?", productID).First(&existingRequirement).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(500, gin.H{"message": "Internal Server Error"})
+		return
+	}
+
+	requirement := existingRequirement
+	requirement.ProductID = productID
+	requirement.RequireNationalID = utils.BoolToInt(requirementInput.RequireNationalID)
+	requirement.RequirePhoto = utils.BoolToInt(requirementInput.RequirePhoto)
+	requirement.MinReferees = requirementInput.MinReferees
+	requirement.MinGuarantors = requirementInput.MinGuarantors
+	requirement.RequireVerifiedContacts = utils.BoolToInt(requirementInput.RequireVerifiedContacts)
+	requirement.UpdatedBy = user.UID
+
+	if err := inits.CurrentDB.Save(&requirement).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error saving KYC checklist"})
+		return
+	}
+
+	if existingRequirement.UID == 0 {
+		utils.LogEvent("o_kyc_requirements", requirement.UID, fmt.Sprintf("KYC checklist for product %d created by %s(%d)", productID, user.Name, user.UID), user.UID)
+	} else {
+		utils.CreateChangesLog("o_kyc_requirements", "KYC checklist", requirement.UID, requirement.UID, "Update", existingRequirement, requirement, user, []string{"UID", "ProductID", "UpdatedBy", "UpdatedDate"})
+	}
+
+	c.JSON(200, gin.H{"message": "KYC checklist saved successfully", "uid": requirement.UID})
+}
+
+// findScopedCustomer loads a customer if the user may read them, it responds itself when not.
+// Deleted customers are only found with includeDeleted.
+func findScopedCustomer(c *gin.Context, uid int, includeDeleted bool) (models.OCustomer, bool) {
+	var customer models.OCustomer
+
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid customer id"})
+		return customer, false
+	}
+
+	// Get user and permissions
+	user := c.MustGet("user").(models.OUser)
+	scope := utils.GetCustomerScope(c, user)
+
+	db := utils.GetDBConn(c)
+	query := db.Table("o_customers c").Where("c.uid = ?", uid)
+	if !includeDeleted {
+		query = query.Where("c.status != ?", models.DELETED)
+	}
+	query = scope.Apply(query, "c.branch", "c.uid")
+	if err := query.Take(&customer).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": "Customer not found"})
+			return customer, false
+		}
+		c.JSON(500, gin.H{"message": "Internal Server Error"})
+		return customer, false
+	}
+
+	return customer, true
+}
+
+func GetCustomerKycStatus(c *gin.Context) {
+
+	// Fetch query parameters from /customers/:uid/kyc-status
+	customer, ok := findScopedCustomer(c, utils.PathParamToIntWithDefault(c, "uid", 0), false)
+	if !ok {
+		return
+	}
+
+	kycStatus, err := utils.EvaluateKyc(utils.GetDBConn(c), customer)
+	if err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": kycStatus})
+}
+
+// ActivateCustomer moves a lead or draft customer to ACTIVE once they pass the KYC checklist of their product
+func ActivateCustomer(c *gin.Context) {
+
+	// Fetch query parameters from /customers/:uid/activate
+	customer, ok := findScopedCustomer(c, utils.PathParamToIntWithDefault(c, "uid", 0), false)
+	if !ok {
+		return
+	}
+
+	if !utils.HasCustomerPermission(c, customer, "update_") {
+		utils.AbortForbidden(c, "o_customers", "update_")
+		return
+	}
+
+	switch customer.Status {
+	case models.ACTIVE:
+		c.JSON(400, gin.H{"error": "Customer is already active"})
+		return
+	case models.BLOCKED:
+		c.JSON(400, gin.H{"error": "Customer is blocked, unblock them instead"})
+		return
+	}
+
+	kycStatus, err := utils.CheckCanActivate(inits.CurrentDB, customer)
+	if err != nil {
+		if errors.Is(err, utils.ErrKycIncomplete) {
+			c.JSON(400, gin.H{"error": "KYC checklist is incomplete", "missing": kycStatus.Missing})
+			return
+		}
+		c.JSON(500, gin.H{"message": "Internal Server Error"})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	if err := inits.CurrentDB.Model(&models.OCustomer{}).Where("uid = ? AND status = ?", customer.UID, customer.Status).Update("status", models.ACTIVE).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error activating customer"})
+		return
+	}
+
+	utils.LogEvent("o_customers", customer.UID, fmt.Sprintf("Customer %s(%d) activated by %s(%d)", customer.FullName, customer.UID, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"message": "Customer activated successfully"})
+}
+
+// VerifyCustomerContact records that a staff member confirmed a customer's contact, a changed value has to be verified again
+func VerifyCustomerContact(c *gin.Context) {
+
+	// Fetch query parameters from /contacts/:uid/verify
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid contact id"})
+		return
+	}
+
+	var contact models.OCustomerContacts
+	if err := inits.CurrentDB.Where("uid = ? AND status = 1", uid).First(&contact).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Customer contact not found"})
+		return
+	}
+
+	// only contacts of customers the user can see
+	if _, ok := findScopedCustomer(c, contact.CustomerID, false); !ok {
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	now := time.Now()
+	if err := inits.CurrentDB.Model(&contact).Updates(map[string]interface{}{"verified_by": user.UID, "verified_date": now}).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error verifying contact"})
+		return
+	}
+
+	utils.LogEvent("o_customers", contact.CustomerID, fmt.Sprintf("Contact %s(%d) verified by %s(%d)", contact.Value, contact.UID, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"message": "Contact verified successfully"})
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"fmt"
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	"super-lender/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetLoginHistory(c *gin.Context) {
+
+	// set result schema
+	var historyResult []schemas.LoginHistorySchema
+
+	// Fetch query parameters from /users/:uid/login-history
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid user id"})
+		return
+	}
+	pageNo := utils.QueryParamToIntWithDefault(c, "pageNo", 1)
+	pageSize := utils.QueryParamToIntWithDefault(c, "pageSize", 20)
+	outcome := utils.QueryParamToIntWithDefault(c, "outcome", 0)
+	from := utils.QueryParamToStringWithDefault(c, "from", "")
+	to := utils.QueryParamToStringWithDefault(c, "to", "")
+
+	// Get user and permissions, staff can always see their own history
+	user := c.MustGet("user").(models.OUser)
+	if user.UID != uid && !utils.HasPermission(c, "o_users", "read_") {
+		utils.AbortForbidden(c, "o_users", "read_")
+		return
+	}
+
+	// build select query
+	selectQuery := utils.LoginHistoryQueryBuilder(inits.CurrentDB, uid, outcome, from, to, "select")
+	selectQuery = selectQuery.Order("h.uid DESC")
+	selectQuery = selectQuery.Offset((pageNo - 1) * pageSize).Limit(pageSize)
+	if err := selectQuery.Scan(&historyResult).Error; err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	// build count query
+	var count int64
+	countQuery := utils.LoginHistoryQueryBuilder(inits.CurrentDB, uid, outcome, from, to, "count")
+	if err := countQuery.Count(&count).Error; err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	// current lockout, if any
+	lockedUntil := ""
+	if until, locked := utils.GetLoginLock(utils.UserLoginSubject(uid)); locked {
+		lockedUntil = until.Format(utils.DateTimeFormat)
+	}
+
+	c.JSON(200, gin.H{"count": count, "data": historyResult, "lockedUntil": lockedUntil})
+}
+
+func UnlockUser(c *gin.Context) {
+
+	// Fetch query parameters from /users/:uid/unlock
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid user id"})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	// make sure the staff member exists
+	var staff models.OUser
+	if err := inits.CurrentDB.First(&staff, uid).Error; err != nil {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+
+	unlocked, err := utils.ClearLoginLock(utils.UserLoginSubject(staff.UID))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error unlocking account"})
+		return
+	}
+	if !unlocked {
+		c.JSON(200, gin.H{"data": "Account has no failed logins"})
+		return
+	}
+
+	utils.LogEvent("o_users", staff.UID, fmt.Sprintf("Login of %s(%d) unlocked by %s(%d)", staff.Name, staff.UID, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"data": "Account unlocked successfully"})
+}
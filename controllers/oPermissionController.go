@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	customTypes "super-lender/types"
+	"super-lender/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// bindPermissionGrant binds and validates a grant or revoke request, it responds itself when the input is invalid
+func bindPermissionGrant(c *gin.Context) (schemas.PermissionGrantSchema, bool) {
+	var grantInput schemas.PermissionGrantSchema
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&grantInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return grantInput, false
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return grantInput, false
+	}
+
+	grantInput.Tbl = strings.TrimSpace(grantInput.Tbl)
+
+	// a grant belongs either to a group or to a single user
+	if (grantInput.GroupID > 0) == (grantInput.UserID > 0) {
+		c.JSON(400, gin.H{"error": "Either groupId or userId is required"})
+		return grantInput, false
+	}
+
+	if grantInput.GroupID > 0 {
+		if grantInput.GroupID == utils.AdminUserGroup {
+			c.JSON(400, gin.H{"error": "The admin group already has every permission"})
+			return grantInput, false
+		}
+
+		var userGroup models.OUserGroup
+		if err := inits.CurrentDB.Where("uid = ? AND status = 1", grantInput.GroupID).First(&userGroup).Error; err != nil {
+			c.JSON(404, gin.H{"error": "User group not found"})
+			return grantInput, false
+		}
+	} else {
+		var staff models.OUser
+		if err := inits.CurrentDB.First(&staff, grantInput.UserID).Error; err != nil {
+			c.JSON(404, gin.H{"error": "User not found"})
+			return grantInput, false
+		}
+	}
+
+	return grantInput, true
+}
+
+// describePermissionGrant names the holder and target of a grant for the event log
+func describePermissionGrant(grant schemas.PermissionGrantSchema) string {
+	holder := fmt.Sprintf("group %d", grant.GroupID)
+	if grant.UserID > 0 {
+		holder = fmt.Sprintf("user %d", grant.UserID)
+	}
+
+	target := grant.Tbl
+	if grant.Rec > 0 {
+		target = fmt.Sprintf("%s record %d", grant.Tbl, grant.Rec)
+	}
+
+	return fmt.Sprintf("%s on %s", holder, target)
+}
+
+func GrantPermission(c *gin.Context) {
+
+	grantInput, ok := bindPermissionGrant(c)
+	if !ok {
+		return
+	}
+	if len(grantInput.Actions) == 0 {
+		c.JSON(400, gin.H{"error": "At least one action is required"})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	permission, err := utils.SetPermissionActions(grantInput, 1)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error granting permission"})
+		return
+	}
+
+	utils.LogEvent("o_permissions", permission.UID, fmt.Sprintf("Granted %s to %s by %s(%d)", strings.Join(grantInput.Actions, ", "), describePermissionGrant(grantInput), user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"message": "Permission granted successfully", "data": utils.PermissionRow(permission)})
+}
+
+// RevokePermission clears the given actions, without actions the whole group or user row is removed.
+// For a user only their own grants go, the response lists what their group still allows.
+func RevokePermission(c *gin.Context) {
+
+	grantInput, ok := bindPermissionGrant(c)
+	if !ok {
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	if len(grantInput.Actions) == 0 {
+		permission, found, err := utils.RemovePermission(grantInput)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Error revoking permission"})
+			return
+		}
+		if !found {
+			c.JSON(404, gin.H{"error": "Permission not found"})
+			return
+		}
+
+		utils.LogEvent("o_permissions", permission.UID, fmt.Sprintf("Removed all permissions of %s by %s(%d)", describePermissionGrant(grantInput), user.Name, user.UID), user.UID)
+
+		c.JSON(200, gin.H{"message": "Permission removed successfully"})
+		return
+	}
+
+	permission, err := utils.SetPermissionActions(grantInput, 0)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error revoking permission"})
+		return
+	}
+
+	utils.LogEvent("o_permissions", permission.UID, fmt.Sprintf("Revoked %s from %s by %s(%d)", strings.Join(grantInput.Actions, ", "), describePermissionGrant(grantInput), user.Name, user.UID), user.UID)
+
+	response := gin.H{"message": "Permission revoked successfully", "data": utils.PermissionRow(permission)}
+	if grantInput.UserID > 0 {
+		stillGranted, err := utils.GroupGrantedActions(grantInput.UserID, grantInput.Tbl, grantInput.Rec, grantInput.Actions)
+		if err == nil && len(stillGranted) > 0 {
+			response["message"] = "Permission revoked successfully, the user's group still allows " + strings.Join(stillGranted, ", ")
+			response["grantedByGroup"] = stillGranted
+		}
+	}
+
+	c.JSON(200, response)
+}
+
+func ExplainUserPermissions(c *gin.Context) {
+
+	// Fetch query parameters from /users/:uid/permissions
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid user id"})
+		return
+	}
+
+	// Get user, staff can always see their own permissions
+	user := c.MustGet("user").(models.OUser)
+	if user.UID != uid && !utils.HasPermission(c, "o_permissions", "read_") {
+		utils.AbortForbidden(c, "o_permissions", "read_")
+		return
+	}
+
+	var staff models.OUser
+	if err := inits.CurrentDB.First(&staff, uid).Error; err != nil {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+
+	explained, err := utils.ExplainPermissions(staff)
+	if err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": gin.H{
+		"userId":    staff.UID,
+		"userGroup": staff.UserGroup,
+		"groupName": utils.GetUserGroupName(staff.UserGroup, 1),
+		"admin":     staff.UserGroup == utils.AdminUserGroup,
+		"tables":    explained,
+	}})
+}
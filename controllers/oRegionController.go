@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	customTypes "super-lender/types"
+	"super-lender/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+func FindManyRegions(c *gin.Context) {
+
+	// set result schema
+	var regionsResult []schemas.RegionSchema
+
+	// set db connection
+	db := utils.GetDBConn(c)
+
+	if err := utils.RegionsQueryBuilder(db).Scan(&regionsResult).Error; err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": regionsResult})
+}
+
+func FindRegionByID(c *gin.Context) {
+
+	// set result schema
+	var regionResult schemas.RegionSchema
+	var branchesResult []schemas.BranchSchema
+
+	// Fetch query parameters from /regions/:uid
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid region id"})
+		return
+	}
+
+	// set db connection
+	db := utils.GetDBConn(c)
+
+	if err := utils.RegionsQueryBuilder(db).Where("r.uid = ?", uid).Scan(&regionResult).Error; err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+	if regionResult.UID == 0 {
+		c.JSON(404, gin.H{"error": "Region not found"})
+		return
+	}
+
+	if err := utils.BranchesQueryBuilder(db, -1, uid, nil, "").Where("b.status != ?", models.DeletedBranch).Scan(&branchesResult).Error; err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": gin.H{"region": regionResult, "branches": branchesResult}})
+}
+
+func CreateRegion(c *gin.Context) {
+
+	// set necessary variables
+	var regionInput schemas.RegionInputSchema
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&regionInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkManager(c, regionInput.ManagerID) {
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	region := models.ORegion{
+		Name:        strings.TrimSpace(regionInput.Name),
+		Description: strings.TrimSpace(regionInput.Description),
+		ManagerID:   regionInput.ManagerID,
+		Status:      1,
+	}
+
+	var count int64
+	inits.CurrentDB.Model(&models.ORegion{}).Where("name = ? AND status = 1", region.Name).Count(&count)
+	if count > 0 {
+		c.JSON(400, gin.H{"error": "Region already exists"})
+		return
+	}
+
+	if err := inits.CurrentDB.Create(&region).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error creating region"})
+		return
+	}
+
+	utils.LogEvent("o_regions", region.UID, fmt.Sprintf("Region %s(%d) created by %s(%d)", region.Name, region.UID, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"message": "Region created successfully", "uid": region.UID})
+}
+
+// UpdateRegion changes a region, including its manager who then sees every branch in it
+func UpdateRegion(c *gin.Context) {
+
+	// set necessary variables
+	var regionInput schemas.RegionInputSchema
+
+	// Fetch query parameters from /regions/:uid
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid region id"})
+		return
+	}
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&regionInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var existingRegion models.ORegion
+	if err := inits.CurrentDB.Where("uid = ? AND status = 1", uid).First(&existingRegion).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Region not found"})
+		return
+	}
+
+	if !checkManager(c, regionInput.ManagerID) {
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	region := existingRegion
+	region.Name = strings.TrimSpace(regionInput.Name)
+	region.Description = strings.TrimSpace(regionInput.Description)
+	region.ManagerID = regionInput.ManagerID
+
+	var count int64
+	inits.CurrentDB.Model(&models.ORegion{}).Where("name = ? AND status = 1 AND uid != ?", region.Name, uid).Count(&count)
+	if count > 0 {
+		c.JSON(400, gin.H{"error": "Region already exists"})
+		return
+	}
+
+	if err := inits.CurrentDB.Save(&region).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error updating region"})
+		return
+	}
+
+	utils.CreateChangesLog("o_regions", "region", region.UID, region.UID, "Update", existingRegion, region, user, []string{"UID", "AddedDate", "Status"})
+
+	c.JSON(200, gin.H{"message": "Region updated successfully"})
+}
+
+func DeleteRegion(c *gin.Context) {
+
+	// Fetch query parameters from /regions/:uid
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid region id"})
+		return
+	}
+
+	var region models.ORegion
+	if err := inits.CurrentDB.Where("uid = ? AND status = 1", uid).First(&region).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Region not found"})
+		return
+	}
+
+	// branches must be moved to another region first
+	var count int64
+	inits.CurrentDB.Model(&models.OBranch{}).Where("region_id = ? AND status != ?", uid, models.DeletedBranch).Count(&count)
+	if count > 0 {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Region still has %d branch(es)", count)})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	if err := inits.CurrentDB.Model(&models.ORegion{}).Where("uid = ?", uid).Update("status", 0).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error deleting region"})
+		return
+	}
+
+	utils.LogEvent("o_regions", region.UID, fmt.Sprintf("Region %s(%d) deleted by %s(%d)", region.Name, region.UID, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"message": "Region deleted successfully"})
+}
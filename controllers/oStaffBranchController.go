@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	customTypes "super-lender/types"
+	"super-lender/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// findStaff loads an active staff member by the uid path parameter, it responds itself when there is none
+func findStaff(c *gin.Context) (models.OUser, bool) {
+	var staff models.OUser
+
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid user id"})
+		return staff, false
+	}
+
+	if err := inits.CurrentDB.Where("uid = ? AND status = ?", uid, models.Active).First(&staff).Error; err != nil {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return staff, false
+	}
+
+	return staff, true
+}
+
+func GetStaffBranches(c *gin.Context) {
+
+	// set result schema
+	var staffBranches []schemas.StaffBranchSchema
+
+	// Fetch query parameters from /users/:uid/branches
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid user id"})
+		return
+	}
+	activeOnly := utils.QueryParamToIntWithDefault(c, "active", 0) == 1
+
+	// staff assignments are only kept on the current database
+	db := inits.CurrentDB
+
+	query := utils.StaffBranchesQueryBuilder(db, uid, 0, activeOnly)
+	if err := query.Scan(&staffBranches).Error; err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": staffBranches})
+}
+
+// AssignStaffBranch gives a staff member access to a branch, optionally from and until a date
+func AssignStaffBranch(c *gin.Context) {
+
+	// set necessary variables
+	var staffBranchInput schemas.StaffBranchInputSchema
+
+	staff, ok := findStaff(c)
+	if !ok {
+		return
+	}
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&staffBranchInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	startDate, err := utils.ParseOptionalDate(staffBranchInput.StartDate)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid start date"})
+		return
+	}
+	endDate, err := utils.ParseOptionalDate(staffBranchInput.EndDate)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid end date"})
+		return
+	}
+	if startDate != nil && endDate != nil && endDate.Before(*startDate) {
+		c.JSON(400, gin.H{"error": "End date must be on or after the start date"})
+		return
+	}
+
+	var branch models.OBranch
+	if err := inits.CurrentDB.Where("uid = ? AND status = ?", staffBranchInput.Branch, models.ActiveBranch).First(&branch).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Branch not found"})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	staffBranch, err := utils.AssignStaffBranch(inits.CurrentDB, staff.UID, branch.UID, startDate, endDate, user.UID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error assigning branch"})
+		return
+	}
+
+	period := "from " + utils.DefaultIfEmpty(staffBranchInput.StartDate, "now") + " until " + utils.DefaultIfEmpty(staffBranchInput.EndDate, "further notice")
+	utils.LogEvent("o_users", staff.UID, fmt.Sprintf("%s(%d) assigned to branch %s(%d) %s by %s(%d)", staff.Name, staff.UID, branch.Name, branch.UID, period, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"message": "Branch assigned successfully", "uid": staffBranch.UID})
+}
+
+// UnassignStaffBranch ends a staff member's access to a branch today, or on the endDate query parameter
+func UnassignStaffBranch(c *gin.Context) {
+
+	staff, ok := findStaff(c)
+	if !ok {
+		return
+	}
+
+	// Fetch query parameters from /users/:uid/branches/:branch
+	branch := utils.PathParamToIntWithDefault(c, "branch", 0)
+	if branch == 0 {
+		c.JSON(400, gin.H{"error": "Invalid branch id"})
+		return
+	}
+	endDateParam := utils.QueryParamToStringWithDefault(c, "endDate", "")
+	endDate, err := utils.ParseOptionalDate(endDateParam)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid end date, expected YYYY-MM-DD"})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	affected, err := utils.UnassignStaffBranch(staff.UID, branch, endDate)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error unassigning branch"})
+		return
+	}
+	if affected == 0 {
+		c.JSON(404, gin.H{"error": "Staff member is not assigned to this branch"})
+		return
+	}
+
+	utils.LogEvent("o_users", staff.UID, fmt.Sprintf("%s(%d) unassigned from branch %d as of %s by %s(%d)", staff.Name, staff.UID, branch, utils.DefaultIfEmpty(endDateParam, utils.CurrentDate()), user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"message": "Branch unassigned successfully"})
+}
+
+func GetBranchStaff(c *gin.Context) {
+
+	// set result schema
+	var branchStaff []schemas.BranchStaffSchema
+
+	// Fetch query parameters from /branches/:uid/staff
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid branch id"})
+		return
+	}
+
+	// Get user, staff only see the staff of branches they can see
+	user := c.MustGet("user").(models.OUser)
+	branches := utils.GetBranches(c, user, utils.HasPermission(c, "o_branches", "read_"))
+	if !utils.IntSliceContains(branches, 0) && !utils.IntSliceContains(branches, uid) {
+		utils.AbortForbidden(c, "o_branches", "read_")
+		return
+	}
+
+	// staff assignments are only kept on the current database
+	db := inits.CurrentDB
+
+	if err := utils.BranchStaffQueryBuilder(db, uid).Scan(&branchStaff).Error; err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": branchStaff})
+}
+
+// TransferPortfolio hands a staff member's customers and open loans to a colleague, e.g. when they leave or change branch
+func TransferPortfolio(c *gin.Context) {
+
+	// set necessary variables
+	var transferInput schemas.PortfolioTransferSchema
+
+	// Fetch query parameters from /users/:uid/transfer-portfolio
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid user id"})
+		return
+	}
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&transferInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// moving loans needs update on loans as well as customers
+	if !utils.HasPermission(c, "o_loans", "update_") {
+		utils.AbortForbidden(c, "o_loans", "update_")
+		return
+	}
+
+	if transferInput.ToUserID == uid {
+		c.JSON(400, gin.H{"error": "Cannot transfer a portfolio to the same staff member"})
+		return
+	}
+
+	// the portfolio of staff who have left can still be moved
+	var fromStaff models.OUser
+	if err := inits.CurrentDB.First(&fromStaff, uid).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(500, gin.H{"message": "Internal Server Error"})
+		return
+	}
+
+	var toStaff models.OUser
+	if err := inits.CurrentDB.Where("uid = ? AND status = ? AND account_type = ?", transferInput.ToUserID, models.Active, models.StaffAccount).First(&toStaff).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Receiving staff member not found"})
+		return
+	}
+
+	// Get user, staff limited to some branches only move portfolios between staff of those branches
+	// and one branch at a time
+	user := c.MustGet("user").(models.OUser)
+	branches := utils.GetBranches(c, user, utils.HasPermission(c, "o_branches", "read_"))
+	if !utils.IntSliceContains(branches, 0) {
+		if transferInput.Branch == 0 || !utils.IntSliceContains(branches, transferInput.Branch) ||
+			!utils.IntSliceContains(branches, fromStaff.Branch) || !utils.IntSliceContains(branches, toStaff.Branch) {
+			utils.AbortForbidden(c, "o_branches", "read_")
+			return
+		}
+	}
+
+	result, err := utils.TransferPortfolio(fromStaff.UID, toStaff.UID, transferInput.Branch)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error transferring portfolio"})
+		return
+	}
+
+	scope := "all branches"
+	if transferInput.Branch > 0 {
+		scope = fmt.Sprintf("branch %d", transferInput.Branch)
+	}
+	reason := utils.DefaultIfEmpty(strings.TrimSpace(transferInput.Reason), "no reason given")
+	details := fmt.Sprintf("Portfolio of %s(%d) in %s transferred to %s(%d) by %s(%d): %d customer(s), %d loan(s) as LO, %d loan(s) as CO. Reason: %s",
+		fromStaff.Name, fromStaff.UID, scope, toStaff.Name, toStaff.UID, user.Name, user.UID, result.Customers, result.LoansAsLO, result.LoansAsCO, reason)
+	utils.LogEvent("o_users", fromStaff.UID, details, user.UID)
+	utils.LogEvent("o_users", toStaff.UID, details, user.UID)
+
+	c.JSON(200, gin.H{"message": "Portfolio transferred successfully", "data": result})
+}
@@ -1,10 +1,19 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 	"super-lender/inits"
 	"super-lender/models"
+	"super-lender/schemas"
+	customTypes "super-lender/types"
+	"super-lender/utils"
 	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
 )
 
 // create a function named ValidateToken that takes token as a parameter and returns a boolean
@@ -12,7 +21,7 @@ func ValidateToken(token string) int {
 	var tokenCount int64
 	expiryDate := time.Now()
 
-	result := inits.CurrentDB.Model(&models.OToken{}).Where("token = ? AND expiry_date > ?", token, expiryDate).Count(&tokenCount)
+	result := inits.CurrentDB.Model(&models.OToken{}).Where("token = ? AND status = ? AND expiry_date > ?", utils.Sha256Hash(token), models.ValidToken, expiryDate).Count(&tokenCount)
 
 	if result.Error != nil {
 		fmt.Println("Error validating token: ", result.Error)
@@ -25,3 +34,166 @@ func ValidateToken(token string) int {
 		return 0
 	}
 }
+
+func ListSessions(c *gin.Context) {
+
+	// set result schema
+	var sessionsResult []schemas.SessionSchema
+
+	// Get user and current session
+	user := c.MustGet("user").(models.OUser)
+	currentSession := c.MustGet("session").(models.OToken)
+
+	// build query
+	query := inits.CurrentDB.Table("o_tokens t")
+	query = query.Select("t.uid, t.device_id, t.browser_name, t.ip_address, t.os, DATE_FORMAT(t.creation_date, '%Y-%m-%d %H:%i:%s') AS creation_date, IFNULL(DATE_FORMAT(t.last_used, '%Y-%m-%d %H:%i:%s'), '') AS last_used, DATE_FORMAT(t.expiry_date, '%Y-%m-%d %H:%i:%s') AS expiry_date")
+	query = query.Where("t.user_id = ? AND t.status = ? AND t.expiry_date > ?", user.UID, models.ValidToken, time.Now())
+	query = query.Order("t.uid DESC")
+
+	// execute query
+	if err := query.Scan(&sessionsResult).Error; err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	for i := range sessionsResult {
+		sessionsResult[i].Current = sessionsResult[i].UID == currentSession.UID
+	}
+
+	c.JSON(200, gin.H{"data": sessionsResult})
+}
+
+func RevokeSession(c *gin.Context) {
+
+	// Fetch query parameters from /users/sessions/:id
+	sessionID := utils.PathParamToIntWithDefault(c, "id", 0)
+	if sessionID <= 0 {
+		c.JSON(400, gin.H{"error": "Invalid session id"})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	if err := utils.RevokeSession(uint(sessionID), user.UID); err != nil {
+		if errors.Is(err, utils.ErrInvalidSession) {
+			c.JSON(404, gin.H{"error": "Session not found"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Error revoking session"})
+		return
+	}
+
+	utils.LogEvent("o_users", user.UID, fmt.Sprintf("Session %d revoked by %s(%d)", sessionID, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"data": "Session revoked successfully"})
+}
+
+func RevokeAllSessions(c *gin.Context) {
+
+	// Get user and current session
+	user := c.MustGet("user").(models.OUser)
+	currentSession := c.MustGet("session").(models.OToken)
+
+	// keep the current session unless ?includeCurrent=1
+	exceptSessionID := currentSession.UID
+	if utils.QueryParamToIntWithDefault(c, "includeCurrent", 0) == 1 {
+		exceptSessionID = 0
+	}
+
+	revoked, err := utils.RevokeUserSessions(user.UID, exceptSessionID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error revoking sessions"})
+		return
+	}
+
+	utils.LogEvent("o_users", user.UID, fmt.Sprintf("%d session(s) revoked by %s(%d) from all devices", revoked, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"data": "Sessions revoked successfully", "revoked": revoked})
+}
+
+func RevokeUserSessions(c *gin.Context) {
+
+	// Fetch query parameters from /users/:uid/sessions
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid user id"})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	// make sure the staff member exists
+	var staff models.OUser
+	if err := inits.CurrentDB.First(&staff, uid).Error; err != nil {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+
+	revoked, err := utils.RevokeUserSessions(staff.UID, 0)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error revoking sessions"})
+		return
+	}
+
+	utils.LogEvent("o_users", staff.UID, fmt.Sprintf("All %d session(s) of %s(%d) revoked by %s(%d)", revoked, staff.Name, staff.UID, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"data": "Sessions revoked successfully", "revoked": revoked})
+}
+
+// CreateReadOnlyToken starts a separate read-only session on live data, for reporting users and integrations.
+// The session is listed and revoked like any other.
+func CreateReadOnlyToken(c *gin.Context) {
+
+	// set necessary variables
+	var tokenInput schemas.ReadOnlyTokenSchema
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&tokenInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	ttl := utils.RefreshTokenTTL()
+	if tokenInput.TTLDays > 0 {
+		ttl = time.Duration(tokenInput.TTLDays) * 24 * time.Hour
+	}
+
+	scope := []string{utils.CurrentDBScope, utils.ReadScope}
+	session, refreshToken, err := utils.CreateSession(c, user, scope, ttl)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error creating session"})
+		return
+	}
+
+	// the name identifies the session in /users/sessions
+	session.DeviceID = utils.TruncateString(strings.TrimSpace(tokenInput.Name), 245)
+	if err := inits.CurrentDB.Model(&models.OToken{}).Where("uid = ?", session.UID).Update("device_id", session.DeviceID).Error; err != nil {
+		fmt.Println("Error naming session:", err)
+	}
+
+	tokenString, err := utils.IssueAccessToken(user.UID, session.UID, scope)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error issuing token"})
+		return
+	}
+
+	utils.LogEvent("o_users", user.UID, fmt.Sprintf("Read-only token %s (session %d) created by %s(%d)", session.DeviceID, session.UID, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"data": gin.H{"token": utils.BuildTokenResponse(session, tokenString, refreshToken)}})
+}
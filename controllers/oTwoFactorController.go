@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	customTypes "super-lender/types"
+	"super-lender/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+func VerifyLoginChallenge(c *gin.Context) {
+
+	// set necessary variables
+	var verifyInput schemas.TwoFactorVerifySchema
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&verifyInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// refuse early while this IP is locked out
+	if lockedUntil, locked := utils.CheckLoginLocks(c, models.OUser{}); locked {
+		utils.RecordLoginAttempt(c, 0, "", models.LockedLogin, "ip locked")
+		c.JSON(429, gin.H{"error": utils.LoginLockedMessage(lockedUntil)})
+		return
+	}
+
+	user, err := utils.VerifyLoginChallenge(verifyInput.ChallengeToken, verifyInput.Code)
+	if err != nil {
+		if errors.Is(err, utils.ErrInvalidChallenge) {
+			c.JSON(401, gin.H{"error": "Login has expired, please log in again"})
+			return
+		}
+		if errors.Is(err, utils.ErrInvalidTwoFactorCode) {
+			utils.FailLogin(c, user, user.Email, "invalid two-factor code")
+			c.JSON(401, gin.H{"error": "Invalid verification code"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Error verifying code"})
+		return
+	}
+
+	// the account may have been locked while the challenge was pending
+	if lockedUntil, locked := utils.CheckLoginLocks(c, user); locked {
+		utils.RecordLoginAttempt(c, user.UID, user.Email, models.LockedLogin, "account locked")
+		c.JSON(429, gin.H{"error": utils.LoginLockedMessage(lockedUntil)})
+		return
+	}
+
+	completeLogin(c, user, user.Email, "two-factor")
+}
+
+func GetTwoFactorStatus(c *gin.Context) {
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	twoFactor, ok := utils.GetTwoFactor(user.UID)
+	enabled := ok && twoFactor.Enabled == 1
+
+	response := gin.H{
+		"enabled":           enabled,
+		"requiredByGroup":   utils.IsTwoFactorRequiredByGroup(user),
+		"method":            "",
+		"recoveryCodesLeft": 0,
+	}
+	if enabled {
+		response["method"] = twoFactor.Method
+		response["recoveryCodesLeft"] = utils.CountRecoveryCodes(twoFactor)
+	}
+
+	c.JSON(200, gin.H{"data": response})
+}
+
+func SetupTwoFactor(c *gin.Context) {
+
+	// set necessary variables
+	var setupInput schemas.TwoFactorSetupSchema
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&setupInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	twoFactor, ok := utils.GetTwoFactor(user.UID)
+	if ok && twoFactor.Enabled == 1 {
+		c.JSON(400, gin.H{"error": "Two-factor authentication is already enabled, disable it first"})
+		return
+	}
+
+	// the factor stays disabled until a code is confirmed at /users/2fa/enable
+	method := models.TwoFactorMethod(setupInput.Method)
+	twoFactor.UserID = user.UID
+	twoFactor.Method = method
+	twoFactor.Enabled = 0
+	twoFactor.LastUsedStep = 0
+	setupExpiry := time.Now().Add(utils.TwoFactorSetupTTL)
+	twoFactor.SetupExpiry = &setupExpiry
+	twoFactor.SetupAttempts = 0
+
+	response := gin.H{"method": method}
+	var code string
+	if method == models.TOTPTwoFactor {
+		twoFactor.Secret = utils.GenerateTOTPSecret()
+
+		issuer := utils.CompanySettings()["Name"]
+		if issuer == "" {
+			issuer = os.Getenv("APP_NAME")
+		}
+		response["secret"] = twoFactor.Secret
+		response["otpauthUrl"] = utils.TOTPProvisioningURI(twoFactor.Secret, user.Email, issuer)
+	} else {
+		code = utils.SecureRandomNumber(6)
+		twoFactor.Secret = utils.Sha256Hash(code)
+	}
+
+	if err := inits.CurrentDB.Save(&twoFactor).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error setting up two-factor authentication"})
+		return
+	}
+
+	if code != "" {
+		if err := utils.SendOTP(user, method, code); err != nil {
+			fmt.Println("Error sending verification code:", err)
+			c.JSON(500, gin.H{"error": "Error sending verification code"})
+			return
+		}
+	}
+
+	c.JSON(200, gin.H{"data": response})
+}
+
+func EnableTwoFactor(c *gin.Context) {
+
+	// set necessary variables
+	var codeInput schemas.TwoFactorCodeSchema
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&codeInput); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Code is required"})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	twoFactor, ok := utils.GetTwoFactor(user.UID)
+	if !ok || twoFactor.Enabled == 1 {
+		c.JSON(400, gin.H{"error": "No pending two-factor setup"})
+		return
+	}
+
+	if err := utils.ConfirmTwoFactorSetup(twoFactor, codeInput.Code); err != nil {
+		if errors.Is(err, utils.ErrTwoFactorSetupExpired) {
+			c.JSON(400, gin.H{"error": "Two-factor setup has expired or too many invalid codes were entered, start the setup again"})
+			return
+		}
+		c.JSON(401, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	updates := map[string]interface{}{"enabled": 1, "setup_expiry": nil, "setup_attempts": 0}
+	if twoFactor.Method != models.TOTPTwoFactor {
+		// the enrolment code is single use
+		updates["secret"] = ""
+	}
+
+	if err := inits.CurrentDB.Model(&models.OUserTwoFactor{}).Where("uid = ?", twoFactor.UID).Updates(updates).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error enabling two-factor authentication"})
+		return
+	}
+
+	recoveryCodes, err := utils.GenerateRecoveryCodes(user.UID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error generating recovery codes"})
+		return
+	}
+
+	utils.LogEvent("o_users", user.UID, fmt.Sprintf("Two-factor authentication (%s) enabled by %s(%d)", twoFactor.Method, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"data": gin.H{"message": "Two-factor authentication enabled", "recoveryCodes": recoveryCodes}})
+}
+
+func DisableTwoFactor(c *gin.Context) {
+
+	// set necessary variables
+	var passwordInput schemas.TwoFactorPasswordSchema
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&passwordInput); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Password is required"})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	if !utils.CheckPassword(user, passwordInput.Password) {
+		c.JSON(401, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	if err := inits.CurrentDB.Where("user_id = ?", user.UID).Delete(&models.OUserTwoFactor{}).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error disabling two-factor authentication"})
+		return
+	}
+
+	utils.LogEvent("o_users", user.UID, fmt.Sprintf("Two-factor authentication disabled by %s(%d)", user.Name, user.UID), user.UID)
+
+	message := "Two-factor authentication disabled"
+	if utils.IsTwoFactorRequiredByGroup(user) {
+		message += ", your user group still requires an SMS code at login"
+	}
+
+	c.JSON(200, gin.H{"data": message})
+}
+
+func RegenerateRecoveryCodes(c *gin.Context) {
+
+	// set necessary variables
+	var passwordInput schemas.TwoFactorPasswordSchema
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&passwordInput); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Password is required"})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	if !utils.CheckPassword(user, passwordInput.Password) {
+		c.JSON(401, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	twoFactor, ok := utils.GetTwoFactor(user.UID)
+	if !ok || twoFactor.Enabled != 1 {
+		c.JSON(400, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	recoveryCodes, err := utils.GenerateRecoveryCodes(user.UID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error generating recovery codes"})
+		return
+	}
+
+	utils.LogEvent("o_users", user.UID, fmt.Sprintf("Recovery codes regenerated by %s(%d)", user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"data": gin.H{"recoveryCodes": recoveryCodes}})
+}
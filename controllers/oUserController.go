@@ -1,7 +1,6 @@
 package controllers
 
 import (
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
@@ -17,14 +16,13 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
-	"github.com/golang-jwt/jwt"
-	"golang.org/x/crypto/bcrypt"
-	"golang.org/x/crypto/sha3"
 )
 
+// Signup registers a staff member as pending, they can't log in or do anything until an admin approves them
+// at /users/:uid/approve and assigns their group and branches
 func Signup(c *gin.Context) {
 	// set necessary variables
-	var userSignupInput models.OUser
+	var userSignupInput schemas.UserSignupSchema
 
 	// bind request body to schema
 	if err := c.ShouldBindJSON(&userSignupInput); err != nil {
@@ -113,8 +111,7 @@ func Signup(c *gin.Context) {
 	/// ==== end of name validation
 
 	/// ==== password validation
-	password := strings.TrimSpace(userSignupInput.Pass1)
-	userSignupInput.Pass1 = password
+	password := strings.TrimSpace(userSignupInput.Password)
 	// validate password length
 	if len(password) < 6 {
 		c.JSON(400, gin.H{"error": "Password must be at least 6 characters"})
@@ -123,39 +120,41 @@ func Signup(c *gin.Context) {
 
 	//// ==== end of password validation
 
-	///==== validate user group
-
-	if userSignupInput.UserGroup < 1 {
-		c.JSON(400, gin.H{"error": "User group is required"})
-		return
-
-	}
-
-	////=== end of user group validation
-
 	///// ==== hash password
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+	hash, err := utils.HashPassword(password)
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Error hashing password"})
 		return
 	}
 
-	userSignupInput.Pass1 = string(hash)
-	userSignupInput.JoinDate = time.Now().Local()
 	companyId, err := strconv.Atoi(os.Getenv("COMPANY_ID"))
 	if err != nil {
 		// provide a default company id as 1
 		companyId = 1
 	}
-	userSignupInput.Company = companyId
 
-	result = inits.CurrentDB.Create(&userSignupInput)
+	// no group and no branch means no permissions until approval
+	newUser := models.OUser{
+		Name:        name,
+		Email:       email,
+		Phone:       phone,
+		NationalID:  nationalId,
+		Pass1:       hash,
+		JoinDate:    time.Now().Local(),
+		Company:     companyId,
+		Status:      models.PendingUser,
+		AccountType: models.StaffAccount,
+	}
+
+	result = inits.CurrentDB.Create(&newUser)
 	if result.Error != nil {
 		c.JSON(500, gin.H{"error": result.Error.Error()})
 		return
 	}
 
-	c.JSON(200, gin.H{"data": "User created successfully", "uid": userSignupInput.UID})
+	utils.LogEvent("o_users", newUser.UID, fmt.Sprintf("%s(%d) signed up from %s and is pending approval", newUser.Name, newUser.UID, c.ClientIP()), newUser.UID)
+
+	c.JSON(200, gin.H{"data": "Signup received, your account is pending approval", "uid": newUser.UID})
 }
 
 func Login(c *gin.Context) {
@@ -186,23 +185,33 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// refuse early while this IP is locked out
+	if lockedUntil, locked := utils.CheckLoginLocks(c, user); locked {
+		utils.RecordLoginAttempt(c, 0, username, models.LockedLogin, "ip locked")
+		c.JSON(429, gin.H{"error": utils.LoginLockedMessage(lockedUntil)})
+		return
+	}
+
 	// check if username is email or phone
 	isEmail := utils.IsValidEmail(username)
 	if !isEmail {
 		phone := utils.MakePhoneValid(username)
 		if !utils.IsPhoneValid(phone) {
+			utils.FailLogin(c, user, username, "invalid username")
 			c.JSON(400, gin.H{"error": "Invalid username or password"})
 			return
 		}
 
 		result := inits.CurrentDB.Where("phone = ?", phone).First(&user)
 		if result.Error != nil {
+			utils.FailLogin(c, user, username, "unknown user")
 			c.JSON(500, gin.H{"error": "Invalid username or password"})
 			return
 		}
 	} else {
 		result := inits.CurrentDB.Where("email = ?", username).First(&user)
 		if result.Error != nil {
+			utils.FailLogin(c, user, username, "unknown user")
 			c.JSON(500, gin.H{"error": "Invalid username or password"})
 			return
 		}
@@ -211,52 +220,107 @@ func Login(c *gin.Context) {
 
 	/// === end of username validation
 
+	// service accounts only authenticate with api keys
+	if user.AccountType == models.ServiceAccount {
+		utils.FailLogin(c, user, username, "service account")
+		c.JSON(401, gin.H{"error": "Invalid username or password"})
+		return
+	}
+
+	// a locked account is refused before its password is checked
+	if lockedUntil, locked := utils.CheckLoginLocks(c, user); locked {
+		utils.RecordLoginAttempt(c, user.UID, username, models.LockedLogin, "account locked")
+		c.JSON(429, gin.H{"error": utils.LoginLockedMessage(lockedUntil)})
+		return
+	}
+
 	/// === validate password
 
 	password := strings.TrimSpace(userLoginInput.Password)
 	if password == "" {
 		c.JSON(400, gin.H{"error": "Password is required"})
+		return
 	}
 
-	err := bcrypt.CompareHashAndPassword([]byte(user.Pass1), []byte(password))
-
-	if err != nil {
-		fmt.Printf("Error comparing password: %v\n", err)
+	// accepts bcrypt, argon2id and the old system's salted sha3 hashes
+	passwordOk, needsRehash := utils.VerifyPassword(user, password)
+	if !passwordOk {
+		utils.FailLogin(c, user, username, "invalid password")
 		c.JSON(401, gin.H{"error": "Invalid username or password"})
 		return
 	}
 
+	// only approved, activated accounts may log in, this is checked after the password so it doesn't reveal accounts
+	if user.Status != models.Active {
+		reason, message := "inactive account", "Your account is not active"
+		switch user.Status {
+		case models.PendingUser:
+			reason, message = "pending approval", "Your account is pending approval"
+		case models.InvitedUser:
+			reason, message = "not activated", "Activate your account from your invitation first"
+		}
+		utils.RecordLoginAttempt(c, user.UID, username, models.FailedLogin, reason)
+		c.JSON(403, gin.H{"error": message})
+		return
+	}
+
+	// upgrade legacy hashes now that we have the plain password
+	if needsRehash {
+		previousFormat := utils.HashFormat(user.Pass1)
+		if err := utils.UpdatePassword(user, password); err != nil {
+			fmt.Println("Error upgrading password hash:", err)
+		} else {
+			utils.LogEvent("o_users", user.UID, fmt.Sprintf("Password hash of %s(%d) upgraded from %s on login", user.Name, user.UID, previousFormat), user.UID)
+		}
+	}
+
 	/// === end of password validation
 
-	// === begin generate jwt token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"uid":   user.UID,
-		"scope": []string{"current", "read", "write"},
-		"exp":   time.Now().Add(time.Hour * 24 * 30).Unix(),
-	})
+	// === second factor, no token is issued until it is verified at /users/login/verify
+	if utils.IsTwoFactorRequired(user) {
+		challengeToken, method, err := utils.StartLoginChallenge(user)
+		if err != nil {
+			fmt.Println("Error starting login challenge:", err)
+			c.JSON(500, gin.H{"error": "Error sending verification code"})
+			return
+		}
+
+		c.JSON(200, gin.H{"data": gin.H{"twoFactorPending": true, "challengeToken": challengeToken, "method": method}})
+		return
+	}
+
+	completeLogin(c, user, username, "password")
 
-	// token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-	// 	"uid": user.UID,
-	// 	"scope": map[string]interface{}{
-	// 		"db": "current",
-	// 		"op": []string{"read", "write"},
-	// 	},
-	// 	"exp": time.Now().Add(time.Hour * 24 * 30).Unix(),
-	// })
+	// // ctx.JSON(200, gin.H{"token": tokenString})
+	// ctx.SetSameSite(http.SameSiteLaxMode)
+	// ctx.SetCookie("Authorization", tokenString, 3600*24*30, "", "localhost", false, true)
+	// ctx.SetCookie("db", "current", 3600*24*30, "", "localhost", false, true)
+}
 
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+// completeLogin creates the session and responds with the user and their tokens,
+// it clears the user's failed login counters and records the login in the history
+func completeLogin(c *gin.Context, user models.OUser, username string, reason string) {
 
+	// === begin create session and generate jwt token
+	scope := []string{"current", "read", "write"}
+	session, refreshToken, err := utils.CreateSession(c, user, scope, utils.RefreshTokenTTL())
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error creating session"})
+		return
+	}
+
+	tokenString, err := utils.IssueAccessToken(user.UID, session.UID, scope)
 	if err != nil {
 		c.JSON(500, gin.H{"error": err})
 		return
 	}
 
-	tokenResponse := schemas.UserTokenSchema{
-		Token:     tokenString,
-		ExpiresIn: 3600 * 24 * 30,
-		TokenType: "Bearer",
-		Scope:     []string{"current", "read", "write"},
+	tokenResponse := utils.BuildTokenResponse(session, tokenString, refreshToken)
+
+	if _, err := utils.ClearLoginLock(utils.UserLoginSubject(user.UID)); err != nil {
+		fmt.Println("Error clearing failed logins:", err)
 	}
+	utils.RecordLoginAttempt(c, user.UID, username, models.SuccessfulLogin, reason)
 
 	// call GetUserGroupName function to get user group name
 	userGroup := utils.GetUserGroupName(user.UserGroup, int(models.Active))
@@ -269,12 +333,7 @@ func Login(c *gin.Context) {
 		UserGroup: userGroup,
 	}
 
-	c.JSON(200, gin.H{"data": gin.H{"user": userResponse, "token": tokenResponse}})
-
-	// // ctx.JSON(200, gin.H{"token": tokenString})
-	// ctx.SetSameSite(http.SameSiteLaxMode)
-	// ctx.SetCookie("Authorization", tokenString, 3600*24*30, "", "localhost", false, true)
-	// ctx.SetCookie("db", "current", 3600*24*30, "", "localhost", false, true)
+	c.JSON(200, gin.H{"data": gin.H{"twoFactorPending": false, "user": userResponse, "token": tokenResponse}})
 }
 
 func FindManyUsers(c *gin.Context) {
@@ -298,6 +357,12 @@ func FindManyUsers(c *gin.Context) {
 	// build select query
 	selectQuery := utils.FindManyUsersQueryBuilder(db, userGroup, branch, status, searchTerm, "select")
 	selectQuery = selectQuery.Order(orderBy + " " + dir)
+
+	// format=csv|xlsx streams every matching user instead of a page
+	if isListExport(c) {
+		exportList(c, "o_users", "users", selectQuery)
+		return
+	}
 	selectQuery = selectQuery.Offset((pageNo - 1) * pageSize).Limit(pageSize)
 
 	err := selectQuery.Scan(&userResultSchema).Error
@@ -404,6 +469,14 @@ func ValidateUser(ctx *gin.Context) {
 }
 
 func Logout(ctx *gin.Context) {
+	// revoke the session the bearer token belongs to
+	user := ctx.MustGet("user").(models.OUser)
+	session := ctx.MustGet("session").(models.OToken)
+	if err := utils.RevokeSession(session.UID, user.UID); err != nil && !errors.Is(err, utils.ErrInvalidSession) {
+		ctx.JSON(500, gin.H{"error": "Error logging out"})
+		return
+	}
+
 	ctx.SetSameSite(http.SameSiteLaxMode)
 	ctx.SetCookie("Authorization", "", -1, "", "localhost", false, true)
 	ctx.JSON(200, gin.H{"data": "You are logged out!"})
@@ -435,27 +508,31 @@ func SwitchDB(ctx *gin.Context) {
 	// }
 
 	db := Db.DbType
-	fmt.Println("DB Type:", db)
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"uid":   user.(models.OUser).UID,
-		"scope": []string{db, "read", "write"},
-		"exp":   time.Now().Add(time.Hour * 24 * 30).Unix(),
-	})
+	if db != utils.CurrentDBScope && db != utils.ArchiveDBScope {
+		ctx.JSON(400, gin.H{"error": "db_type must be current or archive"})
+		return
+	}
+	if db == utils.ArchiveDBScope && os.Getenv("ARCHIVE") != "1" {
+		ctx.JSON(400, gin.H{"error": "Archived data is not available"})
+		return
+	}
 
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	// reissue the access token on the current session with the new db scope, archive tokens are read-only
+	session := ctx.MustGet("session").(models.OToken)
+	scope, err := utils.SwitchSessionDB(session, db)
+	if err != nil {
+		ctx.JSON(500, gin.H{"error": "Error updating session"})
+		return
+	}
+	session.Scope = strings.Join(scope, ",")
 
+	tokenString, err := utils.IssueAccessToken(user.(models.OUser).UID, session.UID, scope)
 	if err != nil {
 		ctx.JSON(500, gin.H{"error": err})
 		return
 	}
 
-	tokenResponse := schemas.UserTokenSchema{
-		Token:     tokenString,
-		ExpiresIn: 3600 * 24 * 30,
-		TokenType: "Bearer",
-		Scope:     []string{"current", "read", "write"},
-	}
+	tokenResponse := utils.BuildTokenResponse(session, tokenString, "")
 
 	// userResponse := UserResponse{
 	// 	Uid:       user.(models.OUser).UID,
@@ -470,147 +547,213 @@ func SwitchDB(ctx *gin.Context) {
 		message = "You are now viewing archived data"
 	}
 
-	ctx.JSON(200, gin.H{"data": gin.H{"token": tokenResponse, message: message}})
+	ctx.JSON(200, gin.H{"data": gin.H{"token": tokenResponse, "message": message}})
 }
 
-func Login2(ctx *gin.Context) {
-	var LoginBody struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+func RefreshToken(c *gin.Context) {
+
+	// set necessary variables
+	var refreshTokenInput schemas.RefreshTokenSchema
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&refreshTokenInput); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Refresh token is required"})
+		return
 	}
 
-	if err := ctx.ShouldBindJSON(&LoginBody); err != nil {
-		fmt.Println("Error binding JSON:", err)
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Bad request"})
+	// rotate the refresh token
+	session, refreshToken, err := utils.RefreshSession(strings.TrimSpace(refreshTokenInput.RefreshToken))
+	if err != nil {
+		if errors.Is(err, utils.ErrRefreshTokenReused) {
+			utils.LogEvent("o_users", session.UserID, fmt.Sprintf("Session %d revoked, a refresh token that was already used was presented from %s", session.UID, c.ClientIP()), session.UserID)
+			c.JSON(401, gin.H{"error": "Invalid or expired refresh token"})
+			return
+		}
+		if errors.Is(err, utils.ErrInvalidSession) {
+			c.JSON(401, gin.H{"error": "Invalid or expired refresh token"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Error refreshing session"})
 		return
 	}
 
+	// only active users keep their sessions, blocked or deleted ones lose them here
 	var user models.OUser
-	result := inits.CurrentDB.Where("email = ?", LoginBody.Email).First(&user)
-
-	if result.Error != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": result.Error})
+	if err := inits.CurrentDB.First(&user, session.UserID).Error; err != nil || user.Status != models.Active {
+		if err := utils.RevokeSession(session.UID, session.UserID); err != nil && !errors.Is(err, utils.ErrInvalidSession) {
+			fmt.Println("Error revoking session:", err)
+		}
+		c.JSON(401, gin.H{"error": "Invalid or expired refresh token"})
 		return
 	}
 
-	// Fetch the salt from the database for the user
-	// Here you should have a function to fetch the salt based on the user's ID
-
-	fmt.Println("UserID", user.UID)
-
-	salt := fetchSaltFromDB(user.UID)
+	tokenString, err := utils.IssueAccessToken(user.UID, session.UID, utils.SessionScope(session))
+	if err != nil {
+		c.JSON(500, gin.H{"error": err})
+		return
+	}
 
-	fmt.Println("Salt:", salt)
+	c.JSON(200, gin.H{"data": gin.H{"token": utils.BuildTokenResponse(session, tokenString, refreshToken)}})
+}
 
-	// Append salt to the input password
-	fullPassword := salt + LoginBody.Password
+func ChangePassword(c *gin.Context) {
 
-	fmt.Println("Full Password:", fullPassword)
+	// set necessary variables
+	var changePasswordInput schemas.ChangePasswordSchema
 
-	// Hash the password with SHA256
-	hashedPassword := sha256Hash(fullPassword)
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&changePasswordInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	fmt.Println("Input User Hashed Password:", hashedPassword)
-	fmt.Println("DB User Hashed Password:", user.Pass1)
+	// Get user and current session
+	user := c.MustGet("user").(models.OUser)
+	session := c.MustGet("session").(models.OToken)
 
-	// Compare hashed passwords
-	if user.Pass1 != hashedPassword {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	// Compare the old password
+	if !utils.CheckPassword(user, changePasswordInput.OldPassword) {
+		c.JSON(401, gin.H{"error": "Invalid password"})
 		return
 	}
 
-	// Generate JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"uid": user.UID,
-		"exp": time.Now().Add(time.Hour * 24 * 30).Unix(),
-	})
-
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	// Update the user's password
+	if err := utils.UpdatePassword(user, strings.TrimSpace(changePasswordInput.NewPassword)); err != nil {
+		c.JSON(500, gin.H{"error": "Error updating password"})
+		return
+	}
 
+	// log out every other device
+	revoked, err := utils.RevokeUserSessions(user.UID, session.UID)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err})
-		return
+		fmt.Println("Error revoking sessions:", err)
 	}
 
-	// Set JWT token as a cookie
-	ctx.SetSameSite(http.SameSiteLaxMode)
-	ctx.SetCookie("Authorization", tokenString, 3600*24*30, "", "localhost", false, true)
+	utils.LogEvent("o_users", user.UID, fmt.Sprintf("Password changed by %s(%d), %d other session(s) revoked", user.Name, user.UID, revoked), user.UID)
+
+	c.JSON(200, gin.H{"data": "Password updated successfully"})
 }
 
-// Fetch the salt for the user from the database
-func fetchSaltFromDB(userID int) string {
-	var pass models.OPass
+func ForgotPassword(c *gin.Context) {
+
+	// set necessary variables
+	var forgotPasswordInput schemas.ForgotPasswordSchema
 
-	// Execute the query using GORM's methods
-	if err := inits.CurrentDB.Where("user = ?", userID).Select("pass").First(&pass).Error; err != nil {
-		return ""
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&forgotPasswordInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	return pass.Pass
-}
+	// the response is the same whether or not the account exists so emails and phones can't be enumerated
+	response := gin.H{"data": "If the account exists, a reset code has been sent"}
 
-// SHA256 hashing function
-func sha256Hash(input string) string {
-	h := sha3.New256()
-	h.Write([]byte(input))
-	return hex.EncodeToString(h.Sum(nil))
-}
+	user, err := utils.FindUserByEmailOrPhone(forgotPasswordInput.EmailOrPhone)
+	if err != nil || user.Status != models.Active || user.AccountType == models.ServiceAccount {
+		c.JSON(200, response)
+		return
+	}
 
-func ChangePassword(c *gin.Context) {
-	var changePassword struct {
-		Email       string `json:"email"`
-		OldPassword string `json:"old_password"`
-		NewPassword string `json:"new_password"`
+	channel := forgotPasswordInput.Channel
+	if channel == "" {
+		channel = "sms"
 	}
 
-	if err := c.ShouldBindJSON(&changePassword); err != nil {
-		fmt.Println("Error binding JSON:", err)
-		c.JSON(400, gin.H{"error": "Bad request"})
+	token, expiry, err := utils.CreatePasswordResetToken(user)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error creating reset token"})
 		return
 	}
 
-	// // Retrieve the user from the context
-	// user, exists := c.Get("user")
-	// if !exists {
-	// 	c.JSON(401, gin.H{"error": "Unauthorized"})
-	// 	return
-	// }
+	if err := utils.SendPasswordResetToken(user, channel, token, expiry); err != nil {
+		fmt.Println("Error sending reset token:", err)
+		c.JSON(500, gin.H{"error": "Error sending reset code"})
+		return
+	}
 
-	// // Convert the user interface to User type
-	// userObj, ok := user.(models.OUser)
-	// if !ok {
-	// 	c.JSON(500, gin.H{"error": "Invalid user object type"})
-	// 	return
-	// }
+	utils.LogEvent("o_users", user.UID, fmt.Sprintf("Password reset requested via %s from %s", channel, c.ClientIP()), user.UID)
 
-	// Fetch the user from the database
-	var dbUser models.OUser
-	result := inits.CurrentDB.Where("email = ?", changePassword.Email).First(&dbUser)
-	if result.Error != nil {
-		c.JSON(500, gin.H{"error": "Error fetching user"})
+	c.JSON(200, response)
+}
+
+func ResetPassword(c *gin.Context) {
+
+	// set necessary variables
+	var resetPasswordInput schemas.ResetPasswordSchema
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&resetPasswordInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// // Compare the old password
-	// err := bcrypt.CompareHashAndPassword([]byte(dbUser.Pass1), []byte(changePassword.OldPassword))
-	// if err != nil {
-	// 	c.JSON(401, gin.H{"error": "Invalid password"})
-	// 	return
-	// }
-
-	// Hash the new password
-	hash, err := bcrypt.GenerateFromPassword([]byte(changePassword.NewPassword), 10)
+	user, err := utils.FindUserByEmailOrPhone(resetPasswordInput.EmailOrPhone)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Error hashing password"})
+		c.JSON(400, gin.H{"error": "Invalid or expired reset code"})
 		return
 	}
 
-	// Update the user's password
-	result = inits.CurrentDB.Model(&dbUser).Update("pass1", string(hash))
-	if result.Error != nil {
+	if err := utils.ConsumePasswordResetToken(user, strings.TrimSpace(resetPasswordInput.Token)); err != nil {
+		if errors.Is(err, utils.ErrInvalidResetToken) {
+			c.JSON(400, gin.H{"error": "Invalid or expired reset code"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Error verifying reset code"})
+		return
+	}
+
+	if err := utils.UpdatePassword(user, strings.TrimSpace(resetPasswordInput.NewPassword)); err != nil {
 		c.JSON(500, gin.H{"error": "Error updating password"})
 		return
 	}
 
-	c.JSON(200, gin.H{"data": "Password updated successfully"})
+	// a reset means the old password may be compromised, log out everywhere
+	revoked, err := utils.RevokeUserSessions(user.UID, 0)
+	if err != nil {
+		fmt.Println("Error revoking sessions:", err)
+	}
+
+	utils.LogEvent("o_users", user.UID, fmt.Sprintf("Password reset with one-time code from %s, %d session(s) revoked", c.ClientIP(), revoked), user.UID)
+
+	c.JSON(200, gin.H{"data": "Password reset successfully"})
+}
+
+func PasswordHashReport(c *gin.Context) {
+
+	counts, err := utils.CountPasswordHashFormats()
+	if err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": counts})
 }
@@ -0,0 +1,257 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	customTypes "super-lender/types"
+	"super-lender/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+func FindManyUserGroups(c *gin.Context) {
+
+	// set result schema
+	var userGroupsResult []schemas.UserGroupSchema
+
+	// Fetch query parameters
+	status := utils.QueryParamToIntWithDefault(c, "status", 1)
+
+	// build query
+	query := inits.CurrentDB.Table("o_user_groups ug")
+	query = query.Select("ug.uid, ug.name, ug.description, ug.kpi_measured, ug.require_2fa, ug.status, (SELECT COUNT(u.uid) FROM o_users u WHERE u.user_group = ug.uid AND u.status != ?) AS users", models.Delete)
+	if status >= 0 {
+		query = query.Where("ug.status = ?", status)
+	}
+	query = query.Order("ug.name ASC")
+
+	// execute query
+	if err := query.Scan(&userGroupsResult).Error; err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": userGroupsResult})
+}
+
+func FindUserGroupByID(c *gin.Context) {
+
+	// Fetch query parameters from /user-groups/:uid
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid user group id"})
+		return
+	}
+
+	var userGroup models.OUserGroup
+	if err := inits.CurrentDB.First(&userGroup, uid).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": "User group not found"})
+			return
+		}
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": userGroup})
+}
+
+func CreateUserGroup(c *gin.Context) {
+
+	// set necessary variables
+	var userGroupInput schemas.UserGroupInputSchema
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&userGroupInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	userGroup := models.OUserGroup{
+		Name:        strings.TrimSpace(userGroupInput.Name),
+		Description: strings.TrimSpace(userGroupInput.Description),
+		KPIMeasured: 1,
+		Status:      1,
+	}
+	if userGroupInput.KPIMeasured != nil {
+		userGroup.KPIMeasured = *userGroupInput.KPIMeasured
+	}
+	if userGroupInput.Require2FA != nil {
+		userGroup.Require2FA = *userGroupInput.Require2FA
+	}
+
+	// group names must be unique among active groups
+	var count int64
+	inits.CurrentDB.Model(&models.OUserGroup{}).Where("name = ? AND status = 1", userGroup.Name).Count(&count)
+	if count > 0 {
+		c.JSON(400, gin.H{"error": "User group already exists"})
+		return
+	}
+
+	if err := inits.CurrentDB.Create(&userGroup).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error creating user group"})
+		return
+	}
+
+	utils.LogEvent("o_user_groups", userGroup.UID, fmt.Sprintf("User group %s(%d) created by %s(%d)", userGroup.Name, userGroup.UID, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"message": "User group created successfully", "uid": userGroup.UID})
+}
+
+func UpdateUserGroup(c *gin.Context) {
+
+	// set necessary variables
+	var userGroupInput schemas.UserGroupInputSchema
+
+	// Fetch query parameters from /user-groups/:uid
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid user group id"})
+		return
+	}
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&userGroupInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	var existingUserGroup models.OUserGroup
+	if err := inits.CurrentDB.Where("uid = ? AND status = 1", uid).First(&existingUserGroup).Error; err != nil {
+		c.JSON(404, gin.H{"error": "User group not found"})
+		return
+	}
+
+	userGroup := existingUserGroup
+	userGroup.Name = strings.TrimSpace(userGroupInput.Name)
+	userGroup.Description = strings.TrimSpace(userGroupInput.Description)
+	if userGroupInput.KPIMeasured != nil {
+		userGroup.KPIMeasured = *userGroupInput.KPIMeasured
+	}
+	if userGroupInput.Require2FA != nil {
+		userGroup.Require2FA = *userGroupInput.Require2FA
+	}
+
+	var count int64
+	inits.CurrentDB.Model(&models.OUserGroup{}).Where("name = ? AND status = 1 AND uid != ?", userGroup.Name, uid).Count(&count)
+	if count > 0 {
+		c.JSON(400, gin.H{"error": "User group already exists"})
+		return
+	}
+
+	if err := inits.CurrentDB.Save(&userGroup).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error updating user group"})
+		return
+	}
+
+	utils.CreateChangesLog("o_user_groups", "user group", userGroup.UID, userGroup.UID, "Update", existingUserGroup, userGroup, user, []string{"UID", "Status"})
+
+	c.JSON(200, gin.H{"message": "User group updated successfully"})
+}
+
+func DeleteUserGroup(c *gin.Context) {
+
+	// Fetch query parameters from /user-groups/:uid
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid user group id"})
+		return
+	}
+	if uid == utils.AdminUserGroup {
+		c.JSON(400, gin.H{"error": "The admin group cannot be deleted"})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	var userGroup models.OUserGroup
+	if err := inits.CurrentDB.Where("uid = ? AND status = 1", uid).First(&userGroup).Error; err != nil {
+		c.JSON(404, gin.H{"error": "User group not found"})
+		return
+	}
+
+	// staff must be moved to another group first
+	var count int64
+	inits.CurrentDB.Model(&models.OUser{}).Where("user_group = ? AND status != ?", uid, models.Delete).Count(&count)
+	if count > 0 {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("User group still has %d staff member(s)", count)})
+		return
+	}
+
+	if err := inits.CurrentDB.Model(&models.OUserGroup{}).Where("uid = ?", uid).Update("status", 0).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error deleting user group"})
+		return
+	}
+
+	utils.LogEvent("o_user_groups", userGroup.UID, fmt.Sprintf("User group %s(%d) deleted by %s(%d)", userGroup.Name, userGroup.UID, user.Name, user.UID), user.UID)
+
+	c.JSON(200, gin.H{"message": "User group deleted successfully"})
+}
+
+func GetUserGroupPermissions(c *gin.Context) {
+
+	// Fetch query parameters from /user-groups/:uid/permissions
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid user group id"})
+		return
+	}
+
+	var userGroup models.OUserGroup
+	if err := inits.CurrentDB.First(&userGroup, uid).Error; err != nil {
+		c.JSON(404, gin.H{"error": "User group not found"})
+		return
+	}
+
+	matrix, records, err := utils.GetPermissionMatrix(uid)
+	if err != nil {
+		c.JSON(500, gin.H{
+			"message": "Internal Server Error",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": gin.H{
+		"group":   userGroup,
+		"admin":   uid == utils.AdminUserGroup,
+		"actions": utils.PermissionActions,
+		"tables":  matrix,
+		"records": records,
+	}})
+}
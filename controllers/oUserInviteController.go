@@ -0,0 +1,368 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	customTypes "super-lender/types"
+	"super-lender/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// checkStaffAssignment validates the group and branches given to a staff member, only admins may hand out the admin group.
+// It responds itself when they are invalid.
+func checkStaffAssignment(c *gin.Context, userGroup int, branch int, branches []int) (models.OUserGroup, bool) {
+	var group models.OUserGroup
+	if err := inits.CurrentDB.Where("uid = ? AND status = 1", userGroup).First(&group).Error; err != nil {
+		c.JSON(404, gin.H{"error": "User group not found"})
+		return group, false
+	}
+
+	if userGroup == utils.AdminUserGroup && !utils.RequestPermissions(c).Admin {
+		c.JSON(403, gin.H{"status": 403, "message": "Only admins can add staff to the admin group!"})
+		return group, false
+	}
+
+	ids := append([]int{branch}, branches...)
+	var count int64
+	inits.CurrentDB.Model(&models.OBranch{}).Where("uid IN ? AND status = ?", ids, models.ActiveBranch).Count(&count)
+	if int(count) != len(uniqueInts(ids)) {
+		c.JSON(400, gin.H{"error": "Invalid branch"})
+		return group, false
+	}
+
+	return group, true
+}
+
+func uniqueInts(values []int) []int {
+	seen := map[int]bool{}
+	unique := []int{}
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+// findUserWithStatus loads a staff member by the uid path parameter in the given status, it responds itself when there is none
+func findUserWithStatus(c *gin.Context, status models.UserStatus) (models.OUser, bool) {
+	var staff models.OUser
+
+	uid := utils.PathParamToIntWithDefault(c, "uid", 0)
+	if uid == 0 {
+		c.JSON(400, gin.H{"error": "Invalid user id"})
+		return staff, false
+	}
+
+	if err := inits.CurrentDB.Where("uid = ? AND account_type = ?", uid, models.StaffAccount).First(&staff).Error; err != nil {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return staff, false
+	}
+	if staff.Status != status {
+		c.JSON(400, gin.H{"error": "User is not awaiting this action"})
+		return staff, false
+	}
+
+	return staff, true
+}
+
+// ApproveUser activates a pending signup and gives it a group and branches
+func ApproveUser(c *gin.Context) {
+
+	// set necessary variables
+	var approvalInput schemas.UserApprovalSchema
+
+	staff, ok := findUserWithStatus(c, models.PendingUser)
+	if !ok {
+		return
+	}
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&approvalInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group, ok := checkStaffAssignment(c, approvalInput.UserGroup, approvalInput.Branch, approvalInput.Branches)
+	if !ok {
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	err := inits.CurrentDB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.OUser{}).Where("uid = ? AND status = ?", staff.UID, models.PendingUser).
+			Updates(map[string]interface{}{"user_group": approvalInput.UserGroup, "branch": approvalInput.Branch, "status": models.Active})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return utils.AssignStaffBranches(tx, staff.UID, approvalInput.Branches, user.UID)
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(400, gin.H{"error": "User is not awaiting this action"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Error approving user"})
+		return
+	}
+	utils.InvalidatePermissions(staff.UID)
+
+	utils.LogEvent("o_users", staff.UID, fmt.Sprintf("Signup of %s(%d) approved into group %s, branch %d and branches %v by %s(%d)", staff.Name, staff.UID, group.Name, approvalInput.Branch, approvalInput.Branches, user.Name, user.UID), user.UID)
+	utils.NotifyUser(staff, "Account approved", "Your account has been approved, you can now log in.")
+
+	c.JSON(200, gin.H{"data": "User approved successfully"})
+}
+
+// RejectUser turns down a pending signup, the account is kept as deleted for the audit trail
+func RejectUser(c *gin.Context) {
+
+	// set necessary variables
+	var rejectionInput schemas.UserRejectionSchema
+
+	staff, ok := findUserWithStatus(c, models.PendingUser)
+	if !ok {
+		return
+	}
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&rejectionInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	result := inits.CurrentDB.Model(&models.OUser{}).Where("uid = ? AND status = ?", staff.UID, models.PendingUser).Update("status", models.Delete)
+	if result.Error != nil {
+		c.JSON(500, gin.H{"error": "Error rejecting user"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(400, gin.H{"error": "User is not awaiting this action"})
+		return
+	}
+
+	reason := strings.TrimSpace(rejectionInput.Reason)
+	if reason == "" {
+		reason = "no reason given"
+	}
+	utils.LogEvent("o_users", staff.UID, fmt.Sprintf("Signup of %s(%d) rejected by %s(%d): %s", staff.Name, staff.UID, user.Name, user.UID, reason), user.UID)
+
+	c.JSON(200, gin.H{"data": "User rejected successfully"})
+}
+
+// InviteUser creates a staff account with its group and branches and sends a one-time activation link,
+// the account can't be used until the invitee sets a password at /users/activate
+func InviteUser(c *gin.Context) {
+
+	// set necessary variables
+	var inviteInput schemas.UserInviteSchema
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&inviteInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	email := strings.TrimSpace(inviteInput.Email)
+	phone := utils.MakePhoneValid(inviteInput.Phone)
+	if !utils.IsPhoneValid(phone) {
+		c.JSON(400, gin.H{"error": "Invalid phone number"})
+		return
+	}
+
+	var count int64
+	inits.CurrentDB.Model(&models.OUser{}).Where("email = ? OR phone = ?", email, phone).Count(&count)
+	if count > 0 {
+		c.JSON(400, gin.H{"error": "User with that email or phone already exists"})
+		return
+	}
+
+	group, ok := checkStaffAssignment(c, inviteInput.UserGroup, inviteInput.Branch, inviteInput.Branches)
+	if !ok {
+		return
+	}
+
+	channel := inviteInput.Channel
+	if channel == "" {
+		channel = "email"
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	// the invitee chooses their password on activation
+	hash, err := utils.HashPassword(utils.SecureRandomString(32))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error hashing password"})
+		return
+	}
+
+	companyId, err := strconv.Atoi(os.Getenv("COMPANY_ID"))
+	if err != nil {
+		companyId = 1
+	}
+
+	staff := models.OUser{
+		Name:        strings.TrimSpace(inviteInput.Name),
+		Email:       email,
+		Phone:       phone,
+		NationalID:  strings.TrimSpace(inviteInput.NationalID),
+		Pass1:       hash,
+		JoinDate:    time.Now().Local(),
+		UserGroup:   inviteInput.UserGroup,
+		Branch:      inviteInput.Branch,
+		Company:     companyId,
+		Status:      models.InvitedUser,
+		AccountType: models.StaffAccount,
+	}
+
+	err = inits.CurrentDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&staff).Error; err != nil {
+			return err
+		}
+		return utils.AssignStaffBranches(tx, staff.UID, inviteInput.Branches, user.UID)
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error creating user"})
+		return
+	}
+
+	token, expiry, err := utils.CreateUserInvite(staff, channel, user.UID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error creating invitation"})
+		return
+	}
+
+	utils.LogEvent("o_users", staff.UID, fmt.Sprintf("%s(%d) invited into group %s, branch %d and branches %v by %s(%d) via %s", staff.Name, staff.UID, group.Name, staff.Branch, inviteInput.Branches, user.Name, user.UID, channel), user.UID)
+
+	// the account stays, the invitation can be sent again
+	if err := utils.SendUserInvite(staff, channel, token, expiry); err != nil {
+		fmt.Println("Error sending invitation:", err)
+		c.JSON(500, gin.H{"error": "User created but the invitation could not be sent", "uid": staff.UID})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": "Invitation sent successfully", "uid": staff.UID})
+}
+
+// ResendInvite sends a new activation link to an invited staff member, the earlier link stops working
+func ResendInvite(c *gin.Context) {
+
+	staff, ok := findUserWithStatus(c, models.InvitedUser)
+	if !ok {
+		return
+	}
+
+	channel := utils.QueryParamToStringWithDefault(c, "channel", "email")
+	if channel != "email" && channel != "sms" {
+		c.JSON(400, gin.H{"error": "Invalid channel"})
+		return
+	}
+
+	// Get user
+	user := c.MustGet("user").(models.OUser)
+
+	token, expiry, err := utils.CreateUserInvite(staff, channel, user.UID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error creating invitation"})
+		return
+	}
+
+	if err := utils.SendUserInvite(staff, channel, token, expiry); err != nil {
+		fmt.Println("Error sending invitation:", err)
+		c.JSON(500, gin.H{"error": "Error sending invitation"})
+		return
+	}
+
+	utils.LogEvent("o_users", staff.UID, fmt.Sprintf("Invitation of %s(%d) sent again by %s(%d) via %s", staff.Name, staff.UID, user.Name, user.UID, channel), user.UID)
+
+	c.JSON(200, gin.H{"data": "Invitation sent successfully"})
+}
+
+// ActivateAccount sets the password of an invited staff member from their one-time link and activates the account
+func ActivateAccount(c *gin.Context) {
+
+	// set necessary variables
+	var activateInput schemas.ActivateAccountSchema
+
+	// bind request body to schema
+	if err := c.ShouldBindJSON(&activateInput); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			out := make([]customTypes.ErrorMsg, len(ve))
+			for i, fe := range ve {
+				out[i] = customTypes.ErrorMsg{Field: fe.Field(), Message: utils.GetErrorMsg(fe)}
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": out})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hash, err := utils.HashPassword(strings.TrimSpace(activateInput.Password))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error hashing password"})
+		return
+	}
+
+	staff, err := utils.AcceptUserInvite(strings.TrimSpace(activateInput.Token), hash)
+	if err != nil {
+		if errors.Is(err, utils.ErrInvalidInvite) {
+			c.JSON(400, gin.H{"error": "Invalid or expired activation link"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Error activating account"})
+		return
+	}
+
+	utils.LogEvent("o_users", staff.UID, fmt.Sprintf("Account of %s(%d) activated from %s", staff.Name, staff.UID, c.ClientIP()), staff.UID)
+
+	c.JSON(200, gin.H{"data": "Account activated successfully, you can now log in"})
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"log"
+	"os"
 	"super-lender/controllers"
 	"super-lender/inits"
 	"super-lender/middlewares"
+	"super-lender/migrations"
+	"super-lender/utils"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm/logger"
@@ -23,55 +27,171 @@ func init() {
 
 func main() {
 
-	// Create a gin router
+	// Bring the schema up to date before serving, on the instance that owns it
+	if os.Getenv("MIGRATE") == "1" {
+		if err := migrations.MigrateDatabase(); err != nil {
+			log.Fatal("Error migrating database: ", err)
+		}
+	}
+
+	// Start the daily follow-up agenda scheduler on the instance that owns it
+	if os.Getenv("AGENDA_SCHEDULER") == "1" {
+		go utils.StartAgendaScheduler()
+	}
+
+	// Create a gin router, client addresses only come from X-Forwarded-For behind a trusted proxy
 	r := gin.Default()
+	if err := r.SetTrustedProxies(utils.TrustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES: ", err)
+	}
 
 	////==== Begin general routes
 	r.GET("/ping", controllers.HeathCheck)
 	////==== End general routes
 
 	////==== Begin users routes
-	r.GET("/users", middlewares.RequireAuth, controllers.FindManyUsers)
-	r.GET("/users/:uid", middlewares.RequireAuth, controllers.FindUserByID)
+	r.GET("/users", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.FindManyUsers)
+	r.GET("/users/:uid", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.FindUserByID)
+	r.GET("/users/password-hashes", middlewares.RequireAuth, middlewares.RequireScope("read"), middlewares.RequirePermission("o_users", "read_"), controllers.PasswordHashReport)
 	r.POST("/users/signup", controllers.Signup)
 	r.POST("/users/login", controllers.Login)
-	r.GET("/users/auth", middlewares.RequireAuth, controllers.ValidateUser)
-	r.GET("/users/logout", middlewares.RequireAuth, controllers.Logout)
-	r.POST("/users/switch-db", middlewares.RequireAuth, controllers.SwitchDB)
-	r.PUT("/users/change-password", controllers.ChangePassword)
+	r.POST("/users/login/verify", controllers.VerifyLoginChallenge)
+	r.POST("/users/token/refresh", controllers.RefreshToken)
+	r.GET("/users/auth", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.ValidateUser)
+	r.GET("/users/logout", middlewares.RequireAuth, middlewares.RequireUserSession, middlewares.RequireScope("read"), controllers.Logout)
+	r.GET("/users/sessions", middlewares.RequireAuth, middlewares.RequireUserSession, middlewares.RequireScope("read"), controllers.ListSessions)
+	r.DELETE("/users/sessions", middlewares.RequireAuth, middlewares.RequireFullSession, middlewares.RequireScope("read"), controllers.RevokeAllSessions)
+	r.DELETE("/users/sessions/:id", middlewares.RequireAuth, middlewares.RequireFullSession, middlewares.RequireScope("read"), controllers.RevokeSession)
+	r.DELETE("/users/:uid/sessions", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_users", "update_"), controllers.RevokeUserSessions)
+	r.GET("/users/:uid/login-history", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.GetLoginHistory)
+	r.POST("/users/:uid/unlock", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_users", "update_"), controllers.UnlockUser)
+	r.GET("/users/:uid/permissions", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.ExplainUserPermissions)
+	r.POST("/users/switch-db", middlewares.RequireAuth, middlewares.RequireFullSession, middlewares.RequireScope("read"), controllers.SwitchDB)
+	r.POST("/users/tokens/read-only", middlewares.RequireAuth, middlewares.RequireFullSession, middlewares.RequireScope("read"), controllers.CreateReadOnlyToken)
+	r.PUT("/users/change-password", middlewares.RequireAuth, middlewares.RequireUserSession, middlewares.RequireScope("write"), controllers.ChangePassword)
+	r.POST("/users/invite", middlewares.RequireAuth, middlewares.RequireUserSession, middlewares.RequireScope("write"), middlewares.RequirePermission("o_users", "create_"), controllers.InviteUser)
+	r.POST("/users/activate", controllers.ActivateAccount)
+	r.POST("/users/:uid/approve", middlewares.RequireAuth, middlewares.RequireUserSession, middlewares.RequireScope("write"), middlewares.RequirePermission("o_users", "update_"), controllers.ApproveUser)
+	r.POST("/users/:uid/reject", middlewares.RequireAuth, middlewares.RequireUserSession, middlewares.RequireScope("write"), middlewares.RequirePermission("o_users", "update_"), controllers.RejectUser)
+	r.POST("/users/:uid/invite", middlewares.RequireAuth, middlewares.RequireUserSession, middlewares.RequireScope("write"), middlewares.RequirePermission("o_users", "create_"), controllers.ResendInvite)
+	r.GET("/users/:uid/branches", middlewares.RequireAuth, middlewares.RequireScope("read"), middlewares.RequirePermission("o_users", "read_"), controllers.GetStaffBranches)
+	r.POST("/users/:uid/branches", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_users", "update_"), controllers.AssignStaffBranch)
+	r.DELETE("/users/:uid/branches/:branch", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_users", "update_"), controllers.UnassignStaffBranch)
+	r.POST("/users/:uid/transfer-portfolio", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_customers", "update_"), controllers.TransferPortfolio)
+	r.POST("/users/forgot-password", controllers.ForgotPassword)
+	r.POST("/users/reset-password", controllers.ResetPassword)
+	r.GET("/users/2fa", middlewares.RequireAuth, middlewares.RequireUserSession, middlewares.RequireScope("read"), controllers.GetTwoFactorStatus)
+	r.POST("/users/2fa/setup", middlewares.RequireAuth, middlewares.RequireUserSession, middlewares.RequireScope("write"), controllers.SetupTwoFactor)
+	r.POST("/users/2fa/enable", middlewares.RequireAuth, middlewares.RequireUserSession, middlewares.RequireScope("write"), controllers.EnableTwoFactor)
+	r.POST("/users/2fa/disable", middlewares.RequireAuth, middlewares.RequireUserSession, middlewares.RequireScope("write"), controllers.DisableTwoFactor)
+	r.POST("/users/2fa/recovery-codes", middlewares.RequireAuth, middlewares.RequireUserSession, middlewares.RequireScope("write"), controllers.RegenerateRecoveryCodes)
 	////==== End users routes
 
+	////==== Begin user groups routes
+	r.GET("/user-groups", middlewares.RequireAuth, middlewares.RequireScope("read"), middlewares.RequirePermission("o_user_groups", "read_"), controllers.FindManyUserGroups)
+	r.POST("/user-groups", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_user_groups", "create_"), controllers.CreateUserGroup)
+	r.GET("/user-groups/:uid", middlewares.RequireAuth, middlewares.RequireScope("read"), middlewares.RequirePermission("o_user_groups", "read_"), controllers.FindUserGroupByID)
+	r.PUT("/user-groups/:uid", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_user_groups", "update_"), controllers.UpdateUserGroup)
+	r.DELETE("/user-groups/:uid", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_user_groups", "delete_"), controllers.DeleteUserGroup)
+	r.GET("/user-groups/:uid/permissions", middlewares.RequireAuth, middlewares.RequireScope("read"), middlewares.RequirePermission("o_permissions", "read_"), controllers.GetUserGroupPermissions)
+	////==== End user groups routes
+
+	////==== Begin permissions routes
+	r.POST("/permissions/grant", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_permissions", "update_"), controllers.GrantPermission)
+	r.POST("/permissions/revoke", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_permissions", "update_"), controllers.RevokePermission)
+	////==== End permissions routes
+
+	////==== Begin service accounts routes
+	r.GET("/service-accounts", middlewares.RequireAuth, middlewares.RequireScope("read"), middlewares.RequirePermission("o_api_keys", "read_"), controllers.FindManyServiceAccounts)
+	r.POST("/service-accounts", middlewares.RequireAuth, middlewares.RequireUserSession, middlewares.RequireScope("write"), middlewares.RequirePermission("o_users", "create_"), controllers.CreateServiceAccount)
+	r.POST("/service-accounts/:uid/deactivate", middlewares.RequireAuth, middlewares.RequireUserSession, middlewares.RequireScope("write"), middlewares.RequirePermission("o_users", "update_"), controllers.DeactivateServiceAccount)
+	r.GET("/service-accounts/:uid/api-keys", middlewares.RequireAuth, middlewares.RequireScope("read"), middlewares.RequirePermission("o_api_keys", "read_"), controllers.GetServiceAccountKeys)
+	r.POST("/service-accounts/:uid/api-keys", middlewares.RequireAuth, middlewares.RequireUserSession, middlewares.RequireScope("write"), middlewares.RequirePermission("o_api_keys", "create_"), controllers.IssueAPIKey)
+	r.POST("/api-keys/:uid/rotate", middlewares.RequireAuth, middlewares.RequireUserSession, middlewares.RequireScope("write"), middlewares.RequirePermission("o_api_keys", "update_"), controllers.RotateAPIKey)
+	r.DELETE("/api-keys/:uid", middlewares.RequireAuth, middlewares.RequireUserSession, middlewares.RequireScope("write"), middlewares.RequirePermission("o_api_keys", "delete_"), controllers.RevokeAPIKey)
+	////==== End service accounts routes
+
+	////==== Begin branches routes
+	r.GET("/branches", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.FindManyBranches)
+	r.POST("/branches", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_branches", "create_"), controllers.CreateBranch)
+	r.GET("/branches/:uid", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.FindBranchByID)
+	r.PUT("/branches/:uid", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequireAnyPermission("o_branches", "update_"), controllers.UpdateBranch)
+	r.PUT("/branches/:uid/managers", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequireAnyPermission("o_branches", "update_"), controllers.SetBranchManagers)
+	r.PUT("/branches/:uid/status", middlewares.RequireAuth, middlewares.RequireScope("write"), controllers.SetBranchStatus)
+	r.GET("/branches/:uid/staff", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.GetBranchStaff)
+	////==== End branches routes
+
+	////==== Begin regions routes
+	r.GET("/regions", middlewares.RequireAuth, middlewares.RequireScope("read"), middlewares.RequirePermission("o_regions", "read_"), controllers.FindManyRegions)
+	r.POST("/regions", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_regions", "create_"), controllers.CreateRegion)
+	r.GET("/regions/:uid", middlewares.RequireAuth, middlewares.RequireScope("read"), middlewares.RequirePermission("o_regions", "read_"), controllers.FindRegionByID)
+	r.PUT("/regions/:uid", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_regions", "update_"), controllers.UpdateRegion)
+	r.DELETE("/regions/:uid", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_regions", "delete_"), controllers.DeleteRegion)
+	////==== End regions routes
+
 	////==== Begin customers routes
-	r.POST("/customers", middlewares.RequireAuth, controllers.CreateCustomer)
-	r.GET("/customers", middlewares.RequireAuth, controllers.FindManyCustomers)
-	r.PUT("/customers", middlewares.RequireAuth, controllers.UpdateCustomer)
-	r.GET("/customers/:uid", middlewares.RequireAuth, controllers.FindCustomerById)
-	r.GET("/customers/:uid/contacts", middlewares.RequireAuth, controllers.GetCustomerContacts)
-	r.GET("/customers/:uid/guarantors", middlewares.RequireAuth, controllers.GetCustomerGuarantors)
-	r.GET("/customers/:uid/referees", middlewares.RequireAuth, controllers.GetCustomerReferees)
+	r.POST("/customers", middlewares.RequireAuth, middlewares.RequireScope("write"), controllers.CreateCustomer)
+	r.GET("/customers", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.FindManyCustomers)
+	r.PUT("/customers", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequireAnyCustomerPermission("update_"), controllers.UpdateCustomer)
+	r.POST("/customers/import", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_customers", "create_"), controllers.ImportCustomers)
+	r.GET("/customers/import/:uid", middlewares.RequireAuth, middlewares.RequireScope("read"), middlewares.RequirePermission("o_customers", "create_"), controllers.GetCustomerImport)
+	r.POST("/customers/reassign", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_customers", "update_"), controllers.ReassignCustomers)
+	r.GET("/customers/:uid", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.FindCustomerById)
+	r.GET("/customers/:uid/overview", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.GetCustomerOverview)
+	r.GET("/customers/:uid/contacts", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.GetCustomerContacts)
+	r.GET("/customers/:uid/guarantors", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.GetCustomerGuarantors)
+	r.DELETE("/customers/:uid", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequireAnyCustomerPermission("delete_"), controllers.DeleteCustomer)
+	r.POST("/customers/:uid/restore", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequireAnyCustomerPermission("delete_"), controllers.RestoreCustomer)
+	r.POST("/customers/:uid/erase", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_customers", "delete_"), controllers.EraseCustomer)
+	r.GET("/customers/:uid/data-export", middlewares.RequireAuth, middlewares.RequireScope("read"), middlewares.RequirePermission("o_customers", "read_"), controllers.ExportCustomerData)
+	r.GET("/customers/:uid/possible-duplicates", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.GetPossibleDuplicates)
+	r.POST("/customers/:uid/merge", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequireAnyCustomerPermission("update_"), controllers.MergeCustomers)
+	r.GET("/customers/:uid/kyc-status", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.GetCustomerKycStatus)
+	r.POST("/customers/:uid/activate", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequireAnyCustomerPermission("update_"), controllers.ActivateCustomer)
+	r.GET("/customers/:uid/documents", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.FindCustomerDocuments)
+	r.POST("/customers/:uid/documents", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequireAnyCustomerPermission("update_"), controllers.UploadCustomerDocument)
+	r.GET("/customers/:uid/referees", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.GetCustomerReferees)
 	////==== End customers routes
 
+	////==== Begin documents routes
+	r.GET("/documents/:uid/download", controllers.DownloadCustomerDocument)
+	r.DELETE("/documents/:uid", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequireAnyCustomerPermission("update_"), controllers.DeleteCustomerDocument)
+	////==== End documents routes
+
+	////==== Begin KYC checklist routes
+	r.GET("/kyc-requirements", middlewares.RequireAuth, middlewares.RequireScope("read"), middlewares.RequirePermission("o_kyc_requirements", "read_"), controllers.FindManyKycRequirements)
+	r.PUT("/kyc-requirements/:product", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_kyc_requirements", "update_"), controllers.SetKycRequirement)
+	////==== End KYC checklist routes
+
 	////==== Begin contacts routes
-	r.POST("/contacts", middlewares.RequireAuth, controllers.CreateCustomerContact)
-	r.PUT("/contacts", middlewares.RequireAuth, controllers.UpdateCustomerContact)
-	r.GET("/contacts/:uid", middlewares.RequireAuth, controllers.GetCustomerContact)
+	r.POST("/contacts", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_customer_contacts", "create_"), controllers.CreateCustomerContact)
+	r.PUT("/contacts", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_customer_contacts", "update_"), controllers.UpdateCustomerContact)
+	r.POST("/contacts/:uid/verify", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_customer_contacts", "update_"), controllers.VerifyCustomerContact)
+	r.GET("/contacts/:uid", middlewares.RequireAuth, middlewares.RequireScope("read"), middlewares.RequirePermission("o_customer_contacts", "read_"), controllers.GetCustomerContact)
 	////==== End contacts routes
 
 	////==== Begin guarantors routes
-	r.POST("/guarantors", middlewares.RequireAuth, controllers.CreateCustomerGuarantor)
-	r.PUT("/guarantors", middlewares.RequireAuth, controllers.UpdateCustomerGuarantor)
-	r.GET("/guarantors/:uid", middlewares.RequireAuth, controllers.GetCustomerGuarantor)
+	r.POST("/guarantors", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_customers", "update_"), controllers.CreateCustomerGuarantor)
+	r.PUT("/guarantors", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_customers", "update_"), controllers.UpdateCustomerGuarantor)
+	r.GET("/guarantors/:uid", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.GetCustomerGuarantor)
 	////==== End guarantors routes
 
 	////==== Begin referees routes
-	r.POST("/referees", middlewares.RequireAuth, controllers.CreateCustomerReferee)
-	r.PUT("/referees", middlewares.RequireAuth, controllers.UpdateCustomerReferee)
-	r.GET("/referees/:uid", middlewares.RequireAuth, controllers.GetCustomerReferee)
+	r.POST("/referees", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_customers", "create_"), controllers.CreateCustomerReferee)
+	r.PUT("/referees", middlewares.RequireAuth, middlewares.RequireScope("write"), middlewares.RequirePermission("o_customers", "update_"), controllers.UpdateCustomerReferee)
+	r.GET("/referees/:uid", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.GetCustomerReferee)
 	////==== End referees routes
 
 	////==== Begin interactions routes
-	r.GET("/interactions", middlewares.RequireAuth, controllers.GetCustomerConversations)
+	r.GET("/interactions", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.GetCustomerConversations)
+	r.GET("/interactions/search", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.SearchCustomerConversations)
 	////==== End interactions routes
 
+	////==== Begin me routes
+	r.GET("/me/agenda", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.GetMyAgenda)
+	r.GET("/me/notifications", middlewares.RequireAuth, middlewares.RequireScope("read"), controllers.GetMyNotifications)
+	r.PUT("/me/notifications/:uid/read", middlewares.RequireAuth, middlewares.RequireScope("write"), controllers.MarkNotificationRead)
+	////==== End me routes
+
 	r.Run()
 }
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"super-lender/inits"
 	"super-lender/models"
+	"super-lender/utils"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -36,6 +38,12 @@ func RequireAuth(ctx *gin.Context) {
 	// extract token from header instead of cookie and remove Bearer prefix
 	tokenString := ctx.GetHeader("Authorization")
 
+	// service accounts authenticate with an api key instead of a login session
+	if tokenString == "" && ctx.GetHeader("X-API-Key") != "" {
+		requireAPIKey(ctx)
+		return
+	}
+
 	if tokenString == "" {
 		ctx.JSON(401, gin.H{"error": "Authorization header is required"})
 		ctx.AbortWithStatus(http.StatusUnauthorized)
@@ -44,7 +52,12 @@ func RequireAuth(ctx *gin.Context) {
 	}
 
 	// Remove Bearer prefix
-	tokenString = tokenString[7:]
+	if !strings.HasPrefix(tokenString, "Bearer ") {
+		ctx.JSON(401, gin.H{"error": "Authorization header must be a Bearer token"})
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
 
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -64,9 +77,14 @@ func RequireAuth(ctx *gin.Context) {
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		fmt.Println(claims["uid"], claims["exp"])
-		scope := claims["scope"].([]interface{})
-		db := scope[0].(string)
+		var tokenScope []string
+		if scopeClaim, ok := claims["scope"].([]interface{}); ok {
+			for _, s := range scopeClaim {
+				if str, ok := s.(string); ok {
+					tokenScope = append(tokenScope, str)
+				}
+			}
+		}
 
 		if float64(time.Now().Unix()) > claims["exp"].(float64) {
 			ctx.JSON(401, gin.H{"error": "Token expired"})
@@ -85,6 +103,26 @@ func RequireAuth(ctx *gin.Context) {
 
 		id := int(idFloat) // Convert float64 to int
 
+		// check that the session the token was issued for has not been revoked or expired
+		sidFloat, ok := claims["sid"].(float64)
+		if !ok {
+			ctx.JSON(401, gin.H{"error": "Session is required, please log in again"})
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		session, err := utils.FindActiveSession(uint(sidFloat), id)
+		if err != nil {
+			if errors.Is(err, utils.ErrInvalidSession) {
+				ctx.JSON(401, gin.H{"error": "Session has expired or been revoked"})
+				ctx.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+			ctx.JSON(500, gin.H{"error": "Database error"})
+			ctx.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
 		if err := inits.CurrentDB.First(&user, id).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				ctx.JSON(401, gin.H{"error": "Unauthorized...."})
@@ -96,11 +134,78 @@ func RequireAuth(ctx *gin.Context) {
 			return
 		}
 
+		// blocked, rejected or deleted staff lose access at once
+		if user.Status != models.Active {
+			ctx.JSON(401, gin.H{"error": "Account is not active"})
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		// the token can only narrow what its session allows
+		scope := utils.EffectiveScope(tokenScope)
+		sessionScope := utils.SessionScope(session)
+		for i := len(scope) - 1; i > 0; i-- {
+			if !utils.ScopeContains(sessionScope, scope[i]) {
+				scope = append(scope[:i], scope[i+1:]...)
+			}
+		}
+
 		ctx.Set("user", user)
-		ctx.Set("db", db)
+		ctx.Set("db", scope[0])
+		ctx.Set("scope", scope)
+		ctx.Set("session", session)
+		utils.TouchSession(session)
 	} else {
 		ctx.JSON(401, gin.H{"error": "Invalid token claims"})
 		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	ctx.Next()
+}
+
+// requireAPIKey authenticates a service account by its X-API-Key header and attributes the request to it in o_events
+func requireAPIKey(ctx *gin.Context) {
+	apiKey, user, err := utils.AuthenticateAPIKey(ctx.GetHeader("X-API-Key"), ctx.ClientIP())
+	if err != nil {
+		if errors.Is(err, utils.ErrInvalidAPIKey) || errors.Is(err, utils.ErrAPIKeyIPNotAllowed) {
+			ctx.JSON(401, gin.H{"error": "Invalid API key"})
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		ctx.JSON(500, gin.H{"error": "Database error"})
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	scope := utils.APIKeyScope(apiKey)
+
+	ctx.Set("user", user)
+	ctx.Set("db", scope[0])
+	ctx.Set("scope", scope)
+	ctx.Set("apiKey", apiKey)
+	utils.TouchAPIKey(apiKey, ctx.ClientIP())
+
+	ctx.Next()
+
+	utils.LogAPIKeyRequest(ctx, apiKey, user)
+}
+
+// RequireUserSession limits a route to staff logged in with a session, api keys cannot manage sessions or credentials
+func RequireUserSession(ctx *gin.Context) {
+	if _, ok := ctx.Get("session"); !ok {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": 403, "message": "This action requires a user login!"})
+		return
+	}
+	ctx.Next()
+}
+
+// RequireFullSession limits a route to staff logged in with a full session. Read-only tokens cannot manage
+// sessions, switch databases or mint more tokens, the route works on archive sessions all the same.
+func RequireFullSession(ctx *gin.Context) {
+	session, ok := ctx.Get("session")
+	if !ok || !utils.IsFullSession(session.(models.OToken)) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": 403, "message": "This action requires a full user login, not a read-only token!"})
+		return
 	}
 	ctx.Next()
 }
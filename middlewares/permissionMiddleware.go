@@ -0,0 +1,44 @@
+package middlewares
+
+import (
+	"super-lender/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission only lets the request through if the authenticated user holds act on tbl.
+// It must run after RequireAuth, the permission set it loads is kept on the context as "permissions".
+func RequirePermission(tbl string, act string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !utils.HasPermission(ctx, tbl, act) {
+			utils.AbortForbidden(ctx, tbl, act)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// RequireAnyPermission lets the request through if the user holds act on tbl or on at least one of its
+// records. The handler must then check the record it acts on with utils.HasRecordPermission.
+func RequireAnyPermission(tbl string, act string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !utils.RequestPermissions(ctx).CanAny(tbl, act) {
+			utils.AbortForbidden(ctx, tbl, act)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// RequireAnyCustomerPermission lets the request through if the user holds act on customers, or on at least one
+// customer, branch or loan. The handler must then check the customer it acts on with utils.HasCustomerPermission.
+func RequireAnyCustomerPermission(act string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		permissions := utils.RequestPermissions(ctx)
+		if !permissions.CanAny("o_customers", act) && len(permissions.RecordIDs("o_branches", act)) == 0 && len(permissions.RecordIDs("o_loans", act)) == 0 {
+			utils.AbortForbidden(ctx, "o_customers", act)
+			return
+		}
+		ctx.Next()
+	}
+}
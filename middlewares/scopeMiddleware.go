@@ -0,0 +1,26 @@
+package middlewares
+
+import (
+	"net/http"
+	"super-lender/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireScope only lets the request through if the access token carries the scope ("read" or "write").
+// It must run after RequireAuth. Archive tokens never carry write.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		tokenScope, _ := ctx.Get("scope")
+		scopes, _ := tokenScope.([]string)
+		if !utils.ScopeContains(scopes, scope) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"status":  403,
+				"message": "Your token does not allow this action!",
+				"scope":   scope,
+			})
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -1,15 +1,75 @@
 package migrations
 
 import (
+	"fmt"
 	"super-lender/inits"
+	"super-lender/models"
 )
 
-func init() {
-	inits.LoadEnv()
-	inits.DBInit()
-}
-
-func MigrateDatabase() {
+// MigrateDatabase creates the tables and columns the application needs on the current database.
+// It expects inits.DBInit to have run and stops at the first error.
+func MigrateDatabase() error {
 	// inits.DB.AutoMigrate(&models.OCustomer{})
 	// inits.DB.AutoMigrate(&models.OCustomerConversations{})
+	tables := []interface{}{
+		&models.ONotification{},
+		&models.OUserTwoFactor{},
+		&models.OLoginChallenge{},
+		&models.OLoginHistory{},
+		&models.OLoginLock{},
+		&models.OApiKey{},
+		&models.OUserInvite{},
+		&models.ORegion{},
+		&models.OKycRequirement{},
+		&models.OCustomerDocument{},
+		&models.OCustomerErasure{},
+		&models.OCustomerMerge{},
+		&models.OImportJob{},
+	}
+	for _, table := range tables {
+		if err := inits.CurrentDB.AutoMigrate(table); err != nil {
+			return fmt.Errorf("migrating %T: %w", table, err)
+		}
+	}
+
+	// tables that predate the migrations only get the columns added since, AutoMigrate would
+	// also alter their existing columns to match the models
+	legacyColumns := []struct {
+		model interface{}
+		field string
+	}{
+		{&models.OToken{}, "Scope"},
+		{&models.OToken{}, "LastUsed"},
+		{&models.OToken{}, "PrevToken"},
+		{&models.OPass{}, "ResetExpiry"},
+		{&models.OPass{}, "ResetStatus"},
+		{&models.OUserGroup{}, "Require2FA"},
+		{&models.OUser{}, "AccountType"},
+		{&models.OStaffBranch{}, "StartDate"},
+		{&models.OStaffBranch{}, "EndDate"},
+		{&models.OStaffBranch{}, "AddedBy"},
+		{&models.OCustomerContacts{}, "VerifiedBy"},
+		{&models.OCustomerContacts{}, "VerifiedDate"},
+		{&models.OCustomer{}, "StatusBeforeDelete"},
+		{&models.OCustomer{}, "DeletedBy"},
+		{&models.OCustomer{}, "DeletedDate"},
+		{&models.OPermission{}, "Export"},
+	}
+	for _, column := range legacyColumns {
+		if inits.CurrentDB.Migrator().HasColumn(column.model, column.field) {
+			continue
+		}
+		if err := inits.CurrentDB.Migrator().AddColumn(column.model, column.field); err != nil {
+			return fmt.Errorf("adding column %T.%s: %w", column.model, column.field, err)
+		}
+	}
+
+	// full-text index used by /interactions/search
+	if !inits.CurrentDB.Migrator().HasIndex("o_customer_conversations", "ft_transcript") {
+		if err := inits.CurrentDB.Exec("ALTER TABLE o_customer_conversations ADD FULLTEXT INDEX ft_transcript (transcript)").Error; err != nil {
+			return fmt.Errorf("adding index ft_transcript: %w", err)
+		}
+	}
+
+	return nil
 }
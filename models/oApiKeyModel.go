@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+type ApiKeyStatus int
+
+const (
+	ActiveApiKey  ApiKeyStatus = 1
+	RevokedApiKey ApiKeyStatus = 2
+)
+
+// OApiKey is a credential of a service account. Prefix is the public part of the key used
+// to look it up, KeyHash the sha256 hash of the whole key. Scope and AllowedIPs are comma
+// separated, an empty AllowedIPs accepts any address.
+type OApiKey struct {
+	UID        int          `json:"uid" gorm:"primaryKey;autoIncrement"`
+	UserID     int          `json:"user_id" gorm:"not null;index"`
+	Name       string       `json:"name" gorm:"type:varchar(100)"`
+	Prefix     string       `json:"prefix" gorm:"type:varchar(20);unique;not null"`
+	KeyHash    string       `json:"-" gorm:"type:varchar(70);not null"`
+	Scope      string       `json:"scope" gorm:"type:varchar(100)"`
+	AllowedIPs string       `json:"allowed_ips" gorm:"type:varchar(500)"`
+	ExpiryDate *time.Time   `json:"expiry_date" gorm:"type:datetime"`
+	LastUsed   *time.Time   `json:"last_used" gorm:"type:datetime"`
+	LastUsedIP string       `json:"last_used_ip" gorm:"type:varchar(45)"`
+	CreatedBy  int          `json:"created_by" gorm:"default:0"`
+	AddedDate  time.Time    `json:"added_date" gorm:"autoCreateTime;type:datetime"`
+	Status     ApiKeyStatus `json:"status" gorm:"default:1;comment:1-active, 2-revoked"`
+}
+
+// TableName specifies the table name for the OApiKey model.
+func (OApiKey) TableName() string {
+	return "o_api_keys"
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+type DocumentType string
+
+const (
+	PassportPhotoDocument DocumentType = "passport_photo"
+	IDFrontDocument       DocumentType = "id_front"
+	IDBackDocument        DocumentType = "id_back"
+	OtherDocument         DocumentType = "other"
+)
+
+type DocumentStatus int
+
+const (
+	DeletedDocument  DocumentStatus = 0
+	ActiveDocument   DocumentStatus = 1
+	ReplacedDocument DocumentStatus = 2
+)
+
+// OCustomerDocument is the metadata of a KYC file, the file itself lives in the configured storage under StorageKey
+type OCustomerDocument struct {
+	UID          int            `json:"uid" gorm:"primaryKey;autoIncrement"`
+	CustomerID   int            `json:"customer_id" gorm:"not null;index"`
+	DocumentType DocumentType   `json:"document_type" gorm:"type:varchar(20);not null"`
+	FileName     string         `json:"file_name" gorm:"type:varchar(255);not null"`
+	MimeType     string         `json:"mime_type" gorm:"type:varchar(100);not null"`
+	Size         int64          `json:"size" gorm:"not null"`
+	Checksum     string         `json:"checksum" gorm:"type:varchar(64);not null;comment:sha256 of the file"`
+	StorageKey   string         `json:"-" gorm:"type:varchar(255);not null"`
+	ThumbnailKey string         `json:"-" gorm:"type:varchar(255)"`
+	Description  string         `json:"description" gorm:"type:varchar(250)"`
+	UploadedBy   int            `json:"uploaded_by" gorm:"not null"`
+	UploadedDate time.Time      `json:"uploaded_date" gorm:"autoCreateTime;type:datetime"`
+	Status       DocumentStatus `json:"status" gorm:"default:1;comment:1-active, 2-replaced, 0-deleted"`
+}
+
+// TableName specifies the table name for the OCustomerDocument model.
+func (OCustomerDocument) TableName() string {
+	return "o_customer_documents"
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// OCustomerErasure records a data subject erasure, it holds no personal data of the erased customer
+type OCustomerErasure struct {
+	UID         int       `json:"uid" gorm:"primaryKey;autoIncrement"`
+	CustomerID  int       `json:"customer_id" gorm:"not null;uniqueIndex"`
+	Reference   string    `json:"reference" gorm:"type:varchar(100);comment:the data subject request reference"`
+	Reason      string    `json:"reason" gorm:"type:varchar(250);not null"`
+	ErasedBy    int       `json:"erased_by" gorm:"not null"`
+	ErasedDate  time.Time `json:"erased_date" gorm:"autoCreateTime;type:datetime"`
+	FilesErased int       `json:"files_erased" gorm:"default:0"`
+}
+
+// TableName specifies the table name for the OCustomerErasure model.
+func (OCustomerErasure) TableName() string {
+	return "o_customer_erasures"
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// OCustomerMerge records a duplicate customer being merged into the surviving one.
+// MergedSnapshot is the account details of the duplicate without personal data, MovedRecords the uids re-pointed per table, both as JSON.
+type OCustomerMerge struct {
+	UID            int       `json:"uid" gorm:"primaryKey;autoIncrement"`
+	SurvivorID     int       `json:"survivor_id" gorm:"not null;index"`
+	MergedID       int       `json:"merged_id" gorm:"not null;uniqueIndex"`
+	MergedSnapshot string    `json:"merged_snapshot" gorm:"type:mediumtext"`
+	MovedRecords   string    `json:"moved_records" gorm:"type:mediumtext"`
+	Reason         string    `json:"reason" gorm:"type:varchar(250)"`
+	MergedBy       int       `json:"merged_by" gorm:"not null"`
+	MergedDate     time.Time `json:"merged_date" gorm:"autoCreateTime;type:datetime"`
+}
+
+// TableName specifies the table name for the OCustomerMerge model.
+func (OCustomerMerge) TableName() string {
+	return "o_customer_merges"
+}
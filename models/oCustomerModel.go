@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type PhoneNumberProvider int
 
 const (
@@ -57,4 +59,7 @@ type OCustomer struct {
 	Flag                int                 `json:"flag" gorm:"default:0" binding:"omitempty,numeric"`
 	TotalLoans          int                 `json:"totalLoans" gorm:"default:0"`
 	Status              CustomerStatus      `json:"status" gorm:"default:3" binding:"omitempty,numeric,oneof=0 1 2 3 4"`
+	StatusBeforeDelete  CustomerStatus      `json:"-" gorm:"default:0;comment:status a restore returns to"`
+	DeletedBy           int                 `json:"-" gorm:"default:0"`
+	DeletedDate         *time.Time          `json:"-" gorm:"type:datetime"`
 }
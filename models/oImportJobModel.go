@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+type ImportJobStatus int
+
+const (
+	QueuedImport    ImportJobStatus = 1
+	RunningImport   ImportJobStatus = 2
+	CompletedImport ImportJobStatus = 3
+	FailedImport    ImportJobStatus = 4
+)
+
+// OImportJob is a spreadsheet import running in the background, Report holds the per-row outcome as JSON
+type OImportJob struct {
+	UID           int             `json:"uid" gorm:"primaryKey;autoIncrement"`
+	Kind          string          `json:"kind" gorm:"type:varchar(30);not null"`
+	FileName      string          `json:"file_name" gorm:"type:varchar(255);not null"`
+	DryRun        int             `json:"dry_run" gorm:"default:0"`
+	TotalRows     int             `json:"total_rows" gorm:"default:0"`
+	SucceededRows int             `json:"succeeded_rows" gorm:"default:0"`
+	FailedRows    int             `json:"failed_rows" gorm:"default:0"`
+	Report        string          `json:"-" gorm:"type:longtext"`
+	Error         string          `json:"error" gorm:"type:varchar(250)"`
+	CreatedBy     int             `json:"created_by" gorm:"not null;index"`
+	CreatedDate   time.Time       `json:"created_date" gorm:"autoCreateTime;type:datetime"`
+	CompletedDate *time.Time      `json:"completed_date" gorm:"type:datetime"`
+	Status        ImportJobStatus `json:"status" gorm:"default:1;comment:1-queued, 2-running, 3-completed, 4-failed"`
+}
+
+// TableName specifies the table name for the OImportJob model.
+func (OImportJob) TableName() string {
+	return "o_import_jobs"
+}
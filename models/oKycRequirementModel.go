@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// OKycRequirement is the checklist a customer must pass before they are activated on a product.
+// ProductID 0 is the default checklist for products that have none of their own.
+type OKycRequirement struct {
+	UID                     int       `json:"uid" gorm:"primaryKey;autoIncrement"`
+	ProductID               int       `json:"product_id" gorm:"not null;uniqueIndex;comment:From o_loan_products table, 0 for the default"`
+	RequireNationalID       int       `json:"require_national_id" gorm:"not null;default:0"`
+	RequirePhoto            int       `json:"require_photo" gorm:"not null;default:0"`
+	MinReferees             int       `json:"min_referees" gorm:"not null;default:0"`
+	MinGuarantors           int       `json:"min_guarantors" gorm:"not null;default:0"`
+	RequireVerifiedContacts int       `json:"require_verified_contacts" gorm:"not null;default:0"`
+	UpdatedBy               int       `json:"updated_by" gorm:"default:0"`
+	UpdatedDate             time.Time `json:"updated_date" gorm:"autoUpdateTime;type:datetime"`
+}
+
+// TableName specifies the table name for the OKycRequirement model.
+func (OKycRequirement) TableName() string {
+	return "o_kyc_requirements"
+}
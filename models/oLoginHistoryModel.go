@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+type LoginOutcome int
+
+const (
+	SuccessfulLogin LoginOutcome = 1
+	FailedLogin     LoginOutcome = 2
+	LockedLogin     LoginOutcome = 3
+)
+
+// OLoginHistory is one login attempt, UserID is 0 when the username did not match any user
+type OLoginHistory struct {
+	UID       int          `json:"uid" gorm:"primaryKey;autoIncrement"`
+	UserID    int          `json:"user_id" gorm:"index;default:0"`
+	Username  string       `json:"username" gorm:"type:varchar(150)"`
+	IPAddress string       `json:"ip_address" gorm:"type:varchar(45);index"`
+	UserAgent string       `json:"user_agent" gorm:"type:varchar(250)"`
+	Outcome   LoginOutcome `json:"outcome" gorm:"not null;comment:1-success, 2-failed, 3-locked"`
+	Reason    string       `json:"reason" gorm:"type:varchar(100)"`
+	LoginDate time.Time    `json:"login_date" gorm:"autoCreateTime;type:datetime"`
+}
+
+// TableName specifies the table name for the OLoginHistory model.
+func (OLoginHistory) TableName() string {
+	return "o_login_history"
+}
+
+// OLoginLock counts consecutive failed logins for a subject ("user:<uid>" or "ip:<address>")
+// and holds the time until which further attempts are refused
+type OLoginLock struct {
+	UID            int        `json:"uid" gorm:"primaryKey;autoIncrement"`
+	Subject        string     `json:"subject" gorm:"type:varchar(60);unique;not null"`
+	FailedAttempts int        `json:"failed_attempts" gorm:"default:0"`
+	Lockouts       int        `json:"lockouts" gorm:"default:0"`
+	LastFailure    time.Time  `json:"last_failure" gorm:"type:datetime"`
+	LockedUntil    *time.Time `json:"locked_until" gorm:"type:datetime"`
+}
+
+// TableName specifies the table name for the OLoginLock model.
+func (OLoginLock) TableName() string {
+	return "o_login_locks"
+}
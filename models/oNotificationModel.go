@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+type NotificationStatus int
+
+const (
+	DeletedNotification NotificationStatus = iota
+	UnreadNotification  NotificationStatus = 1
+	ReadNotification    NotificationStatus = 2
+)
+
+type ONotification struct {
+	UID       int                `json:"uid" gorm:"primaryKey;autoIncrement"`
+	UserID    int                `json:"user_id" gorm:"not null"`
+	Subject   string             `json:"subject" gorm:"type:varchar(100);not null"`
+	Message   string             `json:"message" gorm:"type:text;not null"`
+	AddedDate time.Time          `json:"added_date" gorm:"autoCreateTime;type:datetime"`
+	ReadDate  *time.Time         `json:"read_date" gorm:"type:datetime"`
+	Status    NotificationStatus `json:"status" gorm:"default:1"`
+}
+
+// TableName specifies the table name for the ONotification model.
+func (ONotification) TableName() string {
+	return "o_notifications"
+}
@@ -1,11 +1,22 @@
 package models
 
+import "time"
+
+type PassResetStatus int
+
+const (
+	NoPassReset      PassResetStatus = 0
+	PendingPassReset PassResetStatus = 1
+	UsedPassReset    PassResetStatus = 2
+)
+
 type OPass struct {
-	UID            int    `json:"uid" gorm:"primaryKey;autoIncrement"`
-	User           int    `json:"user" gorm:"unique;not null"`
-	Pass           string `json:"pass" gorm:"type:varchar(200);not null"`
-	PassResetToken string `json:"pass_reset_token" gorm:"type:varchar(255)"`
-	ResetStatus    int    `json:"reset_status" gorm:"default:0"`
+	UID            int             `json:"uid" gorm:"primaryKey;autoIncrement"`
+	User           int             `json:"user" gorm:"unique;not null"`
+	Pass           string          `json:"pass" gorm:"type:varchar(200);not null"`
+	PassResetToken string          `json:"pass_reset_token" gorm:"type:varchar(255)"`
+	ResetExpiry    *time.Time      `json:"reset_expiry" gorm:"type:datetime"`
+	ResetStatus    PassResetStatus `json:"reset_status" gorm:"default:0"`
 }
 
 // TableName specifies the table name for the Pass struct
@@ -1,16 +1,19 @@
 package models
 
+// OPermission grants actions on a table to a user group (UserID 0) or to a single user.
+// Rec 0 applies to the whole table, otherwise only to the record with that uid.
 type OPermission struct {
 	UID     int    `json:"uid" gorm:"primaryKey;autoIncrement"`
 	GroupID int    `json:"group_id" gorm:"not null"`
 	UserID  int    `json:"user_id" gorm:"not null"`
 	Tbl     string `json:"tbl" gorm:"type:varchar(50);not null"`
 	Rec     int    `json:"rec" gorm:"not null"`
-	General int    `json:"general" gorm:"default:0"`
-	Create  int    `json:"create" gorm:"default:0"`
-	Read    int    `json:"read" gorm:"default:0"`
-	Update  int    `json:"update" gorm:"default:0"`
-	Delete  int    `json:"delete" gorm:"default:0"`
-	Block   int    `json:"block" gorm:"default:0"`
-	Unblock int    `json:"unblock" gorm:"default:0"`
+	General int    `json:"general" gorm:"column:general_;default:0"`
+	Create  int    `json:"create" gorm:"column:create_;default:0"`
+	Read    int    `json:"read" gorm:"column:read_;default:0"`
+	Update  int    `json:"update" gorm:"column:update_;default:0"`
+	Delete  int    `json:"delete" gorm:"column:delete_;default:0"`
+	Block   int    `json:"block" gorm:"column:block_;default:0"`
+	Unblock int    `json:"unblock" gorm:"column:unblock_;default:0"`
+	Export  int    `json:"export" gorm:"column:export_;default:0"`
 }
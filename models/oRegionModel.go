@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// ORegion groups branches, its manager sees every branch in the region
+type ORegion struct {
+	UID         int       `json:"uid" gorm:"primaryKey;autoIncrement"`
+	Name        string    `json:"name" gorm:"type:varchar(50);not null"`
+	Description string    `json:"description" gorm:"type:varchar(250)"`
+	ManagerID   int       `json:"manager_id" gorm:"default:0;index"`
+	AddedDate   time.Time `json:"added_date" gorm:"autoCreateTime;type:datetime"`
+	Status      int       `json:"status" gorm:"default:1;comment:1-active, 0-deleted"`
+}
+
+// TableName specifies the table name for the ORegion model.
+func (ORegion) TableName() string {
+	return "o_regions"
+}
@@ -2,12 +2,17 @@ package models
 
 import "time"
 
+// OStaffBranch gives a staff member access to a branch besides their home branch.
+// The assignment is in effect from StartDate to EndDate inclusive, open ended when they are not set.
 type OStaffBranch struct {
-	UID       int       `json:"uid" gorm:"primaryKey;autoIncrement"`
-	Agent     int       `json:"agent" gorm:"not null"`
-	Branch    int       `json:"branch" gorm:"not null"`
-	AddedDate time.Time `json:"added_date" gorm:"autoCreateTime;type:datetime"`
-	Status    int       `json:"status" gorm:"default:1"`
+	UID       int        `json:"uid" gorm:"primaryKey;autoIncrement"`
+	Agent     int        `json:"agent" gorm:"not null"`
+	Branch    int        `json:"branch" gorm:"not null"`
+	StartDate *time.Time `json:"start_date" gorm:"type:date"`
+	EndDate   *time.Time `json:"end_date" gorm:"type:date"`
+	AddedBy   int        `json:"added_by" gorm:"default:0"`
+	AddedDate time.Time  `json:"added_date" gorm:"autoCreateTime;type:datetime"`
+	Status    int        `json:"status" gorm:"default:1"`
 }
 
 // TableName specifies the table name for the OStaffBranch model.
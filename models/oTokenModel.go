@@ -2,16 +2,33 @@ package models
 
 import "time"
 
+type TokenStatus int
+
+const (
+	ValidToken   TokenStatus = 1
+	ExpiredToken TokenStatus = 2
+	RevokedToken TokenStatus = 3
+)
+
+// OToken is a login session, Token holds the sha256 hash of the session's refresh token
 type OToken struct {
-	UID          uint      `gorm:"primaryKey;autoIncrement"`
-	UserID       int       `gorm:"not null"`
-	Token        string    `gorm:"type:vachar(245);not null"`
-	CreationDate time.Time `gorm:"autoCreateTime;type:datetime"`
-	ExpiryDate   time.Time `gorm:"type:datetime"`
-	DeviceID     string    `gorm:"type:vachar(245)"`
-	BrowserName  string    `gorm:"type:vachar(250)"`
-	IPAddress    string    `gorm:"type:vachar(45)"`
-	OS           string    `gorm:"type:vachar(55)"`
-	Usages       int       `gorm:"default:0"`
-	Status       int       `gorm:"default:1;comment:1-valid, 2-expired"`
+	UID          uint        `gorm:"primaryKey;autoIncrement"`
+	UserID       int         `gorm:"not null"`
+	Token        string      `gorm:"type:varchar(245);not null"`
+	PrevToken    string      `gorm:"type:varchar(245);index;comment:hash of the refresh token rotated out last"`
+	Scope        string      `gorm:"type:varchar(100)"`
+	CreationDate time.Time   `gorm:"autoCreateTime;type:datetime"`
+	ExpiryDate   time.Time   `gorm:"type:datetime"`
+	DeviceID     string      `gorm:"type:varchar(245)"`
+	BrowserName  string      `gorm:"type:varchar(250)"`
+	IPAddress    string      `gorm:"type:varchar(45)"`
+	OS           string      `gorm:"type:varchar(55)"`
+	Usages       int         `gorm:"default:0"`
+	LastUsed     *time.Time  `gorm:"type:datetime"`
+	Status       TokenStatus `gorm:"default:1;comment:1-valid, 2-expired, 3-revoked"`
+}
+
+// TableName specifies the table name for the OToken model.
+func (OToken) TableName() string {
+	return "o_tokens"
 }
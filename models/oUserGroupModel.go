@@ -5,5 +5,6 @@ type OUserGroup struct {
 	Name        string `json:"name" gorm:"type:varchar(30)"`
 	Description string `json:"description" gorm:"type:varchar(250)"`
 	KPIMeasured int    `json:"kpi_measured" gorm:"default:1"`
+	Require2FA  int    `json:"require_2fa" gorm:"column:require_2fa;default:0"`
 	Status      int    `json:"status" gorm:"default:1"`
 }
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+type InviteStatus int
+
+const (
+	PendingInvite   InviteStatus = 1
+	AcceptedInvite  InviteStatus = 2
+	CancelledInvite InviteStatus = 3
+)
+
+// OUserInvite is a one-time activation link sent to a staff member created by an admin,
+// only the sha256 hash of the token is stored
+type OUserInvite struct {
+	UID          int          `json:"uid" gorm:"primaryKey;autoIncrement"`
+	UserID       int          `json:"user_id" gorm:"not null;index"`
+	TokenHash    string       `json:"-" gorm:"type:varchar(70);not null;index"`
+	Channel      string       `json:"channel" gorm:"type:varchar(10)"`
+	ExpiryDate   time.Time    `json:"expiry_date" gorm:"type:datetime"`
+	InvitedBy    int          `json:"invited_by" gorm:"default:0"`
+	AddedDate    time.Time    `json:"added_date" gorm:"autoCreateTime;type:datetime"`
+	AcceptedDate *time.Time   `json:"accepted_date" gorm:"type:datetime"`
+	Status       InviteStatus `json:"status" gorm:"default:1;comment:1-pending, 2-accepted, 3-cancelled"`
+}
+
+// TableName specifies the table name for the OUserInvite model.
+func (OUserInvite) TableName() string {
+	return "o_user_invites"
+}
@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+type TwoFactorMethod string
+
+const (
+	TOTPTwoFactor  TwoFactorMethod = "totp"
+	SMSTwoFactor   TwoFactorMethod = "sms"
+	EmailTwoFactor TwoFactorMethod = "email"
+)
+
+// OUserTwoFactor is a user's second factor. Secret is the base32 TOTP secret, or the hash of
+// the pending enrolment code for sms/email. RecoveryCodes holds comma separated sha256 hashes.
+// SetupExpiry and SetupAttempts limit how long and how often a pending setup can be confirmed.
+type OUserTwoFactor struct {
+	UID           int             `json:"uid" gorm:"primaryKey;autoIncrement"`
+	UserID        int             `json:"user_id" gorm:"unique;not null"`
+	Method        TwoFactorMethod `json:"method" gorm:"type:varchar(10);not null"`
+	Secret        string          `json:"-" gorm:"type:varchar(100)"`
+	RecoveryCodes string          `json:"-" gorm:"type:text"`
+	LastUsedStep  int64           `json:"-" gorm:"default:0"`
+	SetupExpiry   *time.Time      `json:"-" gorm:"type:datetime"`
+	SetupAttempts int             `json:"-" gorm:"default:0"`
+	AddedDate     time.Time       `json:"added_date" gorm:"autoCreateTime;type:datetime"`
+	Enabled       int             `json:"enabled" gorm:"default:0"`
+}
+
+// TableName specifies the table name for the OUserTwoFactor model.
+func (OUserTwoFactor) TableName() string {
+	return "o_user_two_factors"
+}
+
+type LoginChallengeStatus int
+
+const (
+	PendingLoginChallenge   LoginChallengeStatus = 1
+	CompletedLoginChallenge LoginChallengeStatus = 2
+	FailedLoginChallenge    LoginChallengeStatus = 3
+)
+
+// OLoginChallenge is a login waiting for its second factor, Token and Code hold sha256 hashes
+type OLoginChallenge struct {
+	UID        int                  `json:"uid" gorm:"primaryKey;autoIncrement"`
+	UserID     int                  `json:"user_id" gorm:"not null"`
+	Token      string               `json:"-" gorm:"type:varchar(70);not null"`
+	Method     TwoFactorMethod      `json:"method" gorm:"type:varchar(10);not null"`
+	Code       string               `json:"-" gorm:"type:varchar(70)"`
+	AddedDate  time.Time            `json:"added_date" gorm:"autoCreateTime;type:datetime"`
+	ExpiryDate time.Time            `json:"expiry_date" gorm:"type:datetime"`
+	Attempts   int                  `json:"attempts" gorm:"default:0"`
+	Status     LoginChallengeStatus `json:"status" gorm:"default:1"`
+}
+
+// TableName specifies the table name for the OLoginChallenge model.
+func (OLoginChallenge) TableName() string {
+	return "o_login_challenges"
+}
@@ -0,0 +1,22 @@
+package schemas
+
+type AgendaItemSchema struct {
+	ConversationUID int    `json:"conversationUid"`
+	CustomerID      int    `json:"customerId"`
+	FullName        string `json:"fullName"`
+	PrimaryMobile   string `json:"primaryMobile"`
+	AgentID         int    `json:"agentId"`
+	Branch          int    `json:"branch"`
+	LoanID          int    `json:"loanId"`
+	NextInteraction string `json:"nextInteraction"`
+	NextStep        string `json:"nextStep"`
+	Transcript      string `json:"transcript"`
+}
+
+type NotificationSchema struct {
+	UID       int    `json:"uid"`
+	Subject   string `json:"subject"`
+	Message   string `json:"message"`
+	AddedDate string `json:"addedDate"`
+	Status    int    `json:"status"`
+}
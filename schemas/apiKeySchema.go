@@ -0,0 +1,40 @@
+package schemas
+
+type ServiceAccountInputSchema struct {
+	Name      string `json:"name" binding:"required,min=3,max=50"`
+	Email     string `json:"email" binding:"required,email,max=50"`
+	UserGroup int    `json:"userGroup" binding:"required,gt=0"`
+	Branch    int    `json:"branch" binding:"required,gt=0"`
+}
+
+type ServiceAccountSchema struct {
+	UID        int    `json:"uid"`
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	UserGroup  string `json:"userGroup"`
+	Branch     int    `json:"branch"`
+	Status     int    `json:"status"`
+	ActiveKeys int    `json:"activeKeys"`
+}
+
+// ApiKeyInputSchema issues a key, AllowedIPs takes single addresses or CIDR ranges and is open to any address when empty
+type ApiKeyInputSchema struct {
+	Name       string   `json:"name" binding:"required,max=100"`
+	Scope      []string `json:"scope" binding:"required,min=1,dive,oneof=read write"`
+	AllowedIPs []string `json:"allowedIps" binding:"omitempty,max=20,dive,ip|cidr"`
+	ExpiryDays int      `json:"expiryDays" binding:"omitempty,min=1,max=730"`
+}
+
+type ApiKeySchema struct {
+	UID        int      `json:"uid"`
+	UserID     int      `json:"userId"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scope      []string `json:"scope"`
+	AllowedIPs []string `json:"allowedIps"`
+	ExpiryDate string   `json:"expiryDate"`
+	LastUsed   string   `json:"lastUsed"`
+	LastUsedIP string   `json:"lastUsedIp"`
+	AddedDate  string   `json:"addedDate"`
+	Status     string   `json:"status"`
+}
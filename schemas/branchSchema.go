@@ -0,0 +1,50 @@
+package schemas
+
+type BranchSchema struct {
+	UID                int    `json:"uid"`
+	Name               string `json:"name"`
+	Address            string `json:"address"`
+	RegionID           int    `json:"regionId"`
+	Region             string `json:"region"`
+	ManagerID          int    `json:"managerId"`
+	Manager            string `json:"manager"`
+	AssistantManagerID int    `json:"assistantManagerId"`
+	AssistantManager   string `json:"assistantManager"`
+	Status             int    `json:"status"`
+	AddedDate          string `json:"addedDate"`
+}
+
+type BranchInputSchema struct {
+	Name     string `json:"name" binding:"required,max=50"`
+	Address  string `json:"address" binding:"required,max=1000"`
+	RegionID int    `json:"regionId" binding:"gte=0"`
+}
+
+// BranchManagersSchema sets both managers of a branch, 0 leaves the position empty
+type BranchManagersSchema struct {
+	ManagerID          int `json:"managerId" binding:"gte=0"`
+	AssistantManagerID int `json:"assistantManagerId" binding:"gte=0"`
+}
+
+// BranchStatusSchema reopens (1), blocks (2) or deletes (0) a branch, blocked and deleted branches take no new customers or loans
+type BranchStatusSchema struct {
+	Status *int   `json:"status" binding:"required,oneof=0 1 2"`
+	Reason string `json:"reason" binding:"max=250"`
+}
+
+type RegionSchema struct {
+	UID         int    `json:"uid"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ManagerID   int    `json:"managerId"`
+	Manager     string `json:"manager"`
+	Branches    int    `json:"branches"`
+	Status      int    `json:"status"`
+	AddedDate   string `json:"addedDate"`
+}
+
+type RegionInputSchema struct {
+	Name        string `json:"name" binding:"required,max=50"`
+	Description string `json:"description" binding:"max=250"`
+	ManagerID   int    `json:"managerId" binding:"gte=0"`
+}
@@ -7,6 +7,7 @@ type GetCustomerContactsResultSchema struct {
 	ContactType int    `json:"contactType"`
 	Value       string `json:"value"`
 	LastUpdate  string `json:"lastUpdate"`
+	Verified    bool   `json:"verified"`
 }
 
 type GetCustomerContactResultSchema struct {
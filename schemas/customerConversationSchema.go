@@ -0,0 +1,16 @@
+package schemas
+
+type ConversationSearchResultSchema struct {
+	UID                int     `json:"uid"`
+	CustomerID         int     `json:"customerId"`
+	FullName           string  `json:"fullName"`
+	Branch             int     `json:"branch"`
+	AgentID            int     `json:"agentId"`
+	ConversationMethod int     `json:"conversationMethod"`
+	Outcome            int     `json:"outcome"`
+	Flag               int     `json:"flag"`
+	Transcript         string  `json:"transcript"`
+	ConversationDate   string  `json:"conversationDate"`
+	NextInteraction    string  `json:"nextInteraction"`
+	Relevance          float64 `json:"relevance"`
+}
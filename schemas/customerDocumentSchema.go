@@ -0,0 +1,23 @@
+package schemas
+
+// CustomerDocumentInputSchema is the form sent along with the file in a multipart upload
+type CustomerDocumentInputSchema struct {
+	DocumentType string `form:"documentType" binding:"required,oneof=passport_photo id_front id_back other"`
+	Description  string `form:"description" binding:"max=250"`
+}
+
+type CustomerDocumentSchema struct {
+	UID          int    `json:"uid"`
+	DocumentType string `json:"documentType"`
+	FileName     string `json:"fileName"`
+	MimeType     string `json:"mimeType"`
+	Size         int64  `json:"size"`
+	Checksum     string `json:"checksum"`
+	HasThumbnail bool   `json:"-"`
+	Description  string `json:"description"`
+	UploadedBy   string `json:"uploadedBy"`
+	UploadedDate string `json:"uploadedDate"`
+	Status       int    `json:"status"`
+	URL          string `json:"url" gorm:"-"`
+	ThumbnailURL string `json:"thumbnailUrl,omitempty" gorm:"-"`
+}
@@ -0,0 +1,84 @@
+package schemas
+
+// CustomerOverviewSchema is everything the customer page shows, sections left out of include= stay empty
+type CustomerOverviewSchema struct {
+	Profile      *GetCustomerResultSchema            `json:"profile,omitempty"`
+	Loans        *ActiveLoansSummarySchema           `json:"loans,omitempty"`
+	Repayments   *RepaymentBehaviourSchema           `json:"repayments,omitempty"`
+	Contacts     []GetCustomerContactsResultSchema   `json:"contacts,omitempty"`
+	Referees     []GetRefereeResultSchema            `json:"referees,omitempty"`
+	Guarantors   []GetCustomerGuarantorsResultSchema `json:"guarantors,omitempty"`
+	Interactions []OverviewInteractionSchema         `json:"interactions,omitempty"`
+	Flags        []OverviewFlagSchema                `json:"flags,omitempty"`
+	Events       []OverviewEventSchema               `json:"events,omitempty"`
+	Included     []string                            `json:"included"`
+}
+
+type ActiveLoansSummarySchema struct {
+	Count          int                  `json:"count"`
+	TotalPrincipal float64              `json:"totalPrincipal"`
+	TotalBalance   float64              `json:"totalBalance"`
+	NextDueDate    string               `json:"nextDueDate"`
+	Loans          []OverviewLoanSchema `json:"loans"`
+}
+
+type OverviewLoanSchema struct {
+	UID                     int     `json:"uid"`
+	LoanCode                string  `json:"loanCode"`
+	Product                 string  `json:"product"`
+	LoanAmount              float64 `json:"loanAmount"`
+	TotalRepayableAmount    float64 `json:"totalRepayableAmount"`
+	TotalRepaid             float64 `json:"totalRepaid"`
+	LoanBalance             float64 `json:"loanBalance"`
+	CurrentInstalmentAmount float64 `json:"currentInstalmentAmount"`
+	GivenDate               string  `json:"givenDate"`
+	NextDueDate             string  `json:"nextDueDate"`
+	FinalDueDate            string  `json:"finalDueDate"`
+	Status                  int     `json:"status"`
+}
+
+// RepaymentBehaviourSchema sums up how the customer has repaid their loans so far.
+// OnTimeRate is the share of cleared loans repaid by their final due date, 0 to 1.
+type RepaymentBehaviourSchema struct {
+	TotalLoans     int     `json:"totalLoans"`
+	ClearedLoans   int     `json:"clearedLoans"`
+	ClearedOnTime  int     `json:"clearedOnTime"`
+	OnTimeRate     float64 `json:"onTimeRate"`
+	OverdueLoans   int     `json:"overdueLoans"`
+	MissedPayments int     `json:"missedPayments"`
+	WrittenOff     int     `json:"writtenOff"`
+	TotalBorrowed  float64 `json:"totalBorrowed"`
+	TotalRepaid    float64 `json:"totalRepaid"`
+	LastPayDate    string  `json:"lastPayDate"`
+}
+
+type OverviewInteractionSchema struct {
+	UID              int    `json:"uid"`
+	Agent            string `json:"agent"`
+	Method           string `json:"method"`
+	LoanID           int    `json:"loanId"`
+	Outcome          int    `json:"outcome"`
+	Flag             int    `json:"flag"`
+	Transcript       string `json:"transcript"`
+	ConversationDate string `json:"conversationDate"`
+	NextInteraction  string `json:"nextInteraction"`
+}
+
+// OverviewFlagSchema is a flag raised on the customer or on one of their open loans, Source says which
+type OverviewFlagSchema struct {
+	UID         int    `json:"uid"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ColorCode   string `json:"colorCode"`
+	Source      string `json:"source"`
+	LoanID      int    `json:"loanId,omitempty"`
+}
+
+type OverviewEventSchema struct {
+	UID          int    `json:"uid"`
+	Tbl          string `json:"tbl"`
+	Fld          int    `json:"fld"`
+	EventDetails string `json:"eventDetails"`
+	EventDate    string `json:"eventDate"`
+	EventBy      string `json:"eventBy"`
+}
@@ -48,3 +48,69 @@ type GetCustomerResultSchema struct {
 	BadgeDescription string `json:"badgeDescription"`
 	Status           string `json:"status"`
 }
+
+// CustomerReassignSchema picks customers by filter or by UIDs and moves them to ToAgent.
+// With IncludeLoans the open loans follow, with DryRun nothing is changed and only the counts are returned.
+type CustomerReassignSchema struct {
+	Branch       int    `json:"branch" binding:"gte=0"`
+	Agent        int    `json:"agent" binding:"gte=0"`
+	Status       *int   `json:"status" binding:"omitempty,oneof=0 1 2 3 4"`
+	Flag         int    `json:"flag" binding:"gte=0"`
+	UIDs         []int  `json:"uids" binding:"omitempty,max=10000,dive,gt=0"`
+	ToAgent      int    `json:"toAgent" binding:"required,gt=0"`
+	IncludeLoans bool   `json:"includeLoans"`
+	DryRun       bool   `json:"dryRun"`
+	Reason       string `json:"reason" binding:"max=250"`
+}
+
+type CustomerReassignPreviewSchema struct {
+	UID          int    `json:"uid"`
+	FullName     string `json:"fullName"`
+	Branch       string `json:"branch"`
+	CurrentAgent string `json:"currentAgent"`
+}
+
+type CustomerReassignResultSchema struct {
+	Customers int64 `json:"customers"`
+	Loans     int64 `json:"loans"`
+	Batches   int   `json:"batches"`
+}
+
+// CustomerErasureSchema is a data subject's request to have their personal data erased
+type CustomerErasureSchema struct {
+	Reason    string `json:"reason" binding:"required,max=250"`
+	Reference string `json:"reference" binding:"max=100"`
+}
+
+// PossibleDuplicateSchema is a customer that may be the same person, Score runs from 0 to 1
+type PossibleDuplicateSchema struct {
+	UID           int      `json:"uid"`
+	FullName      string   `json:"fullName"`
+	PrimaryMobile string   `json:"primaryMobile"`
+	NationalID    string   `json:"nationalId"`
+	Dob           string   `json:"dob"`
+	BranchID      int      `json:"branchId"`
+	Branch        string   `json:"branch"`
+	Status        string   `json:"status"`
+	Score         float64  `json:"score"`
+	Reasons       []string `json:"reasons"`
+}
+
+// CustomerMergeSchema merges DuplicateID into the customer in the path, who survives
+type CustomerMergeSchema struct {
+	DuplicateID int    `json:"duplicateId" binding:"required,gt=0"`
+	Reason      string `json:"reason" binding:"required,max=250"`
+}
+
+// CustomerImportRowSchema is the outcome of one spreadsheet row, Row counts from 1 like the spreadsheet does
+type CustomerImportRowSchema struct {
+	Row        int      `json:"row"`
+	Status     string   `json:"status"`
+	CustomerID int      `json:"customerId,omitempty"`
+	Errors     []string `json:"errors,omitempty"`
+}
+
+type CustomerImportReportSchema struct {
+	IgnoredColumns []string                  `json:"ignoredColumns"`
+	Rows           []CustomerImportRowSchema `json:"rows"`
+}
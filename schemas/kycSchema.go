@@ -0,0 +1,40 @@
+package schemas
+
+type KycRequirementSchema struct {
+	UID                     int    `json:"uid"`
+	ProductID               int    `json:"productId"`
+	Product                 string `json:"product"`
+	RequireNationalID       bool   `json:"requireNationalId"`
+	RequirePhoto            bool   `json:"requirePhoto"`
+	MinReferees             int    `json:"minReferees"`
+	MinGuarantors           int    `json:"minGuarantors"`
+	RequireVerifiedContacts bool   `json:"requireVerifiedContacts"`
+	UpdatedBy               string `json:"updatedBy"`
+	UpdatedDate             string `json:"updatedDate"`
+}
+
+type KycRequirementInputSchema struct {
+	RequireNationalID       bool `json:"requireNationalId"`
+	RequirePhoto            bool `json:"requirePhoto"`
+	MinReferees             int  `json:"minReferees" binding:"gte=0,lte=10"`
+	MinGuarantors           int  `json:"minGuarantors" binding:"gte=0,lte=10"`
+	RequireVerifiedContacts bool `json:"requireVerifiedContacts"`
+}
+
+// KycCheckSchema is one item of the checklist, Actual is what the customer has against Expected
+type KycCheckSchema struct {
+	Key      string `json:"key"`
+	Label    string `json:"label"`
+	Expected int    `json:"expected"`
+	Actual   int    `json:"actual"`
+	Passed   bool   `json:"passed"`
+}
+
+type KycStatusSchema struct {
+	CustomerID int              `json:"customerId"`
+	ProductID  int              `json:"productId"`
+	Status     int              `json:"status"`
+	Complete   bool             `json:"complete"`
+	Checks     []KycCheckSchema `json:"checks"`
+	Missing    []string         `json:"missing"`
+}
@@ -10,13 +10,115 @@ type UserSchema struct {
 }
 
 type UserTokenSchema struct {
-	Token     string   `json:"token"`
-	ExpiresIn int      `json:"expiresIn"`
-	TokenType string   `json:"tokenType"`
-	Scope     []string `json:"scope"`
+	Token            string   `json:"token"`
+	ExpiresIn        int      `json:"expiresIn"`
+	TokenType        string   `json:"tokenType"`
+	Scope            []string `json:"scope"`
+	RefreshToken     string   `json:"refreshToken,omitempty"`
+	RefreshExpiresIn int      `json:"refreshExpiresIn,omitempty"`
+}
+
+type ForgotPasswordSchema struct {
+	EmailOrPhone string `json:"emailOrPhone" binding:"required"`
+	Channel      string `json:"channel" binding:"omitempty,oneof=sms email"`
+}
+
+type ResetPasswordSchema struct {
+	EmailOrPhone string `json:"emailOrPhone" binding:"required"`
+	Token        string `json:"token" binding:"required"`
+	NewPassword  string `json:"newPassword" binding:"required,min=6"`
+}
+
+type ChangePasswordSchema struct {
+	OldPassword string `json:"oldPassword" binding:"required"`
+	NewPassword string `json:"newPassword" binding:"required,min=6"`
+}
+
+type RefreshTokenSchema struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
 }
 
 type UserLoginSchema struct {
 	EmailOrPhone string `json:"emailOrPhone" binding:"required"`
 	Password     string `json:"password" binding:"required"`
 }
+
+type SessionSchema struct {
+	UID          uint   `json:"uid"`
+	DeviceID     string `json:"deviceId"`
+	BrowserName  string `json:"browserName"`
+	IPAddress    string `json:"ipAddress"`
+	OS           string `json:"os"`
+	CreationDate string `json:"creationDate"`
+	LastUsed     string `json:"lastUsed"`
+	ExpiryDate   string `json:"expiryDate"`
+	Current      bool   `json:"current"`
+}
+
+type TwoFactorVerifySchema struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+type TwoFactorSetupSchema struct {
+	Method string `json:"method" binding:"required,oneof=totp sms email"`
+}
+
+type TwoFactorCodeSchema struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TwoFactorPasswordSchema struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type LoginHistorySchema struct {
+	UID       int    `json:"uid"`
+	Username  string `json:"username"`
+	IPAddress string `json:"ipAddress"`
+	UserAgent string `json:"userAgent"`
+	Outcome   int    `json:"outcome"`
+	Reason    string `json:"reason"`
+	LoginDate string `json:"loginDate"`
+}
+
+type ReadOnlyTokenSchema struct {
+	Name    string `json:"name" binding:"required,max=100"`
+	TTLDays int    `json:"ttlDays" binding:"omitempty,min=1,max=365"`
+}
+
+// UserSignupSchema is a self-registration, the account stays pending without a group until an admin approves it
+type UserSignupSchema struct {
+	Name       string `json:"name" binding:"required,min=3,max=50"`
+	Email      string `json:"email" binding:"required,email,max=50"`
+	Phone      string `json:"phone" binding:"required,numeric,min=10,max=12"`
+	NationalID string `json:"nationalId" binding:"required,numeric,min=6,max=15"`
+	Password   string `json:"password" binding:"required,min=6"`
+}
+
+// UserApprovalSchema activates a pending user, Branches are extra branches on top of the home Branch
+type UserApprovalSchema struct {
+	UserGroup int   `json:"userGroup" binding:"required,gt=0"`
+	Branch    int   `json:"branch" binding:"required,gt=0"`
+	Branches  []int `json:"branches" binding:"omitempty,dive,gt=0"`
+}
+
+type UserRejectionSchema struct {
+	Reason string `json:"reason" binding:"max=250"`
+}
+
+type UserInviteSchema struct {
+	Name       string `json:"name" binding:"required,min=3,max=50"`
+	Email      string `json:"email" binding:"required,email,max=50"`
+	Phone      string `json:"phone" binding:"required,numeric,min=10,max=12"`
+	NationalID string `json:"nationalId" binding:"omitempty,numeric,min=6,max=15"`
+	UserGroup  int    `json:"userGroup" binding:"required,gt=0"`
+	Branch     int    `json:"branch" binding:"required,gt=0"`
+	Branches   []int  `json:"branches" binding:"omitempty,dive,gt=0"`
+	Channel    string `json:"channel" binding:"omitempty,oneof=sms email"`
+}
+
+type ActivateAccountSchema struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
@@ -0,0 +1,44 @@
+package schemas
+
+type UserGroupSchema struct {
+	UID         int    `json:"uid"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	KPIMeasured int    `json:"kpiMeasured"`
+	Require2FA  int    `json:"require2fa"`
+	Status      int    `json:"status"`
+	Users       int    `json:"users"`
+}
+
+type UserGroupInputSchema struct {
+	Name        string `json:"name" binding:"required,max=30"`
+	Description string `json:"description" binding:"max=250"`
+	KPIMeasured *int   `json:"kpiMeasured" binding:"omitempty,oneof=0 1"`
+	Require2FA  *int   `json:"require2fa" binding:"omitempty,oneof=0 1"`
+}
+
+// PermissionGrantSchema grants or revokes actions on a table for a group or a single user, Rec > 0 limits it to one record
+type PermissionGrantSchema struct {
+	GroupID int      `json:"groupId"`
+	UserID  int      `json:"userId"`
+	Tbl     string   `json:"tbl" binding:"required,max=50"`
+	Rec     int      `json:"rec" binding:"gte=0"`
+	Actions []string `json:"actions" binding:"dive,oneof=general_ create_ read_ update_ delete_ block_ unblock_ export_"`
+}
+
+type PermissionRowSchema struct {
+	UID     int             `json:"uid"`
+	GroupID int             `json:"groupId"`
+	UserID  int             `json:"userId"`
+	Tbl     string          `json:"tbl"`
+	Rec     int             `json:"rec"`
+	Actions map[string]bool `json:"actions"`
+}
+
+// PermissionExplainSchema is one table or record of a user's effective permissions and where they come from
+type PermissionExplainSchema struct {
+	Tbl     string          `json:"tbl"`
+	Rec     int             `json:"rec"`
+	Source  string          `json:"source"`
+	Actions map[string]bool `json:"actions"`
+}
@@ -0,0 +1,44 @@
+package schemas
+
+// StaffBranchInputSchema assigns a branch from StartDate to EndDate (YYYY-MM-DD), either may be left open
+type StaffBranchInputSchema struct {
+	Branch    int    `json:"branch" binding:"required,gt=0"`
+	StartDate string `json:"startDate" binding:"omitempty,datetime=2006-01-02"`
+	EndDate   string `json:"endDate" binding:"omitempty,datetime=2006-01-02"`
+}
+
+type StaffBranchSchema struct {
+	UID        int    `json:"uid"`
+	Agent      int    `json:"agent"`
+	AgentName  string `json:"agentName"`
+	Branch     int    `json:"branch"`
+	BranchName string `json:"branchName"`
+	StartDate  string `json:"startDate"`
+	EndDate    string `json:"endDate"`
+	AddedDate  string `json:"addedDate"`
+	Status     int    `json:"status"`
+	Active     bool   `json:"active"`
+}
+
+type BranchStaffSchema struct {
+	UID        int    `json:"uid"`
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	UserGroup  string `json:"userGroup"`
+	HomeBranch bool   `json:"homeBranch"`
+	StartDate  string `json:"startDate"`
+	EndDate    string `json:"endDate"`
+}
+
+// PortfolioTransferSchema moves a staff member's customers and open loans to ToUserID, Branch > 0 limits it to one branch
+type PortfolioTransferSchema struct {
+	ToUserID int    `json:"toUserId" binding:"required,gt=0"`
+	Branch   int    `json:"branch" binding:"gte=0"`
+	Reason   string `json:"reason" binding:"max=250"`
+}
+
+type PortfolioTransferResultSchema struct {
+	Customers int64 `json:"customers"`
+	LoansAsLO int64 `json:"loansAsLo"`
+	LoansAsCO int64 `json:"loansAsCo"`
+}
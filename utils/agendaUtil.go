@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FollowUpsQueryBuilder selects open follow-ups i.e the latest active conversation of each customer
+// whose next_interaction falls between from and to (inclusive, YYYY-MM-DD)
+func FollowUpsQueryBuilder(db *gorm.DB, agent int, from, to string) *gorm.DB {
+	query := db.Table("o_customer_conversations cc")
+	query = query.Select("cc.uid AS conversation_uid, cc.customer_id, c.full_name, c.primary_mobile, cc.agent_id, cc.branch, cc.loan_id, DATE_FORMAT(cc.next_interaction, '%Y-%m-%d') AS next_interaction, ns.name AS next_step, cc.transcript")
+	query = query.Joins("INNER JOIN o_customers c ON c.uid = cc.customer_id")
+	query = query.Joins("LEFT JOIN o_next_steps ns ON ns.uid = cc.next_steps")
+	query = query.Where("cc.status = ?", models.ActiveConversation)
+	query = query.Where("cc.next_interaction BETWEEN ? AND ?", from, to)
+	query = query.Where("NOT EXISTS (SELECT 1 FROM o_customer_conversations f WHERE f.customer_id = cc.customer_id AND f.uid > cc.uid AND f.status = ?)", models.ActiveConversation)
+
+	if agent > 0 {
+		query = query.Where("cc.agent_id = ?", agent)
+	}
+
+	return query.Order("cc.next_interaction ASC, cc.uid ASC")
+}
+
+// agendaLookbackDays is how far back missed follow-ups are still carried on an agent's agenda
+func agendaLookbackDays() int {
+	days, err := strconv.Atoi(os.Getenv("AGENDA_LOOKBACK_DAYS"))
+	if err != nil || days <= 0 {
+		days = 30
+	}
+	return days
+}
+
+func fetchFollowUps(db *gorm.DB, agent int, from, to time.Time) ([]schemas.AgendaItemSchema, error) {
+	var items []schemas.AgendaItemSchema
+	err := FollowUpsQueryBuilder(db, agent, from.Format(DateFormat), to.Format(DateFormat)).Scan(&items).Error
+	for i := range items {
+		items[i].Transcript = TruncateString(items[i].Transcript, 100)
+	}
+	return items, err
+}
+
+// GetAgenda returns the follow-ups due on date and the missed ones still open from the previous days
+func GetAgenda(db *gorm.DB, agent int, date time.Time) ([]schemas.AgendaItemSchema, []schemas.AgendaItemSchema, error) {
+	due, err := fetchFollowUps(db, agent, date, date)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	overdue, err := fetchFollowUps(db, agent, date.AddDate(0, 0, -agendaLookbackDays()), date.AddDate(0, 0, -1))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return due, overdue, nil
+}
+
+// RunDailyAgenda notifies every agent of the day's follow-ups and escalates
+// the follow-ups missed on the previous day to the branch manager
+func RunDailyAgenda(date time.Time) {
+	db := inits.CurrentDB
+
+	due, err := fetchFollowUps(db, 0, date, date)
+	if err != nil {
+		fmt.Println("Error fetching agenda:", err)
+		return
+	}
+
+	dueByAgent := make(map[int][]schemas.AgendaItemSchema)
+	for _, item := range due {
+		if item.AgentID > 0 {
+			dueByAgent[item.AgentID] = append(dueByAgent[item.AgentID], item)
+		}
+	}
+
+	for agentID, items := range dueByAgent {
+		var agent models.OUser
+		if err := db.First(&agent, agentID).Error; err != nil || agent.Status != models.Active {
+			continue
+		}
+
+		var lines []string
+		for _, item := range items {
+			lines = append(lines, fmt.Sprintf("- %s (%s): %s", item.FullName, item.PrimaryMobile, item.NextStep))
+		}
+		message := fmt.Sprintf("You have %d follow-up(s) scheduled for %s:\n%s", len(items), date.Format(DateFormat), strings.Join(lines, "\n"))
+		NotifyUser(agent, "Today's follow-ups", message)
+	}
+
+	EscalateMissedFollowUps(date.AddDate(0, 0, -1))
+}
+
+// EscalateMissedFollowUps alerts branch managers of follow-ups that were due on date but never happened
+func EscalateMissedFollowUps(date time.Time) {
+	db := inits.CurrentDB
+
+	missed, err := fetchFollowUps(db, 0, date, date)
+	if err != nil {
+		fmt.Println("Error fetching missed follow-ups:", err)
+		return
+	}
+
+	missedByBranch := make(map[int][]schemas.AgendaItemSchema)
+	for _, item := range missed {
+		missedByBranch[item.Branch] = append(missedByBranch[item.Branch], item)
+	}
+
+	for branchID, items := range missedByBranch {
+		var branch models.OBranch
+		if err := db.First(&branch, branchID).Error; err != nil || branch.ManagerID == 0 {
+			fmt.Printf("No manager to escalate %d missed follow-up(s) in branch %d\n", len(items), branchID)
+			continue
+		}
+
+		var manager models.OUser
+		if err := db.First(&manager, branch.ManagerID).Error; err != nil {
+			fmt.Println("Error fetching branch manager:", err)
+			continue
+		}
+
+		var lines []string
+		for _, item := range items {
+			lines = append(lines, fmt.Sprintf("- %s (%s), agent %d", item.FullName, item.PrimaryMobile, item.AgentID))
+			LogEvent("o_customer_conversations", item.ConversationUID, fmt.Sprintf("Missed follow-up of %s escalated to branch manager %s(%d)", item.NextInteraction, manager.Name, manager.UID), 0)
+		}
+		message := fmt.Sprintf("%d follow-up(s) in %s were missed on %s:\n%s", len(items), branch.Name, date.Format(DateFormat), strings.Join(lines, "\n"))
+		NotifyUser(manager, "Missed follow-ups", message)
+	}
+}
+
+// StartAgendaScheduler runs RunDailyAgenda every day at AGENDA_RUN_TIME (HH:MM, Nairobi time, default 07:00)
+func StartAgendaScheduler() {
+	runAt, err := time.Parse("15:04", os.Getenv("AGENDA_RUN_TIME"))
+	if err != nil {
+		runAt, _ = time.Parse("15:04", "07:00")
+	}
+
+	for {
+		now := time.Now().In(loc)
+		next := time.Date(now.Year(), now.Month(), now.Day(), runAt.Hour(), runAt.Minute(), 0, 0, loc)
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+
+		time.Sleep(time.Until(next))
+		RunDailyAgenda(time.Now().In(loc))
+	}
+}
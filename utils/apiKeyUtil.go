@@ -0,0 +1,237 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidAPIKey = errors.New("api key is invalid, revoked or expired")
+var ErrAPIKeyIPNotAllowed = errors.New("api key is not allowed from this address")
+
+// apiKeyPrefix starts every key so that leaked keys are easy to spot
+const apiKeyPrefix = "sl_"
+
+// GenerateAPIKey returns a new key of the form sl_<8 char id>_<40 char secret> and its lookup prefix
+func GenerateAPIKey() (string, string) {
+	prefix := apiKeyPrefix + strings.ToLower(SecureRandomString(8))
+	return prefix + "_" + SecureRandomString(40), prefix
+}
+
+// apiKeyLookupPrefix extracts the lookup prefix from a presented key
+func apiKeyLookupPrefix(key string) string {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return ""
+	}
+	i := strings.LastIndex(key, "_")
+	if i <= len(apiKeyPrefix) {
+		return ""
+	}
+	return key[:i]
+}
+
+// APIKeyScope returns the scope of the key, keys always work on live data
+func APIKeyScope(apiKey models.OApiKey) []string {
+	return EffectiveScope(append([]string{CurrentDBScope}, splitList(apiKey.Scope)...))
+}
+
+// TrustedProxies are the proxies whose X-Forwarded-For header gives the client address, TRUSTED_PROXIES as a
+// comma separated list of IPs and CIDR ranges. Without it the header is ignored and the client address is the
+// peer's, anyone could otherwise pick the address that allow lists and login lockouts see.
+func TrustedProxies() []string {
+	proxies := splitList(os.Getenv("TRUSTED_PROXIES"))
+	if len(proxies) == 0 {
+		return nil
+	}
+	return proxies
+}
+
+// IPAllowed checks an address against a comma separated list of IPs and CIDR ranges, an empty list allows any address
+func IPAllowed(allowList string, ip string) bool {
+	if strings.TrimSpace(allowList) == "" {
+		return true
+	}
+
+	address := net.ParseIP(ip)
+	for _, entry := range strings.Split(allowList, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			if _, network, err := net.ParseCIDR(entry); err == nil && address != nil && network.Contains(address) {
+				return true
+			}
+			continue
+		}
+		if allowed := net.ParseIP(entry); allowed != nil && address != nil && allowed.Equal(address) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AuthenticateAPIKey checks a presented key and returns it with its active service account
+func AuthenticateAPIKey(key string, ip string) (models.OApiKey, models.OUser, error) {
+	var apiKey models.OApiKey
+	var user models.OUser
+
+	prefix := apiKeyLookupPrefix(key)
+	if prefix == "" {
+		return apiKey, user, ErrInvalidAPIKey
+	}
+
+	err := inits.CurrentDB.Where("prefix = ? AND status = ?", prefix, models.ActiveApiKey).First(&apiKey).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apiKey, user, ErrInvalidAPIKey
+		}
+		return apiKey, user, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(Sha256Hash(key))) != 1 {
+		return apiKey, user, ErrInvalidAPIKey
+	}
+	if apiKey.ExpiryDate != nil && apiKey.ExpiryDate.Before(time.Now()) {
+		return apiKey, user, ErrInvalidAPIKey
+	}
+	if !IPAllowed(apiKey.AllowedIPs, ip) {
+		return apiKey, user, ErrAPIKeyIPNotAllowed
+	}
+
+	err = inits.CurrentDB.Where("uid = ? AND account_type = ? AND status = ?", apiKey.UserID, models.ServiceAccount, models.Active).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apiKey, user, ErrInvalidAPIKey
+		}
+		return apiKey, user, err
+	}
+
+	return apiKey, user, nil
+}
+
+// TouchAPIKey records the key's last use, at most once a minute unless the address changed
+func TouchAPIKey(apiKey models.OApiKey, ip string) {
+	if apiKey.LastUsed != nil && time.Since(*apiKey.LastUsed) < time.Minute && apiKey.LastUsedIP == ip {
+		return
+	}
+
+	err := inits.CurrentDB.Model(&models.OApiKey{}).Where("uid = ?", apiKey.UID).
+		Updates(map[string]interface{}{"last_used": time.Now(), "last_used_ip": ip}).Error
+	if err != nil {
+		fmt.Println("Error updating api key last use:", err)
+	}
+}
+
+// LogAPIKeyRequest attributes a request made with an api key to its service account in o_events
+func LogAPIKeyRequest(c *gin.Context, apiKey models.OApiKey, user models.OUser) {
+	LogEvent("o_api_keys", apiKey.UID, fmt.Sprintf("%s %s (%d) by service account %s(%d) with key %s from %s", c.Request.Method, c.Request.URL.Path, c.Writer.Status(), user.Name, user.UID, apiKey.Prefix, c.ClientIP()), user.UID)
+}
+
+// IssueAPIKey stores a new key for the service account and returns it with the plain key, which is not kept
+func IssueAPIKey(user models.OUser, name string, scope []string, allowedIPs []string, expiry *time.Time, createdBy int) (models.OApiKey, string, error) {
+	key, prefix := GenerateAPIKey()
+
+	apiKey := models.OApiKey{
+		UserID:     user.UID,
+		Name:       TruncateString(name, 100),
+		Prefix:     prefix,
+		KeyHash:    Sha256Hash(key),
+		Scope:      strings.Join(scope, ","),
+		AllowedIPs: strings.Join(allowedIPs, ","),
+		ExpiryDate: expiry,
+		CreatedBy:  createdBy,
+		Status:     models.ActiveApiKey,
+	}
+
+	if err := inits.CurrentDB.Create(&apiKey).Error; err != nil {
+		return apiKey, "", err
+	}
+
+	return apiKey, key, nil
+}
+
+// RotateAPIKey replaces a key with a new one with the same settings and revokes the old key
+func RotateAPIKey(apiKey models.OApiKey, rotatedBy int) (models.OApiKey, string, error) {
+	var newKey models.OApiKey
+	var plainKey string
+
+	err := inits.CurrentDB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.OApiKey{}).Where("uid = ? AND status = ?", apiKey.UID, models.ActiveApiKey).Update("status", models.RevokedApiKey)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidAPIKey
+		}
+
+		key, prefix := GenerateAPIKey()
+		newKey = models.OApiKey{
+			UserID:     apiKey.UserID,
+			Name:       apiKey.Name,
+			Prefix:     prefix,
+			KeyHash:    Sha256Hash(key),
+			Scope:      apiKey.Scope,
+			AllowedIPs: apiKey.AllowedIPs,
+			ExpiryDate: apiKey.ExpiryDate,
+			CreatedBy:  rotatedBy,
+			Status:     models.ActiveApiKey,
+		}
+		plainKey = key
+		return tx.Create(&newKey).Error
+	})
+
+	return newKey, plainKey, err
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.In(loc).Format(DateTimeFormat)
+}
+
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// APIKeyRow is the listing of a key, the hash is never returned
+func APIKeyRow(apiKey models.OApiKey) schemas.ApiKeySchema {
+	status := "active"
+	if apiKey.Status == models.RevokedApiKey {
+		status = "revoked"
+	} else if apiKey.ExpiryDate != nil && apiKey.ExpiryDate.Before(time.Now()) {
+		status = "expired"
+	}
+
+	return schemas.ApiKeySchema{
+		UID:        apiKey.UID,
+		UserID:     apiKey.UserID,
+		Name:       apiKey.Name,
+		Prefix:     apiKey.Prefix,
+		Scope:      splitList(apiKey.Scope),
+		AllowedIPs: splitList(apiKey.AllowedIPs),
+		ExpiryDate: formatOptionalTime(apiKey.ExpiryDate),
+		LastUsed:   formatOptionalTime(apiKey.LastUsed),
+		LastUsedIP: apiKey.LastUsedIP,
+		AddedDate:  apiKey.AddedDate.In(loc).Format(DateTimeFormat),
+		Status:     status,
+	}
+}
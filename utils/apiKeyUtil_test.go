@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIPAllowed(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowList string
+		ip        string
+		want      bool
+	}{
+		{"empty list allows any address", "", "203.0.113.7", true},
+		{"blank list allows any address", "  ", "203.0.113.7", true},
+		{"exact address", "203.0.113.7", "203.0.113.7", true},
+		{"other address", "203.0.113.7", "203.0.113.8", false},
+		{"address in a list with spaces", "198.51.100.1, 203.0.113.7 ,10.0.0.1", "203.0.113.7", true},
+		{"inside a range", "10.20.0.0/16", "10.20.31.4", true},
+		{"outside a range", "10.20.0.0/16", "10.21.0.1", false},
+		{"range and address mixed", "10.20.0.0/16,203.0.113.7", "203.0.113.7", true},
+		{"ipv6 address", "2001:db8::1", "2001:db8::1", true},
+		{"ipv6 range", "2001:db8::/32", "2001:db8:1::5", true},
+		{"ipv4 mapped ipv6 matches ipv4 entry", "203.0.113.7", "::ffff:203.0.113.7", true},
+		{"invalid entries are skipped", "not-an-ip,10.0.0.0/33,203.0.113.7", "203.0.113.7", true},
+		{"only invalid entries allow nothing", "not-an-ip,,10.0.0.0/33", "203.0.113.7", false},
+		{"invalid client address", "10.0.0.0/8", "unknown", false},
+		{"empty client address", "203.0.113.7", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IPAllowed(tt.allowList, tt.ip); got != tt.want {
+				t.Errorf("IPAllowed(%q, %q) = %v, want %v", tt.allowList, tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPAllowedBehindProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const allowList = "203.0.113.7"
+	tests := []struct {
+		name          string
+		proxies       string
+		remoteAddr    string
+		forwardedFor  string
+		wantClientIP  string
+		wantIPAllowed bool
+	}{
+		{"no proxy, allowed peer", "", "203.0.113.7:5000", "", "203.0.113.7", true},
+		{"no proxy, spoofed header is ignored", "", "198.51.100.9:5000", "203.0.113.7", "198.51.100.9", false},
+		{"untrusted peer, spoofed header is ignored", "10.0.0.0/8", "198.51.100.9:5000", "203.0.113.7", "198.51.100.9", false},
+		{"trusted proxy forwards the client", "10.0.0.0/8", "10.1.2.3:5000", "203.0.113.7", "203.0.113.7", true},
+		{"trusted proxy forwards another client", "10.0.0.5", "10.0.0.5:5000", "198.51.100.9", "198.51.100.9", false},
+		{"client prepending to the header through the proxy", "10.0.0.0/8", "10.1.2.3:5000", "203.0.113.7, 198.51.100.9", "198.51.100.9", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRUSTED_PROXIES", tt.proxies)
+
+			r := gin.New()
+			if err := r.SetTrustedProxies(TrustedProxies()); err != nil {
+				t.Fatalf("SetTrustedProxies() error = %v", err)
+			}
+			var clientIP string
+			r.GET("/", func(c *gin.Context) {
+				clientIP = c.ClientIP()
+				if !IPAllowed(allowList, clientIP) {
+					c.Status(http.StatusUnauthorized)
+					return
+				}
+				c.Status(http.StatusOK)
+			})
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				request.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, request)
+
+			if clientIP != tt.wantClientIP {
+				t.Errorf("ClientIP() = %q, want %q", clientIP, tt.wantClientIP)
+			}
+			if allowed := recorder.Code == http.StatusOK; allowed != tt.wantIPAllowed {
+				t.Errorf("allowed = %v, want %v", allowed, tt.wantIPAllowed)
+			}
+		})
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{" , ", nil},
+		{"10.0.0.1", []string{"10.0.0.1"}},
+		{"10.0.0.0/8, 192.168.1.1", []string{"10.0.0.0/8", "192.168.1.1"}},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("TRUSTED_PROXIES", tt.value)
+		if got := TrustedProxies(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("TrustedProxies() with %q = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
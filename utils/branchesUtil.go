@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"errors"
+	"super-lender/models"
+
+	"gorm.io/gorm"
+)
+
+var ErrBranchClosed = errors.New("branch is blocked or deleted")
+
+// CheckBranchOpen returns ErrBranchClosed unless new customers and loans may be booked at the branch
+func CheckBranchOpen(db *gorm.DB, branchID int) error {
+	var branch models.OBranch
+	if err := db.Select("uid, status").First(&branch, branchID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrBranchClosed
+		}
+		return err
+	}
+	if branch.Status != models.ActiveBranch {
+		return ErrBranchClosed
+	}
+	return nil
+}
+
+// ManagedBranches returns the branches a user manages, directly or as the manager of their region
+func ManagedBranches(db *gorm.DB, userID int) ([]int, error) {
+	var branches []int
+	err := db.Table("o_branches b").
+		Joins("LEFT JOIN o_regions r ON r.uid = b.region_id AND r.status = 1").
+		Where("b.status != ? AND (b.manager_id = ? OR b.assistant_manager_id = ? OR r.manager_id = ?)", models.DeletedBranch, userID, userID, userID).
+		Pluck("b.uid", &branches).Error
+	return branches, err
+}
+
+func BranchesQueryBuilder(db *gorm.DB, status, region int, branches []int, searchTerm string) *gorm.DB {
+	query := db.Table("o_branches b")
+	query = query.Joins("LEFT JOIN o_regions r ON r.uid = b.region_id")
+	query = query.Joins("LEFT JOIN o_users m ON m.uid = b.manager_id")
+	query = query.Joins("LEFT JOIN o_users am ON am.uid = b.assistant_manager_id")
+	query = query.Select("b.uid, b.name, b.address, b.region_id, IFNULL(r.name, '') AS region, b.manager_id, IFNULL(m.name, '') AS manager, b.assistant_manager_id, IFNULL(am.name, '') AS assistant_manager, b.status, DATE_FORMAT(b.added_date, '%Y-%m-%d %H:%i:%s') AS added_date")
+
+	if status >= 0 {
+		query = query.Where("b.status = ?", status)
+	}
+	if region > 0 {
+		query = query.Where("b.region_id = ?", region)
+	}
+	if branches != nil {
+		query = query.Where("b.uid IN (?)", branches)
+	}
+	if searchTerm != "" {
+		query = query.Where("b.name LIKE ?", "%"+searchTerm+"%")
+	}
+
+	return query.Order("b.name ASC")
+}
+
+func RegionsQueryBuilder(db *gorm.DB) *gorm.DB {
+	query := db.Table("o_regions r")
+	query = query.Joins("LEFT JOIN o_users m ON m.uid = r.manager_id")
+	query = query.Select("r.uid, r.name, r.description, r.manager_id, IFNULL(m.name, '') AS manager, (SELECT COUNT(b.uid) FROM o_branches b WHERE b.region_id = r.uid AND b.status != ?) AS branches, r.status, DATE_FORMAT(r.added_date, '%Y-%m-%d %H:%i:%s') AS added_date", models.DeletedBranch)
+	query = query.Where("r.status = 1")
+
+	return query.Order("r.name ASC")
+}
@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+	"super-lender/models"
+	"super-lender/schemas"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// ConversationSearchFilter holds the transcript search term and the filters applied alongside it.
+// From and To are inclusive dates (YYYY-MM-DD), zero values mean no filter. Scope limits the
+// results to the interactions of customers the user may read.
+type ConversationSearchFilter struct {
+	Query      string
+	From       string
+	To         string
+	Agent      int
+	Method     int
+	Outcome    int
+	Flag       int
+	Scope      CustomerScope
+	PageNo     int
+	PageSize   int
+	CountLimit int
+}
+
+// ConversationSearcher searches interaction transcripts ranked by relevance
+type ConversationSearcher interface {
+	Search(filter ConversationSearchFilter) ([]schemas.ConversationSearchResultSchema, int64, error)
+}
+
+// MySQLConversationSearcher uses the FULLTEXT index ft_transcript on o_customer_conversations.transcript
+type MySQLConversationSearcher struct {
+	DB *gorm.DB
+}
+
+func (s MySQLConversationSearcher) query(filter ConversationSearchFilter, queryType string) *gorm.DB {
+	query := s.DB.Table("o_customer_conversations cc")
+	query = query.Joins("INNER JOIN o_customers c ON c.uid = cc.customer_id")
+
+	if queryType == "count" {
+		query = query.Select("cc.uid")
+	} else if filter.Query != "" {
+		query = query.Select("cc.uid, cc.customer_id, c.full_name, cc.branch, cc.agent_id, cc.conversation_method, cc.outcome, cc.flag, cc.transcript, DATE_FORMAT(cc.conversation_date, '%Y-%m-%d %H:%i:%s') AS conversation_date, DATE_FORMAT(cc.next_interaction, '%Y-%m-%d') AS next_interaction, MATCH(cc.transcript) AGAINST(? IN NATURAL LANGUAGE MODE) AS relevance", filter.Query)
+	} else {
+		query = query.Select("cc.uid, cc.customer_id, c.full_name, cc.branch, cc.agent_id, cc.conversation_method, cc.outcome, cc.flag, cc.transcript, DATE_FORMAT(cc.conversation_date, '%Y-%m-%d %H:%i:%s') AS conversation_date, DATE_FORMAT(cc.next_interaction, '%Y-%m-%d') AS next_interaction, 0 AS relevance")
+	}
+
+	// Apply search term
+	if filter.Query != "" {
+		query = query.Where("MATCH(cc.transcript) AGAINST(? IN NATURAL LANGUAGE MODE)", filter.Query)
+	}
+
+	// Apply filters
+	query = query.Where("cc.status = ?", models.ActiveConversation)
+	if filter.From != "" {
+		query = query.Where("cc.conversation_date >= ?", filter.From+" 00:00:00")
+	}
+	if filter.To != "" {
+		query = query.Where("cc.conversation_date <= ?", filter.To+" 23:59:59")
+	}
+	if filter.Agent != 0 {
+		query = query.Where("cc.agent_id = ?", filter.Agent)
+	}
+	if filter.Method != 0 {
+		query = query.Where("cc.conversation_method = ?", filter.Method)
+	}
+	if filter.Outcome != 0 {
+		query = query.Where("cc.outcome = ?", filter.Outcome)
+	}
+	if filter.Flag != 0 {
+		query = query.Where("cc.flag = ?", filter.Flag)
+	}
+	query = filter.Scope.Apply(query, "c.branch", "c.uid")
+
+	return query
+}
+
+func (s MySQLConversationSearcher) Search(filter ConversationSearchFilter) ([]schemas.ConversationSearchResultSchema, int64, error) {
+	var results []schemas.ConversationSearchResultSchema
+	var uidResults []schemas.UIDCountResultsSchema
+
+	selectQuery := s.query(filter, "select")
+	if filter.Query != "" {
+		selectQuery = selectQuery.Order("relevance DESC")
+	}
+	selectQuery = selectQuery.Order("cc.uid DESC")
+	selectQuery = selectQuery.Offset((filter.PageNo - 1) * filter.PageSize).Limit(filter.PageSize)
+	if err := selectQuery.Scan(&results).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var count int64
+	countQuery := s.query(filter, "count")
+	if filter.CountLimit > 0 {
+		if err := countQuery.Limit(filter.CountLimit).Scan(&uidResults).Error; err != nil {
+			return nil, 0, err
+		}
+		count = int64(len(uidResults))
+	} else if err := countQuery.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return results, count, nil
+}
+
+// MemoryConversationSearcher searches an in-memory slice of conversations, for tests. Like the FULLTEXT search
+// it matches whole words, relevance is the number of times the search terms occur in the transcript.
+type MemoryConversationSearcher struct {
+	Conversations []schemas.ConversationSearchResultSchema
+	// CustomerBranches maps customer uids to their branch, the scope is checked against the customer's branch
+	CustomerBranches map[int]int
+	// LoanCustomers maps loan uids to their customer, for scopes with loan grants
+	LoanCustomers map[int]int
+}
+
+func (s MemoryConversationSearcher) inScope(scope CustomerScope, customerID int) bool {
+	if scope.ReadAll || IntSliceContains(scope.Customers, customerID) {
+		return true
+	}
+	if branch, ok := s.CustomerBranches[customerID]; ok && IntSliceContains(scope.Branches, branch) {
+		return true
+	}
+	for _, loan := range scope.Loans {
+		if s.LoanCustomers[loan] == customerID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s MemoryConversationSearcher) Search(filter ConversationSearchFilter) ([]schemas.ConversationSearchResultSchema, int64, error) {
+	terms := strings.Fields(strings.ToLower(filter.Query))
+
+	matches := []schemas.ConversationSearchResultSchema{}
+	for _, conversation := range s.Conversations {
+		date := TruncateString(conversation.ConversationDate, 10)
+		if filter.From != "" && date < filter.From {
+			continue
+		}
+		if filter.To != "" && date > filter.To {
+			continue
+		}
+		if (filter.Agent != 0 && conversation.AgentID != filter.Agent) ||
+			(filter.Method != 0 && conversation.ConversationMethod != filter.Method) ||
+			(filter.Outcome != 0 && conversation.Outcome != filter.Outcome) ||
+			(filter.Flag != 0 && conversation.Flag != filter.Flag) {
+			continue
+		}
+		if !s.inScope(filter.Scope, conversation.CustomerID) {
+			continue
+		}
+
+		conversation.Relevance = 0
+		words := strings.FieldsFunc(strings.ToLower(conversation.Transcript), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range words {
+			if StringSliceContains(terms, word) {
+				conversation.Relevance++
+			}
+		}
+		if len(terms) > 0 && conversation.Relevance == 0 {
+			continue
+		}
+
+		matches = append(matches, conversation)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Relevance != matches[j].Relevance {
+			return matches[i].Relevance > matches[j].Relevance
+		}
+		return matches[i].UID > matches[j].UID
+	})
+
+	count := int64(len(matches))
+	if filter.CountLimit > 0 && count > int64(filter.CountLimit) {
+		count = int64(filter.CountLimit)
+	}
+
+	start := (filter.PageNo - 1) * filter.PageSize
+	if start < 0 || start >= len(matches) {
+		return []schemas.ConversationSearchResultSchema{}, count, nil
+	}
+	end := min(start+filter.PageSize, len(matches))
+
+	return matches[start:end], count, nil
+}
+
+// CustomerConversationsQueryBuilder lists interactions by customer name, limited to the customers in scope
+func CustomerConversationsQueryBuilder(db *gorm.DB, searchTerm string, scope CustomerScope, queryType string) *gorm.DB {
+	query := db.Table("o_customer_conversations cc")
+	query = query.Joins("INNER JOIN o_customers c ON c.uid = cc.customer_id")
+
+	if queryType == "count" {
+		query = query.Select("cc.uid")
+	} else {
+		query = query.Select("cc.uid, c.full_name, c.branch, cc.transcript, cc.conversation_date, cc.next_interaction")
+	}
+
+	if searchTerm != "" {
+		query = query.Where("c.full_name LIKE ?", "%"+searchTerm+"%")
+	}
+	query = scope.Apply(query, "c.branch", "c.uid")
+
+	return query
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"reflect"
+	"super-lender/schemas"
+	"testing"
+)
+
+func testConversationSearcher() MemoryConversationSearcher {
+	return MemoryConversationSearcher{
+		Conversations: []schemas.ConversationSearchResultSchema{
+			{UID: 1, CustomerID: 10, AgentID: 3, ConversationMethod: 1, Outcome: 1, Flag: 0, ConversationDate: "2024-03-01 09:00:00", Transcript: "Customer promised to pay on Friday"},
+			{UID: 2, CustomerID: 11, AgentID: 4, ConversationMethod: 2, Outcome: 2, Flag: 5, ConversationDate: "2024-03-05 14:30:00", Transcript: "Pay pay pay, the customer says salary is late"},
+			{UID: 3, CustomerID: 12, AgentID: 3, ConversationMethod: 1, Outcome: 3, Flag: 5, ConversationDate: "2024-03-10 23:59:59", Transcript: "Phone switched off"},
+			{UID: 4, CustomerID: 10, AgentID: 4, ConversationMethod: 3, Outcome: 1, Flag: 0, ConversationDate: "2024-03-11 00:00:00", Transcript: "Visited, will pay the balance"},
+			{UID: 5, CustomerID: 13, AgentID: 3, ConversationMethod: 2, Outcome: 2, Flag: 0, ConversationDate: "2024-03-12 08:15:00", Transcript: "Repayment plan agreed. Payment expected"},
+		},
+		CustomerBranches: map[int]int{10: 1, 11: 1, 12: 2, 13: 3},
+		LoanCustomers:    map[int]int{100: 13},
+	}
+}
+
+func conversationUIDs(results []schemas.ConversationSearchResultSchema) []int {
+	uids := []int{}
+	for _, result := range results {
+		uids = append(uids, result.UID)
+	}
+	return uids
+}
+
+func TestMemoryConversationSearcher(t *testing.T) {
+	all := CustomerScope{ReadAll: true}
+
+	tests := []struct {
+		name      string
+		filter    ConversationSearchFilter
+		want      []int
+		wantCount int64
+	}{
+		{"no filters lists newest first", ConversationSearchFilter{Scope: all}, []int{5, 4, 3, 2, 1}, 5},
+		{"ranked by how often the terms occur", ConversationSearchFilter{Query: "pay", Scope: all}, []int{2, 4, 1}, 3},
+		{"terms are whole words", ConversationSearchFilter{Query: "payment", Scope: all}, []int{5}, 1},
+		{"any of several terms", ConversationSearchFilter{Query: "PHONE salary", Scope: all}, []int{3, 2}, 2},
+		{"no match", ConversationSearchFilter{Query: "lawyer", Scope: all}, []int{}, 0},
+		{"from date is inclusive", ConversationSearchFilter{From: "2024-03-10", Scope: all}, []int{5, 4, 3}, 3},
+		{"to date covers the whole day", ConversationSearchFilter{To: "2024-03-10", Scope: all}, []int{3, 2, 1}, 3},
+		{"date range", ConversationSearchFilter{From: "2024-03-05", To: "2024-03-11", Scope: all}, []int{4, 3, 2}, 3},
+		{"agent", ConversationSearchFilter{Agent: 4, Scope: all}, []int{4, 2}, 2},
+		{"method", ConversationSearchFilter{Method: 1, Scope: all}, []int{3, 1}, 2},
+		{"outcome", ConversationSearchFilter{Outcome: 2, Scope: all}, []int{5, 2}, 2},
+		{"flag", ConversationSearchFilter{Flag: 5, Scope: all}, []int{3, 2}, 2},
+		{"filters combine", ConversationSearchFilter{Query: "pay", Agent: 4, Outcome: 1, Scope: all}, []int{4}, 1},
+		{"scope by branch", ConversationSearchFilter{Scope: CustomerScope{Branches: []int{1}}}, []int{4, 2, 1}, 3},
+		{"scope by customer grant", ConversationSearchFilter{Scope: CustomerScope{Branches: []int{9}, Customers: []int{12}}}, []int{3}, 1},
+		{"scope by loan grant", ConversationSearchFilter{Scope: CustomerScope{Branches: []int{9}, Loans: []int{100}}}, []int{5}, 1},
+		{"empty scope", ConversationSearchFilter{}, []int{}, 0},
+		{"second page", ConversationSearchFilter{Scope: all, PageNo: 2, PageSize: 2}, []int{3, 2}, 5},
+		{"page past the end", ConversationSearchFilter{Scope: all, PageNo: 4, PageSize: 2}, []int{}, 5},
+		{"count is capped", ConversationSearchFilter{Scope: all, PageSize: 2, CountLimit: 3}, []int{5, 4}, 3},
+	}
+
+	searcher := testConversationSearcher()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := tt.filter
+			if filter.PageNo == 0 {
+				filter.PageNo = 1
+			}
+			if filter.PageSize == 0 {
+				filter.PageSize = 10
+			}
+			results, count, err := searcher.Search(filter)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			if got := conversationUIDs(results); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search() = %v, want %v", got, tt.want)
+			}
+			if count != tt.wantCount {
+				t.Errorf("Search() count = %d, want %d", count, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestMemoryConversationSearcherRelevance(t *testing.T) {
+	results, _, err := testConversationSearcher().Search(ConversationSearchFilter{Query: "pay customer", Scope: CustomerScope{ReadAll: true}, PageNo: 1, PageSize: 10})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	want := map[int]float64{2: 4, 1: 2, 4: 1}
+	for _, result := range results {
+		if result.Relevance != want[result.UID] {
+			t.Errorf("relevance of %d = %v, want %v", result.UID, result.Relevance, want[result.UID])
+		}
+	}
+	if got := conversationUIDs(results); !reflect.DeepEqual(got, []int{2, 1, 4}) {
+		t.Errorf("Search() = %v, want [2 1 4]", got)
+	}
+}
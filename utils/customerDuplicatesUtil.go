@@ -0,0 +1,301 @@
+package utils
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// branchNameThreshold is how alike two names in the same branch must be to flag them
+	branchNameThreshold = 0.8
+
+	// dobNameThreshold is how alike the names of two customers born the same day must be to flag them
+	dobNameThreshold = 0.6
+
+	// duplicateCandidateLimit caps the rows fetched per rule before the names are compared
+	duplicateCandidateLimit = 200
+)
+
+// normalizeName lower cases a name and sorts its parts, so "DOE John" and "john doe" compare equal
+func normalizeName(name string) []string {
+	parts := strings.Fields(strings.ToLower(name))
+	sort.Strings(parts)
+	return parts
+}
+
+func levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// NameSimilarity compares two names from 0 (nothing alike) to 1 (the same), ignoring case and the order of the
+// names. A name whose parts are all in the other, e.g. a missing middle name, scores 0.9.
+func NameSimilarity(a, b string) float64 {
+	partsA, partsB := normalizeName(a), normalizeName(b)
+	if len(partsA) == 0 || len(partsB) == 0 {
+		return 0
+	}
+
+	joinedA, joinedB := []rune(strings.Join(partsA, " ")), []rune(strings.Join(partsB, " "))
+	similarity := 1 - float64(levenshtein(joinedA, joinedB))/float64(max(len(joinedA), len(joinedB)))
+
+	shorter, longer := partsA, partsB
+	if len(shorter) > len(longer) {
+		shorter, longer = longer, shorter
+	}
+	contained := len(shorter) > 1
+	for _, part := range shorter {
+		if !StringSliceContains(longer, part) {
+			contained = false
+			break
+		}
+	}
+	if contained && similarity < 0.9 {
+		similarity = 0.9
+	}
+
+	return similarity
+}
+
+func duplicateCandidatesQuery(db *gorm.DB, customerID int, scope CustomerScope) *gorm.DB {
+	query := db.Table("o_customers c")
+	query = query.Select("c.uid, c.full_name, c.primary_mobile, IFNULL(c.national_id, '') AS national_id, IFNULL(DATE_FORMAT(c.dob, '%Y-%m-%d'), '') AS dob, c.branch AS branch_id, IFNULL(b.name, '') AS branch, IFNULL(cs.name, '') AS status")
+	query = query.Joins("LEFT JOIN o_branches b ON c.branch = b.uid")
+	query = query.Joins("LEFT JOIN o_customer_statuses cs ON c.status = cs.code")
+	query = query.Where("c.uid != ? AND c.status != ?", customerID, models.DELETED)
+	query = scope.Apply(query, "c.branch", "c.uid")
+	return query.Limit(duplicateCandidateLimit)
+}
+
+// FindPossibleDuplicates looks for customers within the scope who may be the same person: a similar name in the
+// same branch, a phone number shared as primary or alternative contact, or the same date of birth and a similar name.
+func FindPossibleDuplicates(db *gorm.DB, customer models.OCustomer, scope CustomerScope) ([]schemas.PossibleDuplicateSchema, error) {
+	found := map[int]*schemas.PossibleDuplicateSchema{}
+	flag := func(candidate schemas.PossibleDuplicateSchema, score float64, reason string) {
+		existing, ok := found[candidate.UID]
+		if !ok {
+			candidate.Reasons = []string{}
+			existing = &candidate
+			found[candidate.UID] = existing
+		}
+		existing.Reasons = append(existing.Reasons, reason)
+		existing.Score = max(existing.Score, score)
+	}
+
+	// similar names in the same branch, SOUNDEX and the name parts narrow the rows down before the names are compared
+	var candidates []schemas.PossibleDuplicateSchema
+	conditions := []string{"SOUNDEX(c.full_name) = SOUNDEX(?)"}
+	args := []interface{}{customer.FullName}
+	for _, part := range normalizeName(customer.FullName) {
+		if len(part) >= 3 {
+			conditions = append(conditions, "c.full_name LIKE ?")
+			args = append(args, "%"+part+"%")
+		}
+	}
+	query := duplicateCandidatesQuery(db, customer.UID, scope).Where("c.branch = ?", customer.Branch).Where("("+strings.Join(conditions, " OR ")+")", args...)
+	if err := query.Scan(&candidates).Error; err != nil {
+		return nil, err
+	}
+	for _, candidate := range candidates {
+		if score := NameSimilarity(customer.FullName, candidate.FullName); score >= branchNameThreshold {
+			flag(candidate, score, "Similar name in the same branch")
+		}
+	}
+
+	// phone numbers shared between primary mobiles and alternative phones
+	phones := []string{}
+	if customer.PrimaryMobile != "" {
+		phones = append(phones, customer.PrimaryMobile)
+	}
+	var alternativePhones []string
+	if err := db.Model(&models.OCustomerContacts{}).
+		Where("customer_id = ? AND status = 1 AND contact_type IN ? AND value != ''", customer.UID, []models.ContactType{models.AlternativePhone1, models.AlternativePhone2}).
+		Pluck("value", &alternativePhones).Error; err != nil {
+		return nil, err
+	}
+	phones = append(phones, alternativePhones...)
+	if len(phones) > 0 {
+		candidates = nil
+		query := duplicateCandidatesQuery(db, customer.UID, scope).
+			Where("(c.primary_mobile IN (?) OR c.uid IN (SELECT oc.customer_id FROM o_customer_contacts oc WHERE oc.status = 1 AND oc.value IN (?)))", phones, phones)
+		if err := query.Scan(&candidates).Error; err != nil {
+			return nil, err
+		}
+		for _, candidate := range candidates {
+			flag(candidate, 0.9, "Shares a phone number")
+		}
+	}
+
+	// the same date of birth and a similar name, in any branch
+	if dob := TruncateString(customer.DOB, 10); dob != "" {
+		candidates = nil
+		if err := duplicateCandidatesQuery(db, customer.UID, scope).Where("c.dob = ?", dob).Scan(&candidates).Error; err != nil {
+			return nil, err
+		}
+		for _, candidate := range candidates {
+			if score := NameSimilarity(customer.FullName, candidate.FullName); score >= dobNameThreshold {
+				flag(candidate, max(score, 0.85), "Same date of birth and a similar name")
+			}
+		}
+	}
+
+	duplicates := make([]schemas.PossibleDuplicateSchema, 0, len(found))
+	for _, duplicate := range found {
+		// every further rule that matched makes it more likely
+		duplicate.Score = min(1, duplicate.Score+0.05*float64(len(duplicate.Reasons)-1))
+		duplicates = append(duplicates, *duplicate)
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		if duplicates[i].Score != duplicates[j].Score {
+			return duplicates[i].Score > duplicates[j].Score
+		}
+		return duplicates[i].UID < duplicates[j].UID
+	})
+
+	return duplicates, nil
+}
+
+// mergeTables are the records that follow a merged customer to the survivor, by the name used in the audit trail
+var mergeTables = []struct {
+	Name  string
+	Model interface{}
+}{
+	{"loans", &models.OLoan{}},
+	{"contacts", &models.OCustomerContacts{}},
+	{"referees", &models.OCustomerReferee{}},
+	{"guarantors", &models.OCustomerGuarantor{}},
+	{"guarantees", &models.OGuarantor{}},
+	{"conversations", &models.OCustomerConversation{}},
+	{"documents", &models.OCustomerDocument{}},
+}
+
+// mergedCustomerSnapshot is what o_customer_merges keeps of the duplicate, the account details without personal
+// data, which moved to the survivor or stays on the deleted customer where an erasure can reach it
+type mergedCustomerSnapshot struct {
+	UID            int                   `json:"uid"`
+	CustomerCode   string                `json:"customerCode"`
+	Branch         int                   `json:"branch"`
+	PrimaryProduct int                   `json:"primaryProduct"`
+	AddedBy        int                   `json:"addedBy"`
+	CurrentAgent   int                   `json:"currentAgent"`
+	AddedDate      string                `json:"addedDate"`
+	LoanLimit      float64               `json:"loanLimit"`
+	Flag           int                   `json:"flag"`
+	TotalLoans     int                   `json:"totalLoans"`
+	Status         models.CustomerStatus `json:"status"`
+}
+
+// MergeCustomers re-points the records of duplicate to survivor in one transaction and deletes duplicate. Identity
+// fields the survivor lacks are taken over from the duplicate. The account details of the duplicate and the uids
+// moved per table are kept in o_customer_merges.
+func MergeCustomers(survivor models.OCustomer, duplicate models.OCustomer, reason string, mergedBy int) (models.OCustomerMerge, map[string][]int, error) {
+	moved := map[string][]int{}
+
+	snapshot, err := json.Marshal(mergedCustomerSnapshot{
+		UID:            duplicate.UID,
+		CustomerCode:   duplicate.CustomerCode,
+		Branch:         duplicate.Branch,
+		PrimaryProduct: duplicate.PrimaryProduct,
+		AddedBy:        duplicate.AddedBy,
+		CurrentAgent:   duplicate.CurrentAgent,
+		AddedDate:      duplicate.AddedDate,
+		LoanLimit:      duplicate.LoanLimit,
+		Flag:           duplicate.Flag,
+		TotalLoans:     duplicate.TotalLoans,
+		Status:         duplicate.Status,
+	})
+	if err != nil {
+		return models.OCustomerMerge{}, nil, err
+	}
+
+	merge := models.OCustomerMerge{
+		SurvivorID:     survivor.UID,
+		MergedID:       duplicate.UID,
+		MergedSnapshot: string(snapshot),
+		Reason:         reason,
+		MergedBy:       mergedBy,
+	}
+
+	err = inits.CurrentDB.Transaction(func(tx *gorm.DB) error {
+		for _, table := range mergeTables {
+			var uids []int
+			if err := tx.Model(table.Model).Where("customer_id = ?", duplicate.UID).Pluck("uid", &uids).Error; err != nil {
+				return err
+			}
+			if len(uids) == 0 {
+				continue
+			}
+			if err := tx.Model(table.Model).Where("uid IN ?", uids).Update("customer_id", survivor.UID).Error; err != nil {
+				return err
+			}
+			moved[table.Name] = uids
+		}
+
+		// unique identity fields move rather than being copied
+		survivorChanges := map[string]interface{}{}
+		duplicateChanges := map[string]interface{}{
+			"status":               models.DELETED,
+			"status_before_delete": duplicate.Status,
+			"deleted_by":           mergedBy,
+			"deleted_date":         time.Now(),
+		}
+		if survivor.NationalID == "" && duplicate.NationalID != "" {
+			survivorChanges["national_id"] = duplicate.NationalID
+			duplicateChanges["national_id"] = ""
+		}
+		if survivor.EmailAddress == "" && duplicate.EmailAddress != "" {
+			survivorChanges["email_address"] = duplicate.EmailAddress
+			duplicateChanges["email_address"] = ""
+		}
+		if survivor.PassportPhoto == "" && duplicate.PassportPhoto != "" {
+			survivorChanges["passport_photo"] = duplicate.PassportPhoto
+		}
+		if survivor.DOB == "" && duplicate.DOB != "" {
+			survivorChanges["dob"] = TruncateString(duplicate.DOB, 10)
+		}
+
+		var totalLoans int64
+		if err := tx.Model(&models.OLoan{}).Where("customer_id = ?", survivor.UID).Count(&totalLoans).Error; err != nil {
+			return err
+		}
+		survivorChanges["total_loans"] = totalLoans
+
+		if err := tx.Model(&models.OCustomer{}).Where("uid = ?", duplicate.UID).Updates(duplicateChanges).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.OCustomer{}).Where("uid = ?", survivor.UID).Updates(survivorChanges).Error; err != nil {
+			return err
+		}
+
+		movedRecords, err := json.Marshal(moved)
+		if err != nil {
+			return err
+		}
+		merge.MovedRecords = string(movedRecords)
+		return tx.Create(&merge).Error
+	})
+
+	return merge, moved, err
+}
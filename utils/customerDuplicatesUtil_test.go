@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNameSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want float64
+	}{
+		{"same name", "John Doe", "John Doe", 1},
+		{"case is ignored", "John Doe", "john DOE", 1},
+		{"order is ignored", "DOE John", "John Doe", 1},
+		{"extra spaces are ignored", "Mary  Ann   Smith", "smith mary ann", 1},
+		{"missing middle name", "John Michael Doe", "John Doe", 0.9},
+		{"missing middle name either way", "John Doe", "John Michael Doe", 0.9},
+		{"one letter off", "John Doe", "Jon Doe", 0.875},
+		{"a single name is not contained", "John", "John Doe", 0.5},
+		{"different people", "Alice Wanjiru", "Peter Otieno", 2.0 / 13},
+		{"accents count per letter", "José Ñúñez", "jose nunez", 0.6},
+		{"empty name", "John Doe", "", 0},
+		{"blank names", "  ", " ", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NameSimilarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("NameSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+			if got := NameSimilarity(tt.b, tt.a); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("NameSimilarity(%q, %q) = %v, want %v", tt.b, tt.a, got, tt.want)
+			}
+		})
+	}
+}
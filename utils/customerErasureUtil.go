@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"os"
+	"super-lender/inits"
+	"super-lender/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// erasedText stands in for personal data in columns that may not be empty
+const erasedText = "[erased]"
+
+// CountOpenLoans returns how many loans of the customer are not closed yet
+func CountOpenLoans(db *gorm.DB, customerID int) (int64, error) {
+	var count int64
+	err := db.Model(&models.OLoan{}).Where("customer_id = ? AND status NOT IN ?", customerID, closedLoanStatuses).Count(&count).Error
+	return count, err
+}
+
+// EraseCustomer anonymises the personal data of a customer, their contacts, referees, guarantors, interactions
+// and documents in one transaction. Loans and repayments are kept as they are, the law requires the financial
+// records to be retained. The customer stays DELETED and can no longer be restored. With ARCHIVE=1 the copies
+// in the archive database are anonymised too, before the erasure is recorded.
+func EraseCustomer(storage Storage, customer models.OCustomer, reason string, reference string, erasedBy int) (models.OCustomerErasure, error) {
+	erasure := models.OCustomerErasure{
+		CustomerID: customer.UID,
+		Reference:  reference,
+		Reason:     reason,
+		ErasedBy:   erasedBy,
+	}
+
+	var documents []models.OCustomerDocument
+	err := inits.CurrentDB.Transaction(func(tx *gorm.DB) error {
+		current, err := eraseCustomerRows(tx, customer, erasedBy)
+		if err != nil {
+			return err
+		}
+		documents = append(documents, current...)
+
+		// the archive has no transaction in common with the current database, if the erasure is not recorded
+		// afterwards it can simply be run again
+		if archiveEnabled() {
+			err := inits.ArchiveDB.Transaction(func(archiveTx *gorm.DB) error {
+				archived, err := eraseCustomerRows(archiveTx, customer, erasedBy)
+				documents = append(documents, archived...)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&erasure).Error
+	})
+	if err != nil {
+		return erasure, err
+	}
+
+	// files go once the database no longer points at them, a failure leaves an orphan file rather than a broken record
+	erased := map[string]bool{}
+	for _, document := range documents {
+		if erased[document.StorageKey] {
+			continue
+		}
+		erased[document.StorageKey] = true
+		if err := storage.Delete(document.StorageKey); err == nil {
+			erasure.FilesErased++
+		}
+		if document.ThumbnailKey != "" {
+			storage.Delete(document.ThumbnailKey)
+		}
+	}
+	inits.CurrentDB.Model(&erasure).Update("files_erased", erasure.FilesErased)
+
+	return erasure, nil
+}
+
+// archiveEnabled reports whether the archive database is in use, ARCHIVE=1
+func archiveEnabled() bool {
+	return os.Getenv("ARCHIVE") == "1" && inits.ArchiveDB != nil
+}
+
+// eraseCustomerRows anonymises the customer's rows in one database and returns their documents, whose files
+// are to be deleted. Tables the database does not have, e.g. in an older archive, are skipped.
+func eraseCustomerRows(tx *gorm.DB, customer models.OCustomer, erasedBy int) ([]models.OCustomerDocument, error) {
+	customerChanges := map[string]interface{}{
+		"full_name":        "Erased customer",
+		"primary_mobile":   "",
+		"enc_phone":        "",
+		"email_address":    "",
+		"physical_address": "",
+		"geolocation":      "",
+		"passport_photo":   "",
+		"national_id":      "",
+		"dob":              nil,
+		"gender":           models.OTHER,
+		"events":           "",
+		"sec_data":         "",
+		"pin_":             "",
+		"device_id":        "",
+		"status":           models.DELETED,
+	}
+	if customer.Status != models.DELETED {
+		customerChanges["status_before_delete"] = customer.Status
+		customerChanges["deleted_by"] = erasedBy
+		customerChanges["deleted_date"] = time.Now()
+	}
+
+	steps := []struct {
+		model   interface{}
+		changes map[string]interface{}
+	}{
+		{&models.OCustomer{}, customerChanges},
+		{&models.OCustomerContacts{}, map[string]interface{}{"value": "", "enc_phone": "", "status": 0}},
+		{&models.OCustomerReferee{}, map[string]interface{}{"referee_name": erasedText, "id_no": "", "mobile_no": "", "physical_address": "", "email_address": "", "status": 0}},
+		{&models.OCustomerGuarantor{}, map[string]interface{}{"guarantor_name": erasedText, "national_id": "", "mobile_no": "", "physical_address": "", "status": 0}},
+		{&models.OGuarantor{}, map[string]interface{}{"national_id": "", "mobile_no": "", "status": 0}},
+		{&models.OCustomerConversation{}, map[string]interface{}{"transcript": erasedText}},
+	}
+	for _, step := range steps {
+		if !tx.Migrator().HasTable(step.model) {
+			continue
+		}
+		column := "customer_id"
+		if _, ok := step.model.(*models.OCustomer); ok {
+			column = "uid"
+		}
+		if err := tx.Model(step.model).Where(column+" = ?", customer.UID).Updates(step.changes).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// merges recorded before snapshots left out personal data kept the whole duplicate, on either side of the merge
+	if tx.Migrator().HasTable(&models.OCustomerMerge{}) {
+		if err := tx.Model(&models.OCustomerMerge{}).Where("merged_id = ? OR survivor_id = ?", customer.UID, customer.UID).
+			Update("merged_snapshot", "{}").Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// the audit trail stays, minus the personal data written into it
+	if tx.Migrator().HasTable(&models.OEvent{}) {
+		for _, value := range []string{customer.FullName, customer.PrimaryMobile, customer.NationalID, customer.EmailAddress} {
+			if value == "" {
+				continue
+			}
+			if err := tx.Model(&models.OEvent{}).
+				Where("tbl = ? AND fld = ? AND event_details LIKE ?", "o_customers", customer.UID, "%"+value+"%").
+				Update("event_details", gorm.Expr("REPLACE(event_details, ?, ?)", value, erasedText)).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// files of documents deleted earlier were kept for the audit trail, they go as well
+	var documents []models.OCustomerDocument
+	if !tx.Migrator().HasTable(&models.OCustomerDocument{}) {
+		return documents, nil
+	}
+	if err := tx.Where("customer_id = ?", customer.UID).Find(&documents).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&models.OCustomerDocument{}).Where("customer_id = ?", customer.UID).
+		Updates(map[string]interface{}{"file_name": erasedText, "description": "", "status": models.DeletedDocument}).Error; err != nil {
+		return nil, err
+	}
+
+	return documents, nil
+}
@@ -0,0 +1,382 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// CustomerInputError is a customer that cannot be created as given, Message is meant for the client
+type CustomerInputError struct {
+	Message string
+}
+
+func (e *CustomerInputError) Error() string {
+	return e.Message
+}
+
+// PrepareNewCustomer normalises a customer about to be created and runs the checks every new customer has to pass.
+// A *CustomerInputError is returned when the customer is not acceptable, any other error comes from the database.
+func PrepareNewCustomer(db *gorm.DB, customer *models.OCustomer, addedBy int) error {
+	countryCode, err := GetCountryCode()
+	if err != nil {
+		return err
+	}
+
+	// outside Kenya the provider cannot be left to the default of 1 for safaricom
+	if countryCode != "254" && (customer.PhoneNumberProvider == 0 || customer.PhoneNumberProvider == 1) {
+		return &CustomerInputError{Message: "Phone number provider is required"}
+	}
+
+	// blocked and deleted branches take no new customers
+	if err := CheckBranchOpen(db, customer.Branch); err != nil {
+		if errors.Is(err, ErrBranchClosed) {
+			return &CustomerInputError{Message: "Branch is not open for new customers"}
+		}
+		return err
+	}
+
+	primaryMobile := MakePhoneValid(customer.PrimaryMobile)
+	if !IsPhoneValid(primaryMobile) {
+		return &CustomerInputError{Message: "Invalid phone number"}
+	}
+	customer.PrimaryMobile = primaryMobile
+
+	var count int64
+	if err := db.Model(&models.OCustomer{}).Where("primary_mobile = ?", primaryMobile).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return &CustomerInputError{Message: "Customer with the same primary mobile already exists"}
+	}
+
+	customer.NationalID = strings.TrimSpace(customer.NationalID)
+	if customer.NationalID != "" {
+		if err := db.Model(&models.OCustomer{}).Where("national_id = ?", customer.NationalID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return &CustomerInputError{Message: "Customer with the same national id already exists"}
+		}
+	}
+
+	customer.EmailAddress = strings.TrimSpace(customer.EmailAddress)
+	if customer.EmailAddress != "" {
+		if err := db.Model(&models.OCustomer{}).Where("email_address = ?", customer.EmailAddress).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return &CustomerInputError{Message: "Customer with the same email address already exists"}
+		}
+	}
+
+	customer.Status = InitialCustomerStatus(customer.Status)
+
+	customer.FullName = strings.TrimSpace(customer.FullName)
+	customer.PhysicalAddress = strings.TrimSpace(customer.PhysicalAddress)
+	customer.Geolocation = strings.TrimSpace(customer.Geolocation)
+	customer.EncPhone = Sha256Hash(primaryMobile)
+	customer.DOB = TruncateString(customer.DOB, 10)
+	customer.AddedBy = addedBy
+	customer.CurrentAgent = addedBy
+	customer.AddedDate = time.Now().Format("2006-01-02 15:04:05")
+
+	return nil
+}
+
+// CreateNewCustomer stores a customer prepared by PrepareNewCustomer, an unknown date of birth is left NULL
+func CreateNewCustomer(db *gorm.DB, customer *models.OCustomer) error {
+	if customer.DOB == "" {
+		return db.Omit("DOB").Create(customer).Error
+	}
+	return db.Create(customer).Error
+}
+
+// customerImportColumn fills one field of a customer from a spreadsheet cell
+type customerImportColumn func(customer *models.OCustomer, value string) error
+
+func importInt(value string) (int, error) {
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.New("must be a whole number")
+	}
+	return number, nil
+}
+
+// customerImportColumns are the accepted headers, compared in lower case without spaces, dashes and underscores
+var customerImportColumns = map[string]customerImportColumn{
+	"fullname": func(customer *models.OCustomer, value string) error {
+		customer.FullName = value
+		return nil
+	},
+	"primarymobile": func(customer *models.OCustomer, value string) error {
+		customer.PrimaryMobile = MakePhoneValid(value)
+		return nil
+	},
+	"phonenumberprovider": func(customer *models.OCustomer, value string) error {
+		provider, err := importInt(value)
+		customer.PhoneNumberProvider = models.PhoneNumberProvider(provider)
+		return err
+	},
+	"emailaddress": func(customer *models.OCustomer, value string) error {
+		customer.EmailAddress = value
+		return nil
+	},
+	"physicaladdress": func(customer *models.OCustomer, value string) error {
+		customer.PhysicalAddress = value
+		return nil
+	},
+	"geolocation": func(customer *models.OCustomer, value string) error {
+		customer.Geolocation = value
+		return nil
+	},
+	"town": func(customer *models.OCustomer, value string) (err error) {
+		customer.Town, err = importInt(value)
+		return err
+	},
+	"nationalid": func(customer *models.OCustomer, value string) error {
+		customer.NationalID = value
+		return nil
+	},
+	"gender": func(customer *models.OCustomer, value string) error {
+		customer.Gender = models.Gender(strings.ToUpper(TruncateString(value, 1)))
+		return nil
+	},
+	"dob": func(customer *models.OCustomer, value string) error {
+		dob, err := parseImportDate(value)
+		customer.DOB = dob
+		return err
+	},
+	"branch": func(customer *models.OCustomer, value string) (err error) {
+		customer.Branch, err = importInt(value)
+		return err
+	},
+	"primaryproduct": func(customer *models.OCustomer, value string) (err error) {
+		customer.PrimaryProduct, err = importInt(value)
+		return err
+	},
+	"loanlimit": func(customer *models.OCustomer, value string) (err error) {
+		customer.LoanLimit, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		return nil
+	},
+	"status": func(customer *models.OCustomer, value string) error {
+		// imported customers still have to pass KYC before they become active
+		switch strings.ToLower(value) {
+		case "lead", "3":
+			customer.Status = models.LEAD
+		case "draft", "4":
+			customer.Status = models.DRAFT
+		default:
+			return errors.New("must be lead or draft")
+		}
+		return nil
+	},
+}
+
+// customerImportAliases are other common names for the accepted headers
+var customerImportAliases = map[string]string{
+	"name":          "fullname",
+	"phone":         "primarymobile",
+	"mobile":        "primarymobile",
+	"phonenumber":   "primarymobile",
+	"email":         "emailaddress",
+	"address":       "physicaladdress",
+	"idnumber":      "nationalid",
+	"idno":          "nationalid",
+	"dateofbirth":   "dob",
+	"product":       "primaryproduct",
+	"provider":      "phonenumberprovider",
+	"branchid":      "branch",
+	"productid":     "primaryproduct",
+	"customerlimit": "loanlimit",
+}
+
+// customerImportRequired are the headers an import file must have
+var customerImportRequired = []string{"fullname", "primarymobile", "physicaladdress", "gender", "branch", "primaryproduct"}
+
+// CustomerImportHeader maps the columns of a header row to the fields they fill, columns it does not know are ignored
+type CustomerImportHeader struct {
+	Columns map[int]string
+	Ignored []string
+}
+
+func normalizeImportHeader(header string) string {
+	return strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(strings.TrimSpace(header)))
+}
+
+// ParseCustomerImportHeader reads the header row, it fails when a required column is missing
+func ParseCustomerImportHeader(header []string) (CustomerImportHeader, error) {
+	parsed := CustomerImportHeader{Columns: map[int]string{}, Ignored: []string{}}
+	found := map[string]bool{}
+	for i, name := range header {
+		key := normalizeImportHeader(name)
+		if alias, ok := customerImportAliases[key]; ok {
+			key = alias
+		}
+		if _, ok := customerImportColumns[key]; !ok || found[key] {
+			if strings.TrimSpace(name) != "" {
+				parsed.Ignored = append(parsed.Ignored, name)
+			}
+			continue
+		}
+		parsed.Columns[i] = key
+		found[key] = true
+	}
+
+	missing := []string{}
+	for _, key := range customerImportRequired {
+		if !found[key] {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return parsed, fmt.Errorf("missing column(s): %s", strings.Join(missing, ", "))
+	}
+	return parsed, nil
+}
+
+// parseImportDate accepts YYYY-MM-DD, DD/MM/YYYY and the day numbers spreadsheets store dates as
+func parseImportDate(value string) (string, error) {
+	if serial, err := strconv.ParseFloat(value, 64); err == nil && serial > 0 && serial < 100000 {
+		return time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(serial)).Format(DateFormat), nil
+	}
+	for _, layout := range []string{DateFormat, "02/01/2006", "2/1/2006"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date.Format(DateFormat), nil
+		}
+	}
+	return "", errors.New("must be a date as YYYY-MM-DD or DD/MM/YYYY")
+}
+
+// customerImportRow builds the customer of one row and checks the same binding rules as the create endpoint
+func customerImportRow(header CustomerImportHeader, row []string) (models.OCustomer, []string) {
+	customer := models.OCustomer{Status: models.LEAD}
+	problems := []string{}
+
+	for i, key := range header.Columns {
+		if i >= len(row) || strings.TrimSpace(row[i]) == "" {
+			continue
+		}
+		if err := customerImportColumns[key](&customer, strings.TrimSpace(row[i])); err != nil {
+			problems = append(problems, key+": "+err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return customer, problems
+	}
+
+	if err := binding.Validator.ValidateStruct(&customer); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			for _, fe := range ve {
+				problems = append(problems, fe.Field()+": "+GetErrorMsg(fe))
+			}
+		} else {
+			problems = append(problems, err.Error())
+		}
+	}
+	return customer, problems
+}
+
+// RunCustomerImport validates every data row and, unless the job is a dry run, creates the customers that pass.
+// It is meant to run in the background, progress and the per-row report are written to the job.
+func RunCustomerImport(job models.OImportJob, header CustomerImportHeader, rows [][]string, user models.OUser) {
+	db := inits.CurrentDB
+
+	defer func() {
+		if r := recover(); r != nil {
+			now := time.Now()
+			db.Model(&job).Updates(map[string]interface{}{"status": models.FailedImport, "error": TruncateString(fmt.Sprint(r), 250), "completed_date": now})
+		}
+	}()
+
+	db.Model(&job).Update("status", models.RunningImport)
+
+	report := schemas.CustomerImportReportSchema{IgnoredColumns: header.Ignored, Rows: []schemas.CustomerImportRowSchema{}}
+	seen := map[string]int{}
+	succeeded, failed := 0, 0
+
+	// rows[0] is the header, so the spreadsheet row of rows[i] is i+1
+	for i := 1; i < len(rows); i++ {
+		if strings.TrimSpace(strings.Join(rows[i], "")) == "" {
+			continue
+		}
+		result := schemas.CustomerImportRowSchema{Row: i + 1}
+
+		customer, problems := customerImportRow(header, rows[i])
+		if len(problems) == 0 {
+			// the database checks cannot see earlier rows of a dry run, nor rows of the same file not yet created
+			for _, key := range []string{"phone:" + customer.PrimaryMobile, "id:" + strings.TrimSpace(customer.NationalID), "email:" + strings.ToLower(strings.TrimSpace(customer.EmailAddress))} {
+				if strings.HasSuffix(key, ":") {
+					continue
+				}
+				if first, ok := seen[key]; ok {
+					problems = append(problems, fmt.Sprintf("same %s as row %d", strings.SplitN(key, ":", 2)[0], first))
+					continue
+				}
+				seen[key] = result.Row
+			}
+		}
+		if len(problems) == 0 {
+			if err := PrepareNewCustomer(db, &customer, user.UID); err != nil {
+				var inputErr *CustomerInputError
+				if errors.As(err, &inputErr) {
+					problems = append(problems, inputErr.Message)
+				} else {
+					problems = append(problems, "could not be checked, try again")
+				}
+			}
+		}
+		if len(problems) == 0 && job.DryRun == 0 {
+			if err := CreateNewCustomer(db, &customer); err != nil {
+				problems = append(problems, "could not be saved")
+			} else {
+				result.CustomerID = customer.UID
+				LogEvent("o_customers", customer.UID, fmt.Sprintf("Customer %s(%d) imported by %s(%d), import %d row %d", customer.FullName, customer.UID, user.Name, user.UID, job.UID, result.Row), user.UID)
+			}
+		}
+
+		switch {
+		case len(problems) > 0:
+			result.Status = "failed"
+			result.Errors = problems
+			failed++
+		case job.DryRun == 1:
+			result.Status = "valid"
+			succeeded++
+		default:
+			result.Status = "created"
+			succeeded++
+		}
+		report.Rows = append(report.Rows, result)
+
+		// progress for whoever is polling the job
+		if len(report.Rows)%100 == 0 {
+			db.Model(&job).Updates(map[string]interface{}{"succeeded_rows": succeeded, "failed_rows": failed})
+		}
+	}
+
+	reportJSON, _ := json.Marshal(report)
+	now := time.Now()
+	db.Model(&job).Updates(map[string]interface{}{
+		"status":         models.CompletedImport,
+		"total_rows":     len(report.Rows),
+		"succeeded_rows": succeeded,
+		"failed_rows":    failed,
+		"report":         string(reportJSON),
+		"completed_date": now,
+	})
+}
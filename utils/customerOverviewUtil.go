@@ -0,0 +1,271 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"super-lender/models"
+	"super-lender/schemas"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// CustomerOverviewSections are the sections of the customer overview, in response order
+var CustomerOverviewSections = []string{"profile", "loans", "repayments", "contacts", "referees", "guarantors", "interactions", "flags", "events"}
+
+// CustomerOverviewPermissions are the table-level read permissions sections need on top of seeing the
+// customer, the table the section's data belongs to. Flags are mostly raised on loans, events are the audit trail.
+var CustomerOverviewPermissions = map[string]string{
+	"loans":        "o_loans",
+	"repayments":   "o_loans",
+	"flags":        "o_loans",
+	"interactions": "o_customer_conversations",
+	"events":       "o_events",
+}
+
+const (
+	// OverviewInteractionsLimit is how many of the latest interactions the overview shows
+	OverviewInteractionsLimit = 10
+	// OverviewEventsLimit is how many of the latest events the overview timeline shows
+	OverviewEventsLimit = 20
+)
+
+// ParseOverviewInclude reads the comma separated include= parameter, empty means every section
+func ParseOverviewInclude(include string) ([]string, error) {
+	if strings.TrimSpace(include) == "" {
+		return CustomerOverviewSections, nil
+	}
+
+	var sections []string
+	for _, section := range strings.Split(include, ",") {
+		section = strings.ToLower(strings.TrimSpace(section))
+		if section == "" || StringSliceContains(sections, section) {
+			continue
+		}
+		if !StringSliceContains(CustomerOverviewSections, section) {
+			return nil, fmt.Errorf("unknown section %q, expected one of %s", section, strings.Join(CustomerOverviewSections, ", "))
+		}
+		sections = append(sections, section)
+	}
+
+	return sections, nil
+}
+
+// BuildCustomerOverview loads the requested sections of the overview of a customer, each section on its own
+// connection at the same time. The customer must already be checked against the user's scope.
+func BuildCustomerOverview(db *gorm.DB, customerID int, sections []string) (schemas.CustomerOverviewSchema, error) {
+	var overview schemas.CustomerOverviewSchema
+
+	loaders := map[string]func() error{
+		"profile": func() error {
+			var profile schemas.GetCustomerResultSchema
+			if err := CustomerProfileQueryBuilder(db).Where("c.uid = ?", customerID).Scan(&profile).Error; err != nil {
+				return err
+			}
+			FormatCustomerProfile(&profile)
+			overview.Profile = &profile
+			return nil
+		},
+		"loans": func() error {
+			loans, err := ActiveLoansSummary(db, customerID)
+			overview.Loans = &loans
+			return err
+		},
+		"repayments": func() error {
+			repayments, err := RepaymentBehaviour(db, customerID)
+			overview.Repayments = &repayments
+			return err
+		},
+		"contacts": func() error {
+			overview.Contacts = []schemas.GetCustomerContactsResultSchema{}
+			return CustomerContactsQueryBuilder(db, customerID).Scan(&overview.Contacts).Error
+		},
+		"referees": func() error {
+			overview.Referees = []schemas.GetRefereeResultSchema{}
+			return CustomerRefereesQueryBuilder(db, customerID).Scan(&overview.Referees).Error
+		},
+		"guarantors": func() error {
+			overview.Guarantors = []schemas.GetCustomerGuarantorsResultSchema{}
+			return CustomerGuarantorsQueryBuilder(db, customerID).Scan(&overview.Guarantors).Error
+		},
+		"interactions": func() error {
+			overview.Interactions = []schemas.OverviewInteractionSchema{}
+			return LatestInteractionsQueryBuilder(db, customerID).Limit(OverviewInteractionsLimit).Scan(&overview.Interactions).Error
+		},
+		"flags": func() error {
+			overview.Flags = []schemas.OverviewFlagSchema{}
+			return CustomerFlagsQuery(db, customerID).Scan(&overview.Flags).Error
+		},
+		"events": func() error {
+			overview.Events = []schemas.OverviewEventSchema{}
+			return CustomerEventsQueryBuilder(db, customerID).Limit(OverviewEventsLimit).Scan(&overview.Events).Error
+		},
+	}
+
+	// every loader writes its own field only, so they need no locking
+	var wg sync.WaitGroup
+	errs := make([]error, len(sections))
+	for i, section := range sections {
+		load, ok := loaders[section]
+		if !ok {
+			return overview, fmt.Errorf("unknown overview section %s", section)
+		}
+		wg.Add(1)
+		go func(i int, section string, load func() error) {
+			defer wg.Done()
+			if err := load(); err != nil {
+				errs[i] = fmt.Errorf("overview %s: %w", section, err)
+			}
+		}(i, section, load)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return overview, err
+		}
+	}
+
+	overview.Included = sections
+	return overview, nil
+}
+
+// CustomerProfileQueryBuilder selects the customer profile with the names of the linked records, filter it by c.uid
+func CustomerProfileQueryBuilder(db *gorm.DB) *gorm.DB {
+	query := db.Table("o_customers c")
+	query = query.Select("c.uid, c.passport_photo, c.full_name, c.gender, c.dob, c.national_id, u.name AS added_by, c.loan_limit, c.email_address, c.primary_mobile, t.name AS phone_number_provider, b.name AS branch, c.physical_address, c.total_loans, p.name AS product, c.geolocation AS location_map, c.added_date, bd.icon AS badge_icon, bd.title AS badge_title, bd.description AS badge_description,  cs.name AS status")
+	query = query.Joins("LEFT JOIN o_telecomms t ON c.phone_number_provider = t.uid")
+	query = query.Joins("LEFT JOIN o_users u ON c.added_by = u.uid")
+	query = query.Joins("LEFT JOIN o_branches b ON c.branch = b.uid")
+	query = query.Joins("LEFT JOIN o_loan_products p ON c.primary_product = p.uid")
+	query = query.Joins("LEFT JOIN o_badges bd ON c.badge_id = bd.uid")
+	query = query.Joins("LEFT JOIN o_customer_statuses cs ON c.status = cs.code")
+
+	return query
+}
+
+// FormatCustomerProfile fills in the derived fields of a profile and formats its dates
+func FormatCustomerProfile(profile *schemas.GetCustomerResultSchema) {
+	profile.CurrentLO = profile.AddedBy
+	profile.CurrentCO = profile.AddedBy
+
+	// parse dob into date formatted as yyyy-mm-dd
+	profile.Dob = DateFormatter(profile.Dob)
+
+	// format added_date into yyyy-mm-dd hh:mm:ss and should be in Nairobi TZ want 2024-04-01 10:48:08 not 2024-04-01T10:48:08
+	profile.AddedDate = DatetimeFormatter(profile.AddedDate)
+}
+
+func CustomerContactsQueryBuilder(db *gorm.DB, customerID int) *gorm.DB {
+	query := db.Table("o_customer_contacts c")
+	query = query.Select("c.uid, c.contact_type, c.value, DATE_FORMAT(c.last_update, '%Y-%m-%d %H:%i:%s') AS last_update, c.verified_by > 0 AS verified")
+	query = query.Where("c.customer_id = ?", customerID)
+
+	return query
+}
+
+func CustomerRefereesQueryBuilder(db *gorm.DB, customerID int) *gorm.DB {
+	query := db.Table("o_customer_referees r")
+	query = query.Joins("LEFT JOIN o_customer_referee_relationships rr ON r.relationship = rr.uid")
+	query = query.Select("r.uid, r.referee_name, r.customer_id, r.mobile_no, r.physical_address, rr.name AS relationship, r.added_date")
+	query = query.Where("r.customer_id = ?", customerID)
+
+	return query
+}
+
+func CustomerGuarantorsQueryBuilder(db *gorm.DB, customerID int) *gorm.DB {
+	query := db.Table("o_customer_guarantors g")
+	// join with o_customer_guarantor_relationships to get relationship name
+	query = query.Joins("LEFT JOIN o_customer_guarantor_relationships gr ON gr.uid =g.relationship")
+	query = query.Select("g.uid, g.guarantor_name, g.customer_id, g.mobile_no, g.national_id, g.physical_address, g.amount_guaranteed, g.added_date, gr.name AS relationship, g.status")
+	query = query.Where("g.customer_id = ?", customerID)
+
+	return query
+}
+
+// ActiveLoansSummary totals the open loans of a customer and lists them, the next one due first
+func ActiveLoansSummary(db *gorm.DB, customerID int) (schemas.ActiveLoansSummarySchema, error) {
+	summary := schemas.ActiveLoansSummarySchema{Loans: []schemas.OverviewLoanSchema{}}
+
+	query := db.Table("o_loans l")
+	query = query.Joins("LEFT JOIN o_loan_products p ON l.product_id = p.uid")
+	query = query.Select("l.uid, l.loan_code, p.name AS product, l.loan_amount, l.total_repayable_amount, l.total_repaid, l.loan_balance, l.current_instalment_amount, DATE_FORMAT(l.given_date, '%Y-%m-%d') AS given_date, DATE_FORMAT(l.next_due_date, '%Y-%m-%d') AS next_due_date, DATE_FORMAT(l.final_due_date, '%Y-%m-%d') AS final_due_date, l.status")
+	query = query.Where("l.customer_id = ? AND l.status NOT IN ?", customerID, closedLoanStatuses)
+	if err := query.Order("l.next_due_date ASC").Scan(&summary.Loans).Error; err != nil {
+		return summary, err
+	}
+
+	for _, loan := range summary.Loans {
+		summary.Count++
+		summary.TotalPrincipal += loan.LoanAmount
+		summary.TotalBalance += loan.LoanBalance
+		if summary.NextDueDate == "" && loan.LoanBalance > 0 {
+			summary.NextDueDate = loan.NextDueDate
+		}
+	}
+
+	return summary, nil
+}
+
+// RepaymentBehaviour sums up the loans of a customer that were disbursed, in one pass over o_loans
+func RepaymentBehaviour(db *gorm.DB, customerID int) (schemas.RepaymentBehaviourSchema, error) {
+	var behaviour schemas.RepaymentBehaviourSchema
+
+	query := db.Table("o_loans l")
+	query = query.Select(`COUNT(l.uid) AS total_loans,
+		COALESCE(SUM(l.status = ?), 0) AS cleared_loans,
+		COALESCE(SUM(l.status = ? AND l.last_pay_date <= l.final_due_date), 0) AS cleared_on_time,
+		COALESCE(SUM(l.status = ?), 0) AS overdue_loans,
+		COALESCE(SUM(l.status = ?), 0) AS missed_payments,
+		COALESCE(SUM(l.status IN ?), 0) AS written_off,
+		COALESCE(SUM(l.loan_amount), 0) AS total_borrowed,
+		COALESCE(SUM(l.total_repaid), 0) AS total_repaid,
+		COALESCE(DATE_FORMAT(MAX(l.last_pay_date), '%Y-%m-%d'), '') AS last_pay_date`,
+		models.Cleared, models.Cleared, models.Overdue, models.MissedPayment, []models.LoanStatus{models.WriteOff, models.WrittenOff})
+	query = query.Where("l.customer_id = ? AND l.status NOT IN ?", customerID, []models.LoanStatus{models.Created, models.Pending, models.Rejected, models.Reversed})
+	if err := query.Scan(&behaviour).Error; err != nil {
+		return behaviour, err
+	}
+
+	if behaviour.ClearedLoans > 0 {
+		behaviour.OnTimeRate = float64(behaviour.ClearedOnTime) / float64(behaviour.ClearedLoans)
+	}
+
+	return behaviour, nil
+}
+
+// LatestInteractionsQueryBuilder selects the interactions with a customer, the latest first
+func LatestInteractionsQueryBuilder(db *gorm.DB, customerID int) *gorm.DB {
+	query := db.Table("o_customer_conversations cc")
+	query = query.Joins("LEFT JOIN o_users u ON cc.agent_id = u.uid")
+	query = query.Joins("LEFT JOIN o_conversation_methods cm ON cc.conversation_method = cm.uid")
+	query = query.Select("cc.uid, u.name AS agent, cm.name AS method, cc.loan_id, cc.outcome, cc.flag, cc.transcript, DATE_FORMAT(cc.conversation_date, '%Y-%m-%d %H:%i:%s') AS conversation_date, DATE_FORMAT(cc.next_interaction, '%Y-%m-%d') AS next_interaction")
+	query = query.Where("cc.customer_id = ? AND cc.status = ?", customerID, models.ActiveConversation)
+	query = query.Order("cc.conversation_date DESC, cc.uid DESC")
+
+	return query
+}
+
+// CustomerFlagsQuery selects the active flags raised on a customer and on their open loans
+func CustomerFlagsQuery(db *gorm.DB, customerID int) *gorm.DB {
+	return db.Raw(`SELECT f.uid, f.name, f.description, f.color_code, 'customer' AS source, 0 AS loan_id
+		FROM o_customers c INNER JOIN o_flags f ON f.uid = c.flag
+		WHERE c.uid = ? AND f.status = ?
+		UNION ALL
+		SELECT f.uid, f.name, f.description, f.color_code, 'loan' AS source, l.uid AS loan_id
+		FROM o_loans l INNER JOIN o_flags f ON f.uid = l.loan_flag
+		WHERE l.customer_id = ? AND l.status NOT IN ? AND f.status = ?`,
+		customerID, models.ActiveFlag, customerID, closedLoanStatuses, models.ActiveFlag)
+}
+
+// CustomerEventsQueryBuilder selects the events logged on a customer and their loans, the latest first
+func CustomerEventsQueryBuilder(db *gorm.DB, customerID int) *gorm.DB {
+	query := db.Table("o_events e")
+	query = query.Joins("LEFT JOIN o_users u ON e.event_by = u.uid")
+	query = query.Select("e.uid, e.tbl, e.fld, e.event_details, DATE_FORMAT(e.event_date, '%Y-%m-%d %H:%i:%s') AS event_date, u.name AS event_by")
+	query = query.Where("(e.tbl = ? AND e.fld = ?) OR (e.tbl = ? AND e.fld IN (SELECT l.uid FROM o_loans l WHERE l.customer_id = ?))", "o_customers", customerID, "o_loans", customerID)
+	query = query.Where("e.status = 1")
+	query = query.Order("e.uid DESC")
+
+	return query
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOverviewInclude(t *testing.T) {
+	tests := []struct {
+		name    string
+		include string
+		want    []string
+		wantErr bool
+	}{
+		{"empty means every section", "", CustomerOverviewSections, false},
+		{"blank means every section", "  ", CustomerOverviewSections, false},
+		{"one section", "loans", []string{"loans"}, false},
+		{"order is kept", "events,profile,loans", []string{"events", "profile", "loans"}, false},
+		{"case and spaces are ignored", " Profile , LOANS ", []string{"profile", "loans"}, false},
+		{"duplicates are dropped", "loans,profile,loans", []string{"loans", "profile"}, false},
+		{"empty items are skipped", "profile,,loans,", []string{"profile", "loans"}, false},
+		{"unknown section", "profile,salary", nil, true},
+		{"section names are not prefixes", "loan", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOverviewInclude(tt.include)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseOverviewInclude(%q) error = %v, want error %v", tt.include, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseOverviewInclude(%q) = %v, want %v", tt.include, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomerOverviewPermissions(t *testing.T) {
+	for section := range CustomerOverviewPermissions {
+		if !StringSliceContains(CustomerOverviewSections, section) {
+			t.Errorf("permission mapped for unknown section %q", section)
+		}
+	}
+	for _, tbl := range CustomerOverviewPermissions {
+		if !StringSliceContains(PermissionTables, tbl) {
+			t.Errorf("section permission %q is not in PermissionTables", tbl)
+		}
+	}
+}
@@ -1,14 +1,82 @@
 package utils
 
 import (
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
 
+	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-func FindManyCustomersQueryBuilder(db *gorm.DB, branch, agent, status int, branches []int, readAll bool, searchTerm, queryType string) *gorm.DB {
+// CustomerScope is which customers a user may read. Without table-level read_ on o_customers
+// that is the customers of their branches plus those granted to them record by record,
+// directly or through one of their loans.
+type CustomerScope struct {
+	ReadAll   bool
+	Branches  []int
+	Customers []int
+	Loans     []int
+}
+
+// GetCustomerScope builds the customer scope of the authenticated user
+func GetCustomerScope(c *gin.Context, user models.OUser) CustomerScope {
+	permissions := RequestPermissions(c)
+
+	scope := CustomerScope{ReadAll: permissions.Can("o_customers", "read_")}
+	scope.Branches = GetBranches(c, user, scope.ReadAll)
+	if !scope.ReadAll {
+		scope.Customers = permissions.RecordIDs("o_customers", "read_")
+		scope.Loans = permissions.RecordIDs("o_loans", "read_")
+	}
+
+	return scope
+}
+
+// HasCustomerPermission checks whether the authenticated user may act on a customer, through a grant on
+// o_customers (table or this customer), on the customer's branch, or on one of the customer's loans
+func HasCustomerPermission(c *gin.Context, customer models.OCustomer, act string) bool {
+	permissions := RequestPermissions(c)
+	if permissions.CanRecord("o_customers", customer.UID, act) || IntSliceContains(permissions.RecordIDs("o_branches", act), customer.Branch) {
+		return true
+	}
+
+	loans := permissions.RecordIDs("o_loans", act)
+	if len(loans) == 0 {
+		return false
+	}
+	var count int64
+	inits.CurrentDB.Model(&models.OLoan{}).Where("customer_id = ? AND uid IN (?)", customer.UID, loans).Count(&count)
+	return count > 0
+}
+
+// Apply limits a query to the scope, branchColumn and customerColumn name the
+// columns holding the branch and the customer uid in that query
+func (s CustomerScope) Apply(query *gorm.DB, branchColumn string, customerColumn string) *gorm.DB {
+	if s.ReadAll {
+		return query
+	}
+
+	conditions := []string{branchColumn + " IN (?)"}
+	args := []interface{}{s.Branches}
+	if len(s.Customers) > 0 {
+		conditions = append(conditions, customerColumn+" IN (?)")
+		args = append(args, s.Customers)
+	}
+	if len(s.Loans) > 0 {
+		conditions = append(conditions, customerColumn+" IN (SELECT l.customer_id FROM o_loans l WHERE l.uid IN (?))")
+		args = append(args, s.Loans)
+	}
+
+	return query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+}
+
+// FindManyCustomersQueryBuilder lists customers with the given status, or all but the deleted ones when status is negative
+func FindManyCustomersQueryBuilder(db *gorm.DB, branch, agent, status int, scope CustomerScope, searchTerm, queryType string) *gorm.DB {
 	query := db.Table("o_customers c")
 
 	if queryType == "count" {
@@ -27,12 +95,12 @@ func FindManyCustomersQueryBuilder(db *gorm.DB, branch, agent, status int, branc
 	if agent != 0 {
 		query = query.Where("c.current_agent = ?", agent)
 	}
-	if status != 0 {
+	if status >= 0 {
 		query = query.Where("c.status = ?", status)
+	} else {
+		query = query.Where("c.status != ?", models.DELETED)
 	}
-	if !readAll {
-		query = query.Where("c.branch IN (?)", branches)
-	}
+	query = scope.Apply(query, "c.branch", "c.uid")
 
 	// Apply search term
 	if searchTerm != "" {
@@ -60,3 +128,119 @@ func FindManyCustomersQueryBuilder(db *gorm.DB, branch, agent, status int, branc
 	}
 	return query
 }
+
+// reassignBatchSize is how many customers are moved per transaction in a bulk reassignment
+const reassignBatchSize = 500
+
+// CustomerReassignQueryBuilder selects the customers a reassignment would move, customers already with the target agent are skipped
+func CustomerReassignQueryBuilder(db *gorm.DB, input schemas.CustomerReassignSchema, scope CustomerScope) *gorm.DB {
+	query := db.Table("o_customers c").Where("c.current_agent != ?", input.ToAgent)
+
+	if len(input.UIDs) > 0 {
+		query = query.Where("c.uid IN (?)", input.UIDs)
+	}
+	if input.Branch > 0 {
+		query = query.Where("c.branch = ?", input.Branch)
+	}
+	if input.Agent > 0 {
+		query = query.Where("c.current_agent = ?", input.Agent)
+	}
+	if input.Status != nil {
+		query = query.Where("c.status = ?", *input.Status)
+	}
+	if input.Flag > 0 {
+		query = query.Where("c.flag = ?", input.Flag)
+	}
+
+	return scope.Apply(query, "c.branch", "c.uid")
+}
+
+// reassignLoanColumns are the officer columns of a loan that follow its customer when they belong to the customer's previous agent
+var reassignLoanColumns = []string{"current_agent", "current_lo", "current_co"}
+
+// CountReassignLoans counts the open loans that would follow their customers to the new agent,
+// customerUIDs is a list of uids or a query selecting them
+func CountReassignLoans(db *gorm.DB, customerUIDs interface{}) (int64, error) {
+	var count int64
+	query := db.Model(&models.OLoan{}).Where("customer_id IN (?) AND status NOT IN ?", customerUIDs, closedLoanStatuses)
+
+	conditions := make([]string, len(reassignLoanColumns))
+	for i, column := range reassignLoanColumns {
+		conditions[i] = column + " = (SELECT rc.current_agent FROM o_customers rc WHERE rc.uid = o_loans.customer_id)"
+	}
+	err := query.Where("(" + strings.Join(conditions, " OR ") + ")").Count(&count).Error
+	return count, err
+}
+
+// ReassignCustomers moves the customers to the agent in batches, each batch in its own transaction with an event per customer.
+// With includeLoans the loan officer columns of their open loans that pointed at the previous agent move too.
+func ReassignCustomers(uids []int, toAgent models.OUser, includeLoans bool, by models.OUser) (schemas.CustomerReassignResultSchema, error) {
+	var result schemas.CustomerReassignResultSchema
+
+	for start := 0; start < len(uids); start += reassignBatchSize {
+		end := start + reassignBatchSize
+		if end > len(uids) {
+			end = len(uids)
+		}
+		batch := uids[start:end]
+
+		// counted into the result only once the batch is committed
+		var batchCustomers, batchLoans int64
+		err := inits.CurrentDB.Transaction(func(tx *gorm.DB) error {
+			var previous []struct {
+				UID          int
+				CurrentAgent int
+			}
+			if err := tx.Table("o_customers").Select("uid, current_agent").Where("uid IN (?)", batch).Scan(&previous).Error; err != nil {
+				return err
+			}
+
+			// loans first, while the customers still point at their previous agent
+			if includeLoans {
+				loans, err := CountReassignLoans(tx, batch)
+				if err != nil {
+					return err
+				}
+				batchLoans = loans
+
+				for _, column := range reassignLoanColumns {
+					updated := tx.Model(&models.OLoan{}).
+						Where("customer_id IN (?) AND status NOT IN ?", batch, closedLoanStatuses).
+						Where(column+" = (SELECT rc.current_agent FROM o_customers rc WHERE rc.uid = o_loans.customer_id)").
+						Update(column, toAgent.UID)
+					if updated.Error != nil {
+						return updated.Error
+					}
+				}
+			}
+
+			updated := tx.Model(&models.OCustomer{}).Where("uid IN (?)", batch).Update("current_agent", toAgent.UID)
+			if updated.Error != nil {
+				return updated.Error
+			}
+			batchCustomers = updated.RowsAffected
+
+			events := make([]models.OEvent, len(previous))
+			for i, customer := range previous {
+				events[i] = models.OEvent{
+					Tbl:          "o_customers",
+					Fld:          customer.UID,
+					EventDetails: TruncateString(fmt.Sprintf("Reassigned from agent %d to %s(%d) by %s(%d)", customer.CurrentAgent, toAgent.Name, toAgent.UID, by.Name, by.UID), 250),
+					EventBy:      by.UID,
+				}
+			}
+			if len(events) > 0 {
+				return tx.Create(&events).Error
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+		result.Customers += batchCustomers
+		result.Loans += batchLoans
+		result.Batches++
+	}
+
+	return result, nil
+}
@@ -0,0 +1,209 @@
+package utils
+
+import (
+	"archive/zip"
+	"database/sql/driver"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"super-lender/inits"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// customerExportSections are the tables a data subject export reads, by the column holding the customer uid.
+// Tables missing from a database, e.g repayments on an older install, are skipped.
+var customerExportSections = []struct {
+	Name   string
+	Table  string
+	Column string
+}{
+	{"profile", "o_customers", "uid"},
+	{"contacts", "o_customer_contacts", "customer_id"},
+	{"referees", "o_customer_referees", "customer_id"},
+	{"guarantors", "o_customer_guarantors", "customer_id"},
+	{"guarantees", "o_guarantors", "customer_id"},
+	{"loans", "o_loans", "customer_id"},
+	{"repayments", "o_incoming_payments", "customer_id"},
+	{"conversations", "o_customer_conversations", "customer_id"},
+	{"documents", "o_customer_documents", "customer_id"},
+}
+
+// customerExportOmitted are columns that are credentials or internal references rather than data about the customer
+var customerExportOmitted = []string{"pin_", "sec_data", "enc_phone", "storage_key", "thumbnail_key"}
+
+// CustomerExport is everything held on a customer, rows carry a "source" column naming the database they came from
+type CustomerExport struct {
+	CustomerID  int                                 `json:"customerId"`
+	GeneratedAt string                              `json:"generatedAt"`
+	GeneratedBy int                                 `json:"generatedBy"`
+	Sources     []string                            `json:"sources"`
+	Sections    map[string][]map[string]interface{} `json:"sections"`
+}
+
+// customerExportDatabases are the databases to read, the archive only when it is enabled with ARCHIVE=1
+func customerExportDatabases() map[string]*gorm.DB {
+	databases := map[string]*gorm.DB{CurrentDBScope: inits.CurrentDB}
+	if archiveEnabled() {
+		databases[ArchiveDBScope] = inits.ArchiveDB
+	}
+	return databases
+}
+
+// exportValue turns what the driver scanned into something that reads well in JSON and CSV
+func exportValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	case driver.Valuer:
+		inner, err := v.Value()
+		if err != nil {
+			return nil
+		}
+		return exportValue(inner)
+	}
+	return value
+}
+
+// BuildCustomerExport collects the rows of every export section and the customer's events from the current and archive databases
+func BuildCustomerExport(customerID int, generatedBy int) (CustomerExport, error) {
+	export := CustomerExport{
+		CustomerID:  customerID,
+		GeneratedAt: time.Now().Format("2006-01-02 15:04:05"),
+		GeneratedBy: generatedBy,
+		Sections:    map[string][]map[string]interface{}{},
+	}
+
+	databases := customerExportDatabases()
+	for _, source := range []string{CurrentDBScope, ArchiveDBScope} {
+		db, ok := databases[source]
+		if !ok {
+			continue
+		}
+		export.Sources = append(export.Sources, source)
+
+		var loanIDs []int
+		for _, section := range customerExportSections {
+			if !db.Migrator().HasTable(section.Table) || !db.Migrator().HasColumn(section.Table, section.Column) {
+				continue
+			}
+			var rows []map[string]interface{}
+			query := db.Table(section.Table).Where(section.Column+" = ?", customerID)
+			if db.Migrator().HasColumn(section.Table, "uid") {
+				query = query.Order("uid ASC")
+			}
+			if err := query.Find(&rows).Error; err != nil {
+				return export, fmt.Errorf("exporting %s from %s: %w", section.Name, source, err)
+			}
+			if section.Table == "o_loans" {
+				for _, row := range rows {
+					if uid, err := strconv.Atoi(fmt.Sprint(exportValue(row["uid"]))); err == nil {
+						loanIDs = append(loanIDs, uid)
+					}
+				}
+			}
+			export.Sections[section.Name] = append(export.Sections[section.Name], exportRows(rows, source)...)
+		}
+
+		// the audit trail of the customer and of their loans
+		var events []map[string]interface{}
+		query := db.Table("o_events").Where("(tbl = ? AND fld = ?)", "o_customers", customerID)
+		if len(loanIDs) > 0 {
+			query = query.Or("(tbl = ? AND fld IN (?))", "o_loans", loanIDs)
+		}
+		if err := query.Order("uid ASC").Find(&events).Error; err != nil {
+			return export, fmt.Errorf("exporting events from %s: %w", source, err)
+		}
+		export.Sections["events"] = append(export.Sections["events"], exportRows(events, source)...)
+	}
+
+	return export, nil
+}
+
+func exportRows(rows []map[string]interface{}, source string) []map[string]interface{} {
+	for _, row := range rows {
+		for column, value := range row {
+			row[column] = exportValue(value)
+		}
+		for _, column := range customerExportOmitted {
+			delete(row, column)
+		}
+		row["source"] = source
+	}
+	return rows
+}
+
+// WriteCustomerExportZip writes the export as data.json plus one CSV per section, CSV values a spreadsheet
+// would run as a formula are quoted as in list exports
+func WriteCustomerExportZip(w io.Writer, export CustomerExport) error {
+	archive := zip.NewWriter(w)
+
+	file, err := archive.Create("data.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(export.Sections))
+	for name := range export.Sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		rows := export.Sections[name]
+		if len(rows) == 0 {
+			continue
+		}
+
+		// rows from the two databases may not have the same columns, the header is their union
+		columnSet := map[string]bool{}
+		for _, row := range rows {
+			for column := range row {
+				columnSet[column] = true
+			}
+		}
+		delete(columnSet, "source")
+		columns := []string{"source"}
+		for column := range columnSet {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns[1:])
+
+		file, err := archive.Create(name + ".csv")
+		if err != nil {
+			return err
+		}
+		writer := csv.NewWriter(file)
+		if err := writer.Write(columns); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			record := make([]string, len(columns))
+			for i, column := range columns {
+				if value, ok := row[column]; ok && value != nil {
+					record[i] = spreadsheetSafeText(fmt.Sprint(value))
+				}
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
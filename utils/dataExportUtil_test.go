@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+)
+
+func TestWriteCustomerExportZip(t *testing.T) {
+	export := CustomerExport{
+		CustomerID: 10,
+		Sections: map[string][]map[string]interface{}{
+			"customer": {
+				{"source": "current", "uid": 10, "full_name": "=HYPERLINK(\"http://evil.example\",\"Jane\")", "physical_address": "+254 Main Street", "loan_limit": -500.5},
+			},
+			"interactions": {
+				{"source": "current", "uid": 1, "transcript": "@SUM(A1:A9) was said"},
+				{"source": "archive", "uid": 2, "transcript": "-2+3", "outcome": nil},
+				{"source": "archive", "uid": 3, "transcript": "Promised to pay"},
+			},
+			"contacts": {},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := WriteCustomerExportZip(&out, export); err != nil {
+		t.Fatalf("WriteCustomerExportZip() error = %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("export is not a zip: %v", err)
+	}
+
+	files := map[string][][]string{}
+	for _, file := range archive.File {
+		if file.Name == "data.json" {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		records, err := csv.NewReader(reader).ReadAll()
+		reader.Close()
+		if err != nil {
+			t.Fatalf("%s is not a CSV: %v", file.Name, err)
+		}
+		files[file.Name] = records
+	}
+
+	tests := []struct {
+		file string
+		want [][]string
+	}{
+		{"customer.csv", [][]string{
+			{"source", "full_name", "loan_limit", "physical_address", "uid"},
+			{"current", "'=HYPERLINK(\"http://evil.example\",\"Jane\")", "-500.5", "'+254 Main Street", "10"},
+		}},
+		{"interactions.csv", [][]string{
+			{"source", "outcome", "transcript", "uid"},
+			{"current", "", "'@SUM(A1:A9) was said", "1"},
+			{"archive", "", "'-2+3", "2"},
+			{"archive", "", "Promised to pay", "3"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			if got := files[tt.file]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %q, want %q", tt.file, got, tt.want)
+			}
+		})
+	}
+	if _, ok := files["contacts.csv"]; ok {
+		t.Errorf("empty section was written")
+	}
+}
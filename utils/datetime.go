@@ -98,3 +98,15 @@ func DatetimeFormatter(input string) string {
 func DateFormatter(input string) string {
 	return input[:10]
 }
+
+// ParseOptionalDate parses a YYYY-MM-DD date in Nairobi time, an empty string gives nil
+func ParseOptionalDate(input string) (*time.Time, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, nil
+	}
+	date, err := time.ParseInLocation(DateFormat, strings.TrimSpace(input), loc)
+	if err != nil {
+		return nil, err
+	}
+	return &date, nil
+}
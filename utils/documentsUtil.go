@@ -0,0 +1,223 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"super-lender/inits"
+	"super-lender/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrDocumentTooLarge = errors.New("document is too large")
+var ErrDocumentTypeNotAllowed = errors.New("document type is not allowed")
+
+// documentExtensions are the accepted file types by detected MIME type
+var documentExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"application/pdf": ".pdf",
+}
+
+// thumbnailSize is the longest side of a thumbnail in pixels
+const thumbnailSize = 240
+
+// thumbnailMaxPixels caps the images a thumbnail is made of, a small file can declare dimensions that
+// take gigabytes to decode
+const thumbnailMaxPixels = 50_000_000
+
+var ErrImageTooLarge = errors.New("image dimensions are too large")
+
+// DocumentMaxBytes is the largest file that may be uploaded, DOCUMENT_MAX_SIZE_MB (default 5)
+func DocumentMaxBytes() int64 {
+	megabytes, err := strconv.Atoi(os.Getenv("DOCUMENT_MAX_SIZE_MB"))
+	if err != nil || megabytes <= 0 {
+		megabytes = 5
+	}
+	return int64(megabytes) << 20
+}
+
+// DocumentURLTTL is how long a download link stays valid, DOCUMENT_URL_TTL_MINUTES (default 15)
+func DocumentURLTTL() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("DOCUMENT_URL_TTL_MINUTES"))
+	if err != nil || minutes <= 0 {
+		minutes = 15
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// DetectDocumentType sniffs the MIME type from the content, the name and type sent by the client are not trusted
+func DetectDocumentType(content []byte, documentType models.DocumentType) (string, error) {
+	if int64(len(content)) > DocumentMaxBytes() {
+		return "", ErrDocumentTooLarge
+	}
+
+	mimeType := http.DetectContentType(content)
+	if _, ok := documentExtensions[mimeType]; !ok {
+		return "", ErrDocumentTypeNotAllowed
+	}
+	if documentType == models.PassportPhotoDocument && !strings.HasPrefix(mimeType, "image/") {
+		return "", ErrDocumentTypeNotAllowed
+	}
+	return mimeType, nil
+}
+
+// MakeThumbnail scales an image down to thumbnailSize on its longest side and encodes it as JPEG
+func MakeThumbnail(content []byte) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, errors.New("image is empty")
+	}
+	if int64(config.Width)*int64(config.Height) > thumbnailMaxPixels {
+		return nil, ErrImageTooLarge
+	}
+
+	source, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := source.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return nil, errors.New("image is empty")
+	}
+	scale := float64(thumbnailSize) / float64(max(width, height))
+	if scale > 1 {
+		scale = 1
+	}
+	thumbWidth, thumbHeight := max(1, int(float64(width)*scale)), max(1, int(float64(height)*scale))
+
+	// nearest neighbour is good enough for a preview
+	thumb := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	for y := 0; y < thumbHeight; y++ {
+		for x := 0; x < thumbWidth; x++ {
+			thumb.Set(x, y, source.At(bounds.Min.X+x*width/thumbWidth, bounds.Min.Y+y*height/thumbHeight))
+		}
+	}
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, thumb, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// SaveCustomerDocument stores the file and its thumbnail, then records the metadata. A new passport photo or
+// ID side replaces the previous one, and a passport photo becomes the customer's PassportPhoto.
+func SaveCustomerDocument(storage Storage, customerID int, documentType models.DocumentType, fileName string, content []byte, description string, uploadedBy int) (models.OCustomerDocument, error) {
+	mimeType, err := DetectDocumentType(content, documentType)
+	if err != nil {
+		return models.OCustomerDocument{}, err
+	}
+
+	checksum := sha256.Sum256(content)
+	document := models.OCustomerDocument{
+		CustomerID:   customerID,
+		DocumentType: documentType,
+		FileName:     TruncateString(filepath.Base(fileName), 255),
+		MimeType:     mimeType,
+		Size:         int64(len(content)),
+		Checksum:     hex.EncodeToString(checksum[:]),
+		StorageKey:   fmt.Sprintf("customers/%d/%s%s", customerID, strings.ToLower(SecureRandomString(32)), documentExtensions[mimeType]),
+		Description:  description,
+		UploadedBy:   uploadedBy,
+		Status:       models.ActiveDocument,
+	}
+
+	if err := storage.Put(document.StorageKey, bytes.NewReader(content)); err != nil {
+		return document, err
+	}
+
+	// a photo that cannot be decoded is still kept, it just has no thumbnail
+	if strings.HasPrefix(mimeType, "image/") {
+		if thumbnail, err := MakeThumbnail(content); err == nil {
+			thumbnailKey := strings.TrimSuffix(document.StorageKey, documentExtensions[mimeType]) + "_thumb.jpg"
+			if err := storage.Put(thumbnailKey, bytes.NewReader(thumbnail)); err == nil {
+				document.ThumbnailKey = thumbnailKey
+			}
+		}
+	}
+
+	err = inits.CurrentDB.Transaction(func(tx *gorm.DB) error {
+		if documentType != models.OtherDocument {
+			if err := tx.Model(&models.OCustomerDocument{}).
+				Where("customer_id = ? AND document_type = ? AND status = ?", customerID, documentType, models.ActiveDocument).
+				Update("status", models.ReplacedDocument).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&document).Error; err != nil {
+			return err
+		}
+		if documentType == models.PassportPhotoDocument {
+			return tx.Model(&models.OCustomer{}).Where("uid = ?", customerID).Update("passport_photo", document.StorageKey).Error
+		}
+		return nil
+	})
+	if err != nil {
+		storage.Delete(document.StorageKey)
+		if document.ThumbnailKey != "" {
+			storage.Delete(document.ThumbnailKey)
+		}
+		return document, err
+	}
+
+	return document, nil
+}
+
+// documentSignature signs a download link, thumb tells the file and its thumbnail apart
+func documentSignature(documentID int, thumb bool, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(DefaultIfEmpty(os.Getenv("DOCUMENT_URL_SECRET"), os.Getenv("JWT_SECRET"))))
+	fmt.Fprintf(mac, "%d:%t:%d", documentID, thumb, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignedDocumentURL returns a download link for the document, or its thumbnail, that expires after DocumentURLTTL
+func SignedDocumentURL(documentID int, thumb bool) string {
+	expires := time.Now().Add(DocumentURLTTL()).Unix()
+	url := fmt.Sprintf("%s/documents/%d/download?expires=%d&signature=%s", os.Getenv("DOCUMENT_BASE_URL"), documentID, expires, documentSignature(documentID, thumb, expires))
+	if thumb {
+		url += "&thumb=1"
+	}
+	return url
+}
+
+// VerifyDocumentSignature checks a download link made by SignedDocumentURL and that it has not expired
+func VerifyDocumentSignature(documentID int, thumb bool, expires int64, signature string) bool {
+	if time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(documentSignature(documentID, thumb, expires)), []byte(signature))
+}
+
+func CustomerDocumentsQueryBuilder(db *gorm.DB, customerID int, includeReplaced bool) *gorm.DB {
+	query := db.Table("o_customer_documents d")
+	query = query.Joins("LEFT JOIN o_users u ON u.uid = d.uploaded_by")
+	query = query.Select("d.uid, d.document_type, d.file_name, d.mime_type, d.size, d.checksum, d.thumbnail_key != '' AS has_thumbnail, d.description, IFNULL(u.name, '') AS uploaded_by, DATE_FORMAT(d.uploaded_date, '%Y-%m-%d %H:%i:%s') AS uploaded_date, d.status")
+	query = query.Where("d.customer_id = ?", customerID)
+
+	if includeReplaced {
+		query = query.Where("d.status != ?", models.DeletedDocument)
+	} else {
+		query = query.Where("d.status = ?", models.ActiveDocument)
+	}
+
+	return query.Order("d.uid DESC")
+}
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyDocumentSignature(t *testing.T) {
+	t.Setenv("DOCUMENT_URL_SECRET", "test-secret")
+	t.Setenv("DOCUMENT_BASE_URL", "https://lender.example")
+
+	link, err := url.Parse(SignedDocumentURL(12, false))
+	if err != nil {
+		t.Fatalf("SignedDocumentURL returned an invalid url: %v", err)
+	}
+	expires, err := strconv.ParseInt(link.Query().Get("expires"), 10, 64)
+	if err != nil {
+		t.Fatalf("SignedDocumentURL has no expiry: %s", link)
+	}
+	signature := link.Query().Get("signature")
+	past := time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name       string
+		documentID int
+		thumb      bool
+		expires    int64
+		signature  string
+		want       bool
+	}{
+		{"signed link", 12, false, expires, signature, true},
+		{"other document", 13, false, expires, signature, false},
+		{"thumbnail with the file signature", 12, true, expires, signature, false},
+		{"extended expiry", 12, false, expires + 3600, signature, false},
+		{"expired link", 12, false, past, documentSignature(12, false, past), false},
+		{"altered signature", 12, false, expires, strings.Repeat("0", len(signature)), false},
+		{"empty signature", 12, false, expires, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyDocumentSignature(tt.documentID, tt.thumb, tt.expires, tt.signature); got != tt.want {
+				t.Errorf("VerifyDocumentSignature(%d, %v, %d, %q) = %v, want %v", tt.documentID, tt.thumb, tt.expires, tt.signature, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyDocumentSignatureSecret(t *testing.T) {
+	t.Setenv("DOCUMENT_URL_SECRET", "first-secret")
+	expires := time.Now().Add(time.Hour).Unix()
+	signature := documentSignature(5, true, expires)
+
+	t.Setenv("DOCUMENT_URL_SECRET", "second-secret")
+	if VerifyDocumentSignature(5, true, expires, signature) {
+		t.Errorf("a link signed with another secret was accepted")
+	}
+}
+
+// pngWithSize encodes a small PNG and rewrites the dimensions its header declares
+func pngWithSize(t *testing.T, width, height uint32) []byte {
+	var out bytes.Buffer
+	if err := png.Encode(&out, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	content := out.Bytes()
+
+	// signature (8), IHDR length (4) and type (4), then width and height
+	binary.BigEndian.PutUint32(content[16:], width)
+	binary.BigEndian.PutUint32(content[20:], height)
+	binary.BigEndian.PutUint32(content[29:], crc32.ChecksumIEEE(content[12:29]))
+	return content
+}
+
+func TestMakeThumbnailDimensions(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		wantErr error
+	}{
+		{"small image", pngWithSize(t, 2, 2), nil},
+		{"declared dimensions too large", pngWithSize(t, 100000, 100000), ErrImageTooLarge},
+		{"one very long side", pngWithSize(t, 1<<30, 1), ErrImageTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thumb, err := MakeThumbnail(tt.content)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("MakeThumbnail() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || len(thumb) == 0 {
+				t.Errorf("MakeThumbnail() = %d bytes, %v", len(thumb), err)
+			}
+		})
+	}
+}
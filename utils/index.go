@@ -2,6 +2,7 @@ package utils
 
 import (
 	"bytes"
+	crand "crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
@@ -56,17 +57,22 @@ func QueryParamToStringWithDefault(c *gin.Context, param string, defaultValue st
 }
 
 func GetDBConn(c *gin.Context) *gorm.DB {
-	dbType, _ := c.Get("db")
-	archive := os.Getenv("ARCHIVE")
-	archiveVal, _ := strconv.Atoi(archive)
-
-	if dbType == "archive" && archiveVal == 1 {
+	if IsArchiveConn(c) {
 		return inits.ArchiveDB
 	}
 
 	return inits.CurrentDB
 }
 
+// IsArchiveConn reports whether GetDBConn gives the archive database for this request
+func IsArchiveConn(c *gin.Context) bool {
+	dbType, _ := c.Get("db")
+	archive := os.Getenv("ARCHIVE")
+	archiveVal, _ := strconv.Atoi(archive)
+
+	return dbType == "archive" && archiveVal == 1
+}
+
 func ZeroToOne(val int) int {
 	if val == 1 {
 		return 0
@@ -190,6 +196,39 @@ func GenerateRandomString(length int) string {
 	return string(randomString)
 }
 
+// SecureRandomString generates a random string of given length using crypto/rand, for tokens and secrets
+func SecureRandomString(length int) string {
+	const characters = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	return secureRandomFromCharset(characters, length)
+}
+
+// SecureRandomNumber generates a random numeric string of given length using crypto/rand, for one-time codes
+func SecureRandomNumber(length int) string {
+	return secureRandomFromCharset("0123456789", length)
+}
+
+func secureRandomFromCharset(characters string, length int) string {
+	randomBytes := make([]byte, length)
+	if _, err := crand.Read(randomBytes); err != nil {
+		panic("failed to read random bytes: " + err.Error())
+	}
+
+	// discard bytes at or above the largest multiple of len(characters) to avoid modulo bias
+	limit := byte(256 - 256%len(characters))
+	result := make([]byte, 0, length)
+	for len(result) < length {
+		for _, b := range randomBytes {
+			if b < limit && len(result) < length {
+				result = append(result, characters[int(b)%len(characters)])
+			}
+		}
+		if _, err := crand.Read(randomBytes); err != nil {
+			panic("failed to read random bytes: " + err.Error())
+		}
+	}
+	return string(result)
+}
+
 func GenerateRandomNumber(length int) string {
 	source := rand.NewSource(time.Now().UnixNano())
 	rng := rand.New(source)
@@ -254,33 +293,25 @@ func StoreEvent(tbl string, fld int, eventDetails string, eventBy int) {
 	}
 }
 
+// GetPermission checks a permission using the cached permission set of the user. With rec 0 only
+// table-level grants count, otherwise a grant on that record is enough.
 func GetPermission(userId int, tbl string, rec int, act string) bool {
-	db := inits.CurrentDB
 
-	// Fetch user information
+	// the user is fetched every time, a cached set is only reused while the user is in the same group
+	// (a group can be changed directly in the database, where nothing invalidates the cache)
 	var user models.OUser
-	if err := db.First(&user, userId).Error; err != nil {
+	if err := inits.CurrentDB.First(&user, userId).Error; err != nil {
 		fmt.Println("Error fetching user:", err)
 		return false
 	}
 
-	// Check if the user is an admin
-	if user.UserGroup == 1 {
-		return true
-	}
-
-	// Query for permissions
-	var permissions []models.OPermission
-	query := db.Table("o_permissions")
-	query = query.Where("tbl = ? AND rec = ? AND ? = ?", tbl, rec, act, 1)
-	query = query.Where("group_id = ? OR user_id = ?", user.UserGroup, user.UID)
-	if err := query.Find(&permissions).Error; err != nil {
+	permissions, err := GetPermissionSet(user)
+	if err != nil {
 		fmt.Println("Error fetching permissions:", err)
 		return false
 	}
 
-	// Return true if any permission is found
-	return len(permissions) > 0
+	return permissions.CanRecord(tbl, rec, act)
 }
 
 func GeneratePlaceholders(length int) string {
@@ -300,14 +331,40 @@ func IntSliceContains(slice []int, val int) bool {
 	return false
 }
 
+func StringSliceContains(slice []string, val string) bool {
+	for _, item := range slice {
+		if item == val {
+			return true
+		}
+	}
+	return false
+}
+
 func GetBranches(c *gin.Context, user models.OUser, readAll bool) []int {
 	var branches []int
 	if readAll {
 		branches = append(branches, 0)
 	} else {
 		userBranch := user.Branch
-		db := GetDBConn(c)
-		db.Table("o_staff_branches").Where("agent = ? AND status = 1", user.UID).Select("branch").Scan(&branches)
+		// staff assignments and branch managers live on the current database, archive sessions included,
+		// the archive has no assignment dates. A failure leaves the user with their own branch only.
+		db := inits.CurrentDB
+		if err := db.Table("o_staff_branches").Where("agent = ?", user.UID).Where(ActiveStaffBranchCondition("")).Select("branch").Scan(&branches).Error; err != nil {
+			fmt.Println("Error fetching staff branches:", err)
+		}
+
+		// branches granted record by record, e.g. to auditors, and those they manage themselves or through their region
+		granted := append([]int{}, RequestPermissions(c).RecordIDs("o_branches", "read_")...)
+		managed, err := ManagedBranches(db, user.UID)
+		if err != nil {
+			fmt.Println("Error fetching managed branches:", err)
+		}
+		granted = append(granted, managed...)
+		for _, branch := range granted {
+			if !IntSliceContains(branches, branch) {
+				branches = append(branches, branch)
+			}
+		}
 		if userBranch > 0 {
 			found := false
 			for _, branch := range branches {
@@ -379,7 +436,7 @@ func LogEvent(tbl string, fld int, eventDetails string, eventBy int) {
 	event := models.OEvent{
 		Tbl:          tbl,
 		Fld:          fld,
-		EventDetails: eventDetails,
+		EventDetails: TruncateString(eventDetails, 250), // the column is varchar(250)
 		EventBy:      eventBy,
 	}
 
@@ -574,9 +631,33 @@ func InInterfaceArray(needle interface{}, haystack []interface{}) bool {
 	return false
 }
 
+// TruncateString cuts input to at most length characters, on rune boundaries so multi-byte text stays valid
 func TruncateString(input string, length int) string {
 	if len(input) <= length {
 		return input
 	}
-	return input[:length]
+	count := 0
+	for i := range input {
+		if count == length {
+			return input[:i]
+		}
+		count++
+	}
+	return input
+}
+
+// DefaultIfEmpty returns fallback when input is empty
+func DefaultIfEmpty(input string, fallback string) string {
+	if input == "" {
+		return fallback
+	}
+	return input
+}
+
+// BoolToInt maps true to 1 and false to 0, for the int flags of the legacy tables
+func BoolToInt(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"super-lender/models"
+	"super-lender/schemas"
+
+	"gorm.io/gorm"
+)
+
+var ErrKycIncomplete = errors.New("KYC checklist is incomplete")
+
+// DefaultKycRequirement applies when neither the product nor the default (product 0) checklist is configured
+var DefaultKycRequirement = models.OKycRequirement{RequireNationalID: 1, RequirePhoto: 1, MinReferees: 1}
+
+// InitialCustomerStatus is the status a new customer is created with whatever was requested, they start
+// as leads or drafts and only become active once the KYC checklist passes
+func InitialCustomerStatus(requested models.CustomerStatus) models.CustomerStatus {
+	if requested == models.DRAFT {
+		return models.DRAFT
+	}
+	return models.LEAD
+}
+
+// KycRequirementFor returns the checklist of a product, falling back to the default checklist
+func KycRequirementFor(db *gorm.DB, productID int) (models.OKycRequirement, error) {
+	var requirements []models.OKycRequirement
+	if err := db.Where("product_id IN (?)", []int{productID, 0}).Order("product_id DESC").Find(&requirements).Error; err != nil {
+		return models.OKycRequirement{}, err
+	}
+	if len(requirements) == 0 {
+		return DefaultKycRequirement, nil
+	}
+	return requirements[0], nil
+}
+
+func KycRequirementsQueryBuilder(db *gorm.DB) *gorm.DB {
+	query := db.Table("o_kyc_requirements k")
+	query = query.Joins("LEFT JOIN o_loan_products p ON p.uid = k.product_id")
+	query = query.Joins("LEFT JOIN o_users u ON u.uid = k.updated_by")
+	query = query.Select("k.uid, k.product_id, IF(k.product_id = 0, 'Default', IFNULL(p.name, '')) AS product, k.require_national_id = 1 AS require_national_id, k.require_photo = 1 AS require_photo, k.min_referees, k.min_guarantors, k.require_verified_contacts = 1 AS require_verified_contacts, IFNULL(u.name, '') AS updated_by, DATE_FORMAT(k.updated_date, '%Y-%m-%d %H:%i:%s') AS updated_date")
+	return query.Order("k.product_id ASC")
+}
+
+// EvaluateKyc checks a customer against the checklist of their primary product. Only the items the
+// checklist requires are returned, Missing lists the labels of the ones that did not pass.
+func EvaluateKyc(db *gorm.DB, customer models.OCustomer) (schemas.KycStatusSchema, error) {
+	status := schemas.KycStatusSchema{
+		CustomerID: customer.UID,
+		ProductID:  customer.PrimaryProduct,
+		Status:     int(customer.Status),
+		Checks:     []schemas.KycCheckSchema{},
+		Missing:    []string{},
+	}
+
+	requirement, err := KycRequirementFor(db, customer.PrimaryProduct)
+	if err != nil {
+		return status, err
+	}
+
+	addCheck := func(key, label string, expected, actual int) {
+		check := schemas.KycCheckSchema{Key: key, Label: label, Expected: expected, Actual: actual, Passed: actual >= expected}
+		status.Checks = append(status.Checks, check)
+		if !check.Passed {
+			status.Missing = append(status.Missing, label)
+		}
+	}
+	present := func(value string) int {
+		if value == "" {
+			return 0
+		}
+		return 1
+	}
+
+	if requirement.RequireNationalID == 1 {
+		addCheck("national_id", "National ID", 1, present(customer.NationalID))
+	}
+	if requirement.RequirePhoto == 1 {
+		addCheck("photo", "Passport photo", 1, present(customer.PassportPhoto))
+	}
+	if requirement.MinReferees > 0 {
+		var referees int64
+		if err := db.Model(&models.OCustomerReferee{}).Where("customer_id = ? AND status = 1", customer.UID).Count(&referees).Error; err != nil {
+			return status, err
+		}
+		addCheck("referees", fmt.Sprintf("At least %d referee(s)", requirement.MinReferees), requirement.MinReferees, int(referees))
+	}
+	if requirement.MinGuarantors > 0 {
+		var guarantors int64
+		if err := db.Model(&models.OCustomerGuarantor{}).Where("customer_id = ? AND status = 1", customer.UID).Count(&guarantors).Error; err != nil {
+			return status, err
+		}
+		addCheck("guarantors", fmt.Sprintf("At least %d guarantor(s)", requirement.MinGuarantors), requirement.MinGuarantors, int(guarantors))
+	}
+	if requirement.RequireVerifiedContacts == 1 {
+		// every active contact counts, so a single unverified one fails the check
+		var contacts, verified int64
+		if err := db.Model(&models.OCustomerContacts{}).Where("customer_id = ? AND status = 1", customer.UID).Count(&contacts).Error; err != nil {
+			return status, err
+		}
+		if err := db.Model(&models.OCustomerContacts{}).Where("customer_id = ? AND status = 1 AND verified_by > 0", customer.UID).Count(&verified).Error; err != nil {
+			return status, err
+		}
+		expected := int(contacts)
+		if expected == 0 {
+			expected = 1
+		}
+		addCheck("contacts_verified", "Contacts verified", expected, int(verified))
+	}
+
+	status.Complete = len(status.Missing) == 0
+	return status, nil
+}
+
+// CheckCanActivate returns ErrKycIncomplete, along with the evaluated checklist, unless the customer passes it
+func CheckCanActivate(db *gorm.DB, customer models.OCustomer) (schemas.KycStatusSchema, error) {
+	status, err := EvaluateKyc(db, customer)
+	if err != nil {
+		return status, err
+	}
+	if !status.Complete {
+		return status, ErrKycIncomplete
+	}
+	return status, nil
+}
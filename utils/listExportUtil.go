@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"archive/zip"
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var ErrUnsupportedExportFormat = errors.New("export format must be csv or xlsx")
+
+// ListExporter writes a list row by row, nothing is held in memory beyond the current row
+type ListExporter interface {
+	WriteRow(values []string) error
+	Close() error
+}
+
+// ExportContentType is the Content-Type of an export format
+func ExportContentType(format string) string {
+	if format == "xlsx" {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// NewListExporter returns a writer for format, csv or xlsx
+func NewListExporter(format string, w io.Writer) (ListExporter, error) {
+	switch format {
+	case "csv":
+		return &csvExporter{writer: csv.NewWriter(w)}, nil
+	case "xlsx":
+		return newXLSXExporter(w)
+	}
+	return nil, ErrUnsupportedExportFormat
+}
+
+type csvExporter struct {
+	writer *csv.Writer
+	rows   int
+}
+
+func (e *csvExporter) WriteRow(values []string) error {
+	if err := e.writer.Write(values); err != nil {
+		return err
+	}
+	// flush now and then so the client sees the download progress
+	e.rows++
+	if e.rows%500 == 0 {
+		e.writer.Flush()
+	}
+	return e.writer.Error()
+}
+
+func (e *csvExporter) Close() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// xlsxExporter writes a single sheet workbook with inline strings, so the sheet can be streamed
+// without collecting a shared strings table first
+type xlsxExporter struct {
+	archive *zip.Writer
+	sheet   *bufio.Writer
+	rows    int
+}
+
+var xlsxStaticParts = []struct {
+	Name    string
+	Content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Export" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+func newXLSXExporter(w io.Writer) (*xlsxExporter, error) {
+	archive := zip.NewWriter(w)
+	for _, part := range xlsxStaticParts {
+		file, err := archive.Create(part.Name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(file, part.Content); err != nil {
+			return nil, err
+		}
+	}
+
+	// the sheet is the last entry, it stays open until Close
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	exporter := &xlsxExporter{archive: archive, sheet: bufio.NewWriter(sheet)}
+	_, err = exporter.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return exporter, err
+}
+
+func (e *xlsxExporter) WriteRow(values []string) error {
+	e.rows++
+	e.sheet.WriteString(`<row r="` + strconv.Itoa(e.rows) + `">`)
+	for _, value := range values {
+		e.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+		if err := xml.EscapeText(e.sheet, []byte(xlsxSafeText(value))); err != nil {
+			return err
+		}
+		e.sheet.WriteString(`</t></is></c>`)
+	}
+	_, err := e.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (e *xlsxExporter) Close() error {
+	if _, err := e.sheet.WriteString(`</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	if err := e.sheet.Flush(); err != nil {
+		return err
+	}
+	return e.archive.Close()
+}
+
+// xlsxSafeText drops the control characters XML 1.0 does not allow
+func xlsxSafeText(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, value)
+}
+
+// csvFormulaPrefixes start values a spreadsheet would run as a formula
+const csvFormulaPrefixes = "=+-@"
+
+// isFormulaLike tells whether a spreadsheet would evaluate a value, negative numbers are left alone
+func isFormulaLike(value string) bool {
+	if value == "" || !strings.ContainsRune(csvFormulaPrefixes, rune(value[0])) {
+		return false
+	}
+	_, err := strconv.ParseFloat(value, 64)
+	return err != nil
+}
+
+// spreadsheetSafeText prefixes a value a spreadsheet would run as a formula with a quote
+func spreadsheetSafeText(value string) string {
+	if isFormulaLike(value) {
+		return "'" + value
+	}
+	return value
+}
+
+// StreamQueryExport runs the query and writes its columns as the header row followed by every result row.
+// Values that a spreadsheet would take for a formula are prefixed with a quote. It returns the number of rows written.
+func StreamQueryExport(query *gorm.DB, exporter ListExporter) (int, error) {
+	rows, err := query.Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if err := exporter.WriteRow(columns); err != nil {
+		return 0, err
+	}
+
+	values := make([]sql.NullString, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	count := 0
+	record := make([]string, len(columns))
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return count, err
+		}
+		for i, value := range values {
+			record[i] = spreadsheetSafeText(value.String)
+		}
+		if err := exporter.WriteRow(record); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, rows.Err()
+}
@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"super-lender/inits"
+	"super-lender/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxLoginLockout = 24 * time.Hour
+
+	// failures older than this no longer count towards a lockout
+	loginFailureWindow = 24 * time.Hour
+)
+
+func loginGuardSetting(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// MaxLoginAttempts is the number of failed logins an account may have before it is locked, LOGIN_MAX_ATTEMPTS (default 5)
+func MaxLoginAttempts() int {
+	return loginGuardSetting("LOGIN_MAX_ATTEMPTS", 5)
+}
+
+// MaxLoginAttemptsPerIP is the number of failed logins from one IP before it is locked, LOGIN_MAX_ATTEMPTS_PER_IP (default 20)
+func MaxLoginAttemptsPerIP() int {
+	return loginGuardSetting("LOGIN_MAX_ATTEMPTS_PER_IP", 20)
+}
+
+// LoginLockoutBase is the first lockout period, LOGIN_LOCKOUT_MINUTES (default 1). Every further lockout doubles it up to 24 hours.
+func LoginLockoutBase() time.Duration {
+	return time.Duration(loginGuardSetting("LOGIN_LOCKOUT_MINUTES", 1)) * time.Minute
+}
+
+func UserLoginSubject(userID int) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+func IPLoginSubject(ip string) string {
+	return "ip:" + ip
+}
+
+// RequestLoginSubject is the IP subject of a login request. The address only comes from X-Forwarded-For
+// behind TRUSTED_PROXIES, a client cannot dodge the per-IP lockout by sending a new header every time.
+func RequestLoginSubject(c *gin.Context) string {
+	return IPLoginSubject(c.ClientIP())
+}
+
+// GetLoginLock returns the time until which logins for the subject are refused, ok is false if it is not locked
+func GetLoginLock(subject string) (time.Time, bool) {
+	var lock models.OLoginLock
+	if err := inits.CurrentDB.Where("subject = ?", subject).First(&lock).Error; err != nil {
+		return time.Time{}, false
+	}
+	if lock.LockedUntil == nil || !lock.LockedUntil.After(time.Now()) {
+		return time.Time{}, false
+	}
+	return *lock.LockedUntil, true
+}
+
+// RegisterFailedLogin counts a failed login for the subject and locks it once maxAttempts is reached.
+// It returns the lock expiry when this failure caused a lockout.
+func RegisterFailedLogin(subject string, maxAttempts int) (*time.Time, error) {
+	now := time.Now()
+
+	lock := models.OLoginLock{Subject: subject, LastFailure: now}
+	if err := inits.CurrentDB.Where("subject = ?", subject).FirstOrCreate(&lock).Error; err != nil {
+		return nil, err
+	}
+
+	// a quiet period resets the counters, including the backoff
+	updates := map[string]interface{}{"failed_attempts": gorm.Expr("failed_attempts + 1"), "last_failure": now}
+	if loginFailuresExpired(lock.LastFailure, now) {
+		updates["failed_attempts"] = 1
+		updates["lockouts"] = 0
+	}
+	if err := inits.CurrentDB.Model(&models.OLoginLock{}).Where("uid = ?", lock.UID).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+
+	if err := inits.CurrentDB.First(&lock, lock.UID).Error; err != nil {
+		return nil, err
+	}
+	if lock.FailedAttempts < maxAttempts {
+		return nil, nil
+	}
+
+	lockedUntil := now.Add(loginLockout(lock.Lockouts))
+
+	err := inits.CurrentDB.Model(&models.OLoginLock{}).Where("uid = ?", lock.UID).
+		Updates(map[string]interface{}{"failed_attempts": 0, "lockouts": gorm.Expr("lockouts + 1"), "locked_until": lockedUntil}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &lockedUntil, nil
+}
+
+// loginFailuresExpired reports whether the last failure is old enough for the counters to start over
+func loginFailuresExpired(lastFailure time.Time, now time.Time) bool {
+	return now.Sub(lastFailure) > loginFailureWindow
+}
+
+// loginLockout is how long a subject is locked after the given number of earlier lockouts, doubling every time up to 24 hours
+func loginLockout(lockouts int) time.Duration {
+	lockout := time.Duration(float64(LoginLockoutBase()) * math.Pow(2, float64(lockouts)))
+	if lockout <= 0 || lockout > maxLoginLockout {
+		lockout = maxLoginLockout
+	}
+	return lockout
+}
+
+// ClearLoginLock removes the failed login counters and any lockout of the subject
+func ClearLoginLock(subject string) (bool, error) {
+	result := inits.CurrentDB.Where("subject = ?", subject).Delete(&models.OLoginLock{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// RecordLoginAttempt adds an entry to the login history
+func RecordLoginAttempt(c *gin.Context, userID int, username string, outcome models.LoginOutcome, reason string) {
+	history := models.OLoginHistory{
+		UserID:    userID,
+		Username:  TruncateString(username, 150),
+		IPAddress: c.ClientIP(),
+		UserAgent: TruncateString(c.GetHeader("User-Agent"), 250),
+		Outcome:   outcome,
+		Reason:    reason,
+	}
+
+	if err := inits.CurrentDB.Create(&history).Error; err != nil {
+		fmt.Println("Error storing login history:", err)
+	}
+}
+
+// FailLogin records a failed login and counts it against the IP and, when known, the user.
+// An account lockout is logged as an event on the user.
+func FailLogin(c *gin.Context, user models.OUser, username string, reason string) {
+	RecordLoginAttempt(c, user.UID, username, models.FailedLogin, reason)
+
+	if _, err := RegisterFailedLogin(RequestLoginSubject(c), MaxLoginAttemptsPerIP()); err != nil {
+		fmt.Println("Error counting failed login:", err)
+	}
+
+	if user.UID == 0 {
+		return
+	}
+
+	lockedUntil, err := RegisterFailedLogin(UserLoginSubject(user.UID), MaxLoginAttempts())
+	if err != nil {
+		fmt.Println("Error counting failed login:", err)
+		return
+	}
+	if lockedUntil != nil {
+		LogEvent("o_users", user.UID, fmt.Sprintf("Login of %s(%d) locked until %s after repeated failed attempts from %s", user.Name, user.UID, lockedUntil.In(loc).Format(DateTimeFormat), c.ClientIP()), 0)
+	}
+}
+
+// CheckLoginLocks returns the lock that applies to a login from this IP for the user (UID 0 checks the IP only)
+func CheckLoginLocks(c *gin.Context, user models.OUser) (time.Time, bool) {
+	if lockedUntil, locked := GetLoginLock(RequestLoginSubject(c)); locked {
+		return lockedUntil, true
+	}
+	if user.UID == 0 {
+		return time.Time{}, false
+	}
+	return GetLoginLock(UserLoginSubject(user.UID))
+}
+
+// LoginLockedMessage is the error shown while a login is locked
+func LoginLockedMessage(lockedUntil time.Time) string {
+	minutes := int(math.Ceil(time.Until(lockedUntil).Minutes()))
+	if minutes < 1 {
+		minutes = 1
+	}
+	return fmt.Sprintf("Too many failed login attempts, try again in %d minute(s)", minutes)
+}
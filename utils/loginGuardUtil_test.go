@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoginLockout(t *testing.T) {
+	tests := []struct {
+		name     string
+		minutes  string
+		lockouts int
+		want     time.Duration
+	}{
+		{"first lockout", "", 0, time.Minute},
+		{"second lockout doubles", "", 1, 2 * time.Minute},
+		{"fifth lockout", "", 4, 16 * time.Minute},
+		{"capped at a day", "", 11, 24 * time.Hour},
+		{"overflow is capped", "", 200, 24 * time.Hour},
+		{"configured base", "5", 0, 5 * time.Minute},
+		{"configured base doubles", "5", 2, 20 * time.Minute},
+		{"invalid base falls back", "abc", 1, 2 * time.Minute},
+		{"negative base falls back", "-3", 0, time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LOGIN_LOCKOUT_MINUTES", tt.minutes)
+			if got := loginLockout(tt.lockouts); got != tt.want {
+				t.Errorf("loginLockout(%d) with LOGIN_LOCKOUT_MINUTES=%q = %v, want %v", tt.lockouts, tt.minutes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginFailuresExpired(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		lastFailure time.Time
+		want        bool
+	}{
+		{"just now", now, false},
+		{"an hour ago", now.Add(-time.Hour), false},
+		{"exactly the window", now.Add(-loginFailureWindow), false},
+		{"past the window", now.Add(-loginFailureWindow - time.Second), true},
+		{"never failed", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := loginFailuresExpired(tt.lastFailure, now); got != tt.want {
+				t.Errorf("loginFailuresExpired(%v) = %v, want %v", tt.lastFailure, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestLoginSubject(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		proxies    string
+		remoteAddr string
+		want       string
+	}{
+		{"no proxy", "", "198.51.100.9:5000", "ip:198.51.100.9"},
+		{"untrusted peer", "10.0.0.0/8", "198.51.100.9:5000", "ip:198.51.100.9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRUSTED_PROXIES", tt.proxies)
+
+			r := gin.New()
+			if err := r.SetTrustedProxies(TrustedProxies()); err != nil {
+				t.Fatalf("SetTrustedProxies() error = %v", err)
+			}
+			var subject string
+			r.POST("/users/login", func(c *gin.Context) {
+				subject = RequestLoginSubject(c)
+			})
+
+			// every attempt claims to come from somewhere else
+			for i := 1; i <= 3; i++ {
+				request := httptest.NewRequest(http.MethodPost, "/users/login", nil)
+				request.RemoteAddr = tt.remoteAddr
+				request.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i))
+				r.ServeHTTP(httptest.NewRecorder(), request)
+
+				if subject != tt.want {
+					t.Errorf("attempt %d: RequestLoginSubject() = %q, want %q", i, subject, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"super-lender/inits"
+	"super-lender/models"
+	"time"
+)
+
+// Notifier delivers a message to a staff member over a single channel (sms, email, inapp)
+type Notifier interface {
+	Channel() string
+	Notify(user models.OUser, subject string, message string) error
+}
+
+// SMSGateway sends a plain text message to a phone number
+type SMSGateway interface {
+	Send(phone string, message string) error
+}
+
+// HTTPSMSGateway posts messages as JSON to the gateway configured in SMS_GATEWAY_URL
+type HTTPSMSGateway struct {
+	URL      string
+	APIKey   string
+	SenderID string
+}
+
+func (g HTTPSMSGateway) Send(phone string, message string) error {
+	payload, err := json.Marshal(map[string]string{
+		"to":       phone,
+		"message":  message,
+		"senderId": g.SenderID,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, g.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+g.APIKey)
+	}
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sms gateway responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// LogSMSGateway logs messages instead of sending them, used when no gateway is configured
+type LogSMSGateway struct{}
+
+func (LogSMSGateway) Send(phone string, message string) error {
+	logUndelivered("SMS", phone, "", message)
+	return nil
+}
+
+// logUndelivered notes a message that had nowhere to go. Messages carry one-time codes, so their
+// text is only printed when NOTIFY_LOG_MESSAGES=1, which is meant for development.
+func logUndelivered(channel string, recipient string, subject string, message string) {
+	if subject != "" {
+		subject = " [" + subject + "]"
+	}
+	if os.Getenv("NOTIFY_LOG_MESSAGES") == "1" {
+		fmt.Printf("%s to %s%s: %s\n", channel, recipient, subject, message)
+		return
+	}
+	fmt.Printf("%s to %s%s not sent, no %s delivery is configured\n", channel, recipient, subject, strings.ToLower(channel))
+}
+
+// GetSMSGateway returns the configured sms gateway
+func GetSMSGateway() SMSGateway {
+	url := os.Getenv("SMS_GATEWAY_URL")
+	if url == "" {
+		return LogSMSGateway{}
+	}
+	return HTTPSMSGateway{
+		URL:      url,
+		APIKey:   os.Getenv("SMS_GATEWAY_API_KEY"),
+		SenderID: os.Getenv("SMS_SENDER_ID"),
+	}
+}
+
+type SMSNotifier struct {
+	Gateway SMSGateway
+}
+
+func (SMSNotifier) Channel() string {
+	return "sms"
+}
+
+func (n SMSNotifier) Notify(user models.OUser, subject string, message string) error {
+	if user.Phone == "" {
+		return fmt.Errorf("user %d has no phone number", user.UID)
+	}
+	return n.Gateway.Send(user.Phone, message)
+}
+
+type EmailNotifier struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (EmailNotifier) Channel() string {
+	return "email"
+}
+
+func (n EmailNotifier) Notify(user models.OUser, subject string, message string) error {
+	if user.Email == "" {
+		return fmt.Errorf("user %d has no email address", user.UID)
+	}
+
+	if n.Host == "" {
+		logUndelivered("Email", user.Email, subject, message)
+		return nil
+	}
+
+	body := "From: " + n.From + "\r\n" +
+		"To: " + user.Email + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\n" +
+		message + "\r\n"
+
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+	return smtp.SendMail(n.Host+":"+n.Port, auth, n.From, []string{user.Email}, []byte(body))
+}
+
+// GetEmailNotifier returns an email notifier configured from the SMTP_* variables
+func GetEmailNotifier() EmailNotifier {
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	return EmailNotifier{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+}
+
+// InAppNotifier stores the message in o_notifications for the frontend to display
+type InAppNotifier struct{}
+
+func (InAppNotifier) Channel() string {
+	return "inapp"
+}
+
+func (InAppNotifier) Notify(user models.OUser, subject string, message string) error {
+	notification := models.ONotification{
+		UserID:  user.UID,
+		Subject: TruncateString(subject, 100),
+		Message: message,
+		Status:  models.UnreadNotification,
+	}
+	return inits.CurrentDB.Create(&notification).Error
+}
+
+// GetNotifier returns the notifier for a single channel, nil if the channel is unknown
+func GetNotifier(channel string) Notifier {
+	switch strings.ToLower(strings.TrimSpace(channel)) {
+	case "sms":
+		return SMSNotifier{Gateway: GetSMSGateway()}
+	case "email":
+		return GetEmailNotifier()
+	case "inapp":
+		return InAppNotifier{}
+	}
+	return nil
+}
+
+// GetNotifiers returns the notifiers listed in NOTIFIERS e.g "sms,email,inapp", defaults to inapp
+func GetNotifiers() []Notifier {
+	channels := os.Getenv("NOTIFIERS")
+	if channels == "" {
+		channels = "inapp"
+	}
+
+	var notifiers []Notifier
+	for _, channel := range strings.Split(channels, ",") {
+		if notifier := GetNotifier(channel); notifier != nil {
+			notifiers = append(notifiers, notifier)
+		}
+	}
+	return notifiers
+}
+
+// NotifyUser sends the message through every configured notifier, failures are logged and skipped
+func NotifyUser(user models.OUser, subject string, message string) {
+	for _, notifier := range GetNotifiers() {
+		if err := notifier.Notify(user, subject, message); err != nil {
+			fmt.Printf("Error sending %s notification to user %d: %v\n", notifier.Channel(), user.UID, err)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"super-lender/inits"
+	"super-lender/models"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/sha3"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidResetToken = errors.New("reset token is invalid or has expired")
+
+const (
+	BcryptHash   = "bcrypt"
+	Argon2idHash = "argon2id"
+	LegacyHash   = "legacy"
+)
+
+// argon2id parameters used when PASSWORD_HASH=argon2id
+const (
+	argon2Time    = 1
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2KeyLen  = 32
+)
+
+// HashFormat detects how a stored password hash was produced, anything that is
+// not bcrypt or argon2id is a salted SHA3-256 hash migrated from the old system
+func HashFormat(hash string) string {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return BcryptHash
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return Argon2idHash
+	}
+	return LegacyHash
+}
+
+// HashPassword hashes a password with bcrypt, or argon2id when PASSWORD_HASH=argon2id
+func HashPassword(password string) (string, error) {
+	if os.Getenv("PASSWORD_HASH") == Argon2idHash {
+		salt := []byte(SecureRandomString(16))
+		key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// VerifyPassword checks password against the user's stored hash whatever its format.
+// needsRehash is true when the password matched a hash that should be upgraded.
+func VerifyPassword(user models.OUser, password string) (bool, bool) {
+	format := HashFormat(user.Pass1)
+	switch format {
+	case BcryptHash:
+		ok := bcrypt.CompareHashAndPassword([]byte(user.Pass1), []byte(password)) == nil
+		return ok, ok && os.Getenv("PASSWORD_HASH") == Argon2idHash
+	case Argon2idHash:
+		ok := verifyArgon2id(user.Pass1, password)
+		return ok, ok && os.Getenv("PASSWORD_HASH") != Argon2idHash
+	}
+
+	ok := verifyLegacyPassword(user, password)
+	return ok, ok
+}
+
+// CheckPassword reports whether password matches the user's stored hash
+func CheckPassword(user models.OUser, password string) bool {
+	ok, _ := VerifyPassword(user, password)
+	return ok
+}
+
+func verifyArgon2id(encoded string, password string) bool {
+	// $argon2id$v=19$m=65536,t=1,p=4$<salt>$<key>
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false
+	}
+
+	var memory uint32
+	var iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(computed, key) == 1
+}
+
+// verifyLegacyPassword checks the old system's hash: sha3-256 hex of the salt kept in o_passes.pass followed by the password
+func verifyLegacyPassword(user models.OUser, password string) bool {
+	var pass models.OPass
+	if err := inits.CurrentDB.Where("user = ?", user.UID).Select("pass").First(&pass).Error; err != nil {
+		return false
+	}
+
+	h := sha3.New256()
+	h.Write([]byte(pass.Pass + password))
+	computed := hex.EncodeToString(h.Sum(nil))
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(strings.ToLower(user.Pass1))) == 1
+}
+
+// CountPasswordHashFormats counts accounts per stored hash format
+func CountPasswordHashFormats() (map[string]int64, error) {
+	var counts struct {
+		Bcrypt   int64
+		Argon2id int64
+		Legacy   int64
+	}
+
+	err := inits.CurrentDB.Table("o_users").
+		Select("IFNULL(SUM(pass1 LIKE '$2a$%' OR pass1 LIKE '$2b$%' OR pass1 LIKE '$2y$%'), 0) AS bcrypt, IFNULL(SUM(pass1 LIKE '$argon2id$%'), 0) AS argon2id, IFNULL(SUM(pass1 NOT LIKE '$2a$%' AND pass1 NOT LIKE '$2b$%' AND pass1 NOT LIKE '$2y$%' AND pass1 NOT LIKE '$argon2id$%'), 0) AS legacy").
+		Where("status != ?", models.Delete).
+		Scan(&counts).Error
+
+	return map[string]int64{
+		BcryptHash:   counts.Bcrypt,
+		Argon2idHash: counts.Argon2id,
+		LegacyHash:   counts.Legacy,
+	}, err
+}
+
+// UpdatePassword hashes and stores a new password for the user
+func UpdatePassword(user models.OUser, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return inits.CurrentDB.Model(&models.OUser{}).Where("uid = ?", user.UID).Update("pass1", hash).Error
+}
+
+// passwordResetTTL is how long a reset token stays valid, PASSWORD_RESET_TTL_MINUTES (default 30)
+func passwordResetTTL() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("PASSWORD_RESET_TTL_MINUTES"))
+	if err != nil || minutes <= 0 {
+		minutes = 30
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// CreatePasswordResetToken stores the hash of a new one-time reset token in o_passes and returns the plain token
+func CreatePasswordResetToken(user models.OUser) (string, time.Time, error) {
+	token := SecureRandomString(8)
+	expiry := time.Now().Add(passwordResetTTL())
+
+	var pass models.OPass
+	err := inits.CurrentDB.Where("user = ?", user.UID).First(&pass).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", expiry, err
+	}
+
+	pass.User = user.UID
+	pass.PassResetToken = Sha256Hash(token)
+	pass.ResetExpiry = &expiry
+	pass.ResetStatus = models.PendingPassReset
+
+	if err := inits.CurrentDB.Save(&pass).Error; err != nil {
+		return "", expiry, err
+	}
+
+	return token, expiry, nil
+}
+
+// ConsumePasswordResetToken checks a reset token and marks it used so it cannot be replayed
+func ConsumePasswordResetToken(user models.OUser, token string) error {
+	var pass models.OPass
+	if err := inits.CurrentDB.Where("user = ? AND reset_status = ?", user.UID, models.PendingPassReset).First(&pass).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	if pass.ResetExpiry == nil || time.Now().After(*pass.ResetExpiry) {
+		return ErrInvalidResetToken
+	}
+
+	if subtle.ConstantTimeCompare([]byte(pass.PassResetToken), []byte(Sha256Hash(token))) != 1 {
+		return ErrInvalidResetToken
+	}
+
+	result := inits.CurrentDB.Model(&models.OPass{}).
+		Where("uid = ? AND reset_status = ?", pass.UID, models.PendingPassReset).
+		Updates(map[string]interface{}{"pass_reset_token": "", "reset_status": models.UsedPassReset})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidResetToken
+	}
+
+	return nil
+}
+
+// SendPasswordResetToken delivers the reset token over sms or email
+func SendPasswordResetToken(user models.OUser, channel string, token string, expiry time.Time) error {
+	notifier := GetNotifier(channel)
+	if notifier == nil || notifier.Channel() == "inapp" {
+		return fmt.Errorf("unsupported channel %s", channel)
+	}
+
+	message := fmt.Sprintf("Your password reset code is %s. It expires at %s. If you did not request a reset, ignore this message.", token, expiry.Format("15:04"))
+	if resetURL := os.Getenv("PASSWORD_RESET_URL"); resetURL != "" && notifier.Channel() == "email" {
+		message += fmt.Sprintf("\n\nYou can also reset it here: %s?token=%s", resetURL, token)
+	}
+
+	return notifier.Notify(user, "Password reset", message)
+}
@@ -0,0 +1,398 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminUserGroup is the user group that holds every permission
+const AdminUserGroup = 1
+
+// PermissionActions are the action columns of o_permissions
+var PermissionActions = []string{"general_", "create_", "read_", "update_", "delete_", "block_", "unblock_", "export_"}
+
+// PermissionTables are listed in the permission matrix even when a group has no grant on them
+var PermissionTables = []string{"o_customers", "o_customer_contacts", "o_customer_conversations", "o_loans", "o_branches", "o_users", "o_user_groups", "o_permissions", "o_api_keys", "o_regions", "o_kyc_requirements", "o_events"}
+
+// PermissionSet is what a user may do, by table and action. An action is allowed when
+// the group's row or the user's own row for the table allows it. Records holds the uids
+// of single records the user or group was granted an action on (rows with rec > 0).
+type PermissionSet struct {
+	UserID    int
+	UserGroup int
+	Admin     bool
+	Tables    map[string]map[string]bool
+	Records   map[string]map[string][]int
+}
+
+// Can reports whether the set allows act on the whole of tbl
+func (p PermissionSet) Can(tbl string, act string) bool {
+	if p.Admin {
+		return true
+	}
+	return p.Tables[tbl][act]
+}
+
+// CanRecord reports whether the set allows act on the record rec of tbl, a table-level grant covers every record
+func (p PermissionSet) CanRecord(tbl string, rec int, act string) bool {
+	if p.Can(tbl, act) {
+		return true
+	}
+	return rec > 0 && IntSliceContains(p.Records[tbl][act], rec)
+}
+
+// RecordIDs returns the records of tbl the set allows act on through record-level grants
+func (p PermissionSet) RecordIDs(tbl string, act string) []int {
+	return p.Records[tbl][act]
+}
+
+// CanAny reports whether the set allows act on tbl or on at least one of its records
+func (p PermissionSet) CanAny(tbl string, act string) bool {
+	return p.Can(tbl, act) || len(p.Records[tbl][act]) > 0
+}
+
+// PermissionFlags maps the action columns of a permission row to their values
+func PermissionFlags(permission models.OPermission) map[string]bool {
+	return map[string]bool{
+		"general_": permission.General == 1,
+		"create_":  permission.Create == 1,
+		"read_":    permission.Read == 1,
+		"update_":  permission.Update == 1,
+		"delete_":  permission.Delete == 1,
+		"block_":   permission.Block == 1,
+		"unblock_": permission.Unblock == 1,
+		"export_":  permission.Export == 1,
+	}
+}
+
+// setPermissionFlag sets the field of models.OPermission behind an action column
+func setPermissionFlag(permission *models.OPermission, act string, value int) {
+	switch act {
+	case "general_":
+		permission.General = value
+	case "create_":
+		permission.Create = value
+	case "read_":
+		permission.Read = value
+	case "update_":
+		permission.Update = value
+	case "delete_":
+		permission.Delete = value
+	case "block_":
+		permission.Block = value
+	case "unblock_":
+		permission.Unblock = value
+	case "export_":
+		permission.Export = value
+	}
+}
+
+// LoadPermissionSet reads the table-level grants of the user's group and the user's own overrides
+func LoadPermissionSet(user models.OUser) (PermissionSet, error) {
+	set := PermissionSet{
+		UserID:    user.UID,
+		UserGroup: user.UserGroup,
+		Admin:     user.UserGroup == AdminUserGroup,
+		Tables:    map[string]map[string]bool{},
+		Records:   map[string]map[string][]int{},
+	}
+	if set.Admin {
+		return set, nil
+	}
+
+	var permissions []models.OPermission
+	query := inits.CurrentDB.Where("(group_id = ? AND user_id = 0) OR user_id = ?", user.UserGroup, user.UID)
+	if err := query.Find(&permissions).Error; err != nil {
+		return set, err
+	}
+	set.add(permissions)
+
+	return set, nil
+}
+
+// add merges permission rows into the set, group and user grants add up, for tables as for records
+func (p *PermissionSet) add(permissions []models.OPermission) {
+	for _, permission := range permissions {
+		if permission.Rec == 0 {
+			if p.Tables[permission.Tbl] == nil {
+				p.Tables[permission.Tbl] = map[string]bool{}
+			}
+			for act, allowed := range PermissionFlags(permission) {
+				p.Tables[permission.Tbl][act] = p.Tables[permission.Tbl][act] || allowed
+			}
+			continue
+		}
+
+		if p.Records[permission.Tbl] == nil {
+			p.Records[permission.Tbl] = map[string][]int{}
+		}
+		for act, allowed := range PermissionFlags(permission) {
+			if allowed && !IntSliceContains(p.Records[permission.Tbl][act], permission.Rec) {
+				p.Records[permission.Tbl][act] = append(p.Records[permission.Tbl][act], permission.Rec)
+			}
+		}
+	}
+}
+
+type cachedPermissionSet struct {
+	set      PermissionSet
+	loadedAt time.Time
+}
+
+var permissionCache = struct {
+	sync.RWMutex
+	sets map[int]cachedPermissionSet
+}{sets: map[int]cachedPermissionSet{}}
+
+// PermissionCacheTTL is how long a loaded permission set is reused, PERMISSION_CACHE_TTL seconds (default 60, 0 disables the cache)
+func PermissionCacheTTL() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("PERMISSION_CACHE_TTL"))
+	if err != nil || seconds < 0 {
+		seconds = 60
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// GetPermissionSet returns the user's permission set from the cache, loading it when missing,
+// expired or cached for another user group
+func GetPermissionSet(user models.OUser) (PermissionSet, error) {
+	ttl := PermissionCacheTTL()
+
+	permissionCache.RLock()
+	cached, ok := permissionCache.sets[user.UID]
+	permissionCache.RUnlock()
+	if ok && cached.set.UserGroup == user.UserGroup && time.Since(cached.loadedAt) < ttl {
+		return cached.set, nil
+	}
+
+	set, err := LoadPermissionSet(user)
+	if err != nil {
+		return set, err
+	}
+
+	if ttl > 0 {
+		permissionCache.Lock()
+		permissionCache.sets[user.UID] = cachedPermissionSet{set: set, loadedAt: time.Now()}
+		permissionCache.Unlock()
+	}
+
+	return set, nil
+}
+
+// InvalidatePermissions drops the cached permission set of the user, or of everyone when userID is 0
+func InvalidatePermissions(userID int) {
+	permissionCache.Lock()
+	defer permissionCache.Unlock()
+
+	if userID == 0 {
+		permissionCache.sets = map[int]cachedPermissionSet{}
+		return
+	}
+	delete(permissionCache.sets, userID)
+}
+
+// RequestPermissions returns the permission set of the authenticated user, loaded once per request
+func RequestPermissions(c *gin.Context) PermissionSet {
+	if permissions, ok := c.Get("permissions"); ok {
+		return permissions.(PermissionSet)
+	}
+
+	user := c.MustGet("user").(models.OUser)
+	permissions, err := GetPermissionSet(user)
+	if err != nil {
+		fmt.Println("Error fetching permissions:", err)
+	}
+
+	c.Set("permissions", permissions)
+	return permissions
+}
+
+// HasPermission checks a table-level permission of the authenticated user
+func HasPermission(c *gin.Context, tbl string, act string) bool {
+	return RequestPermissions(c).Can(tbl, act)
+}
+
+// HasRecordPermission checks whether the authenticated user may act on one record, through a table or record grant
+func HasRecordPermission(c *gin.Context, tbl string, rec int, act string) bool {
+	return RequestPermissions(c).CanRecord(tbl, rec, act)
+}
+
+// AbortForbidden responds with the 403 body shared by every permission check
+func AbortForbidden(c *gin.Context, tbl string, act string) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"status":     403,
+		"message":    "You don't have permission to perform this action!",
+		"permission": tbl + "." + act,
+	})
+}
+
+// PermissionRow converts a permission row for API responses
+func PermissionRow(permission models.OPermission) schemas.PermissionRowSchema {
+	return schemas.PermissionRowSchema{
+		UID:     permission.UID,
+		GroupID: permission.GroupID,
+		UserID:  permission.UserID,
+		Tbl:     permission.Tbl,
+		Rec:     permission.Rec,
+		Actions: PermissionFlags(permission),
+	}
+}
+
+// GetPermissionMatrix returns the group's table-level grants for every known table, and its record-level grants
+func GetPermissionMatrix(groupID int) ([]schemas.PermissionRowSchema, []schemas.PermissionRowSchema, error) {
+	var permissions []models.OPermission
+	if err := inits.CurrentDB.Where("group_id = ? AND user_id = 0", groupID).Order("tbl ASC, rec ASC").Find(&permissions).Error; err != nil {
+		return nil, nil, err
+	}
+
+	tables := map[string]schemas.PermissionRowSchema{}
+	for _, tbl := range PermissionTables {
+		tables[tbl] = PermissionRow(models.OPermission{GroupID: groupID, Tbl: tbl})
+	}
+
+	records := []schemas.PermissionRowSchema{}
+	for _, permission := range permissions {
+		if permission.Rec > 0 {
+			records = append(records, PermissionRow(permission))
+			continue
+		}
+		tables[permission.Tbl] = PermissionRow(permission)
+	}
+
+	matrix := make([]schemas.PermissionRowSchema, 0, len(tables))
+	for _, row := range tables {
+		matrix = append(matrix, row)
+	}
+	sort.Slice(matrix, func(i, j int) bool { return matrix[i].Tbl < matrix[j].Tbl })
+
+	return matrix, records, nil
+}
+
+func findPermissionRow(grant schemas.PermissionGrantSchema) (models.OPermission, bool) {
+	var permission models.OPermission
+	err := inits.CurrentDB.Where("group_id = ? AND user_id = ? AND tbl = ? AND rec = ?", grant.GroupID, grant.UserID, grant.Tbl, grant.Rec).First(&permission).Error
+	return permission, err == nil
+}
+
+// SetPermissionActions grants (value 1) or revokes (value 0) actions on the group's or user's row for the table
+// or record, creating the row when needed. User rows add to the group's grants, revoking an action from a user
+// does not take away what their group allows.
+func SetPermissionActions(grant schemas.PermissionGrantSchema, value int) (models.OPermission, error) {
+	permission, found := findPermissionRow(grant)
+	if !found {
+		permission = models.OPermission{GroupID: grant.GroupID, UserID: grant.UserID, Tbl: grant.Tbl, Rec: grant.Rec}
+	}
+
+	for _, act := range grant.Actions {
+		setPermissionFlag(&permission, act, value)
+	}
+
+	if err := inits.CurrentDB.Save(&permission).Error; err != nil {
+		return permission, err
+	}
+
+	invalidateGrant(grant)
+	return permission, nil
+}
+
+// GroupGrantedActions returns which of the actions the user's group allows on the table or record,
+// those stay allowed whatever the user's own row says
+func GroupGrantedActions(userID int, tbl string, rec int, actions []string) ([]string, error) {
+	var user models.OUser
+	if err := inits.CurrentDB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	granted := []string{}
+	groupPermission, ok := findPermissionRow(schemas.PermissionGrantSchema{GroupID: user.UserGroup, Tbl: tbl, Rec: rec})
+	if !ok {
+		return granted, nil
+	}
+	flags := PermissionFlags(groupPermission)
+	for _, act := range actions {
+		if flags[act] {
+			granted = append(granted, act)
+		}
+	}
+
+	return granted, nil
+}
+
+// invalidateGrant drops the cached permission sets a grant change affects, a group row is shared
+// by every member of the group so it drops them all
+func invalidateGrant(grant schemas.PermissionGrantSchema) {
+	if grant.UserID > 0 {
+		InvalidatePermissions(grant.UserID)
+		return
+	}
+	InvalidatePermissions(0)
+}
+
+// RemovePermission deletes the group's or user's row for the table or record, found is false if there was none
+func RemovePermission(grant schemas.PermissionGrantSchema) (models.OPermission, bool, error) {
+	permission, found := findPermissionRow(grant)
+	if !found {
+		return permission, false, nil
+	}
+
+	if err := inits.CurrentDB.Delete(&permission).Error; err != nil {
+		return permission, true, err
+	}
+
+	invalidateGrant(grant)
+	return permission, true, nil
+}
+
+// ExplainPermissions lists what the user may do on each table and record and whether it comes from their group or their own grants
+func ExplainPermissions(user models.OUser) ([]schemas.PermissionExplainSchema, error) {
+	explained := []schemas.PermissionExplainSchema{}
+
+	if user.UserGroup == AdminUserGroup {
+		actions := map[string]bool{}
+		for _, act := range PermissionActions {
+			actions[act] = true
+		}
+		explained = append(explained, schemas.PermissionExplainSchema{Tbl: "*", Source: "admin", Actions: actions})
+		return explained, nil
+	}
+
+	var permissions []models.OPermission
+	query := inits.CurrentDB.Where("(group_id = ? AND user_id = 0) OR user_id = ?", user.UserGroup, user.UID)
+	if err := query.Order("tbl ASC, rec ASC, user_id ASC").Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+
+	// the group's and the user's rows for the same table or record are merged, source then says both
+	index := map[string]int{}
+	for _, permission := range permissions {
+		source := "group"
+		if permission.UserID > 0 {
+			source = "user"
+		}
+
+		row := schemas.PermissionExplainSchema{Tbl: permission.Tbl, Rec: permission.Rec, Source: source, Actions: PermissionFlags(permission)}
+		key := fmt.Sprintf("%s:%d", permission.Tbl, permission.Rec)
+		if i, ok := index[key]; ok {
+			explained[i].Source = "group+user"
+			for act, allowed := range row.Actions {
+				explained[i].Actions[act] = explained[i].Actions[act] || allowed
+			}
+			continue
+		}
+
+		index[key] = len(explained)
+		explained = append(explained, row)
+	}
+
+	return explained, nil
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"reflect"
+	"super-lender/models"
+	"testing"
+)
+
+func TestPermissionSetMerge(t *testing.T) {
+	group := func(tbl string, rec int, read, update int) models.OPermission {
+		return models.OPermission{GroupID: 2, Tbl: tbl, Rec: rec, Read: read, Update: update}
+	}
+	user := func(tbl string, rec int, read, update int) models.OPermission {
+		return models.OPermission{GroupID: 2, UserID: 7, Tbl: tbl, Rec: rec, Read: read, Update: update}
+	}
+
+	type check struct {
+		tbl     string
+		rec     int
+		act     string
+		can     bool
+		record  bool
+		records []int
+	}
+	tests := []struct {
+		name        string
+		permissions []models.OPermission
+		checks      []check
+	}{
+		{
+			name:        "no rows",
+			permissions: nil,
+			checks:      []check{{"o_loans", 0, "read_", false, false, nil}},
+		},
+		{
+			name:        "group row alone",
+			permissions: []models.OPermission{group("o_loans", 0, 1, 0)},
+			checks: []check{
+				{"o_loans", 0, "read_", true, true, nil},
+				{"o_loans", 0, "update_", false, false, nil},
+			},
+		},
+		{
+			name:        "user row adds to the group row",
+			permissions: []models.OPermission{group("o_loans", 0, 1, 0), user("o_loans", 0, 0, 1)},
+			checks: []check{
+				{"o_loans", 0, "read_", true, true, nil},
+				{"o_loans", 0, "update_", true, true, nil},
+			},
+		},
+		{
+			name:        "user row does not take away a group grant",
+			permissions: []models.OPermission{group("o_loans", 0, 1, 1), user("o_loans", 0, 0, 0)},
+			checks: []check{
+				{"o_loans", 0, "read_", true, true, nil},
+				{"o_loans", 0, "update_", true, true, nil},
+			},
+		},
+		{
+			name:        "order of rows does not matter",
+			permissions: []models.OPermission{user("o_loans", 0, 0, 0), group("o_loans", 0, 1, 0)},
+			checks:      []check{{"o_loans", 0, "read_", true, true, nil}},
+		},
+		{
+			name:        "record rows only cover their record",
+			permissions: []models.OPermission{group("o_branches", 3, 1, 0), user("o_branches", 5, 1, 1)},
+			checks: []check{
+				{"o_branches", 3, "read_", false, true, []int{3, 5}},
+				{"o_branches", 4, "read_", false, false, []int{3, 5}},
+				{"o_branches", 5, "update_", false, true, []int{5}},
+				{"o_branches", 3, "update_", false, false, []int{5}},
+			},
+		},
+		{
+			name:        "the same record from group and user is listed once",
+			permissions: []models.OPermission{group("o_branches", 3, 1, 0), user("o_branches", 3, 1, 0)},
+			checks:      []check{{"o_branches", 3, "read_", false, true, []int{3}}},
+		},
+		{
+			name:        "table grant covers every record",
+			permissions: []models.OPermission{group("o_customers", 0, 1, 0)},
+			checks:      []check{{"o_customers", 42, "read_", true, true, nil}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := PermissionSet{Tables: map[string]map[string]bool{}, Records: map[string]map[string][]int{}}
+			set.add(tt.permissions)
+
+			for _, c := range tt.checks {
+				if got := set.Can(c.tbl, c.act); got != c.can {
+					t.Errorf("Can(%s, %s) = %v, want %v", c.tbl, c.act, got, c.can)
+				}
+				if got := set.CanRecord(c.tbl, c.rec, c.act); got != c.record {
+					t.Errorf("CanRecord(%s, %d, %s) = %v, want %v", c.tbl, c.rec, c.act, got, c.record)
+				}
+				if got := set.RecordIDs(c.tbl, c.act); !reflect.DeepEqual(got, c.records) {
+					t.Errorf("RecordIDs(%s, %s) = %v, want %v", c.tbl, c.act, got, c.records)
+				}
+			}
+		})
+	}
+}
+
+func TestPermissionSetAdmin(t *testing.T) {
+	set := PermissionSet{Admin: true}
+	if !set.Can("o_users", "delete_") || !set.CanRecord("o_users", 3, "delete_") || !set.CanAny("o_users", "delete_") {
+		t.Errorf("admin set does not allow everything")
+	}
+}
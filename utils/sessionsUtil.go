@@ -0,0 +1,278 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidSession = errors.New("session is invalid or has expired")
+var ErrRefreshTokenReused = errors.New("refresh token was already used")
+
+// Scopes carried by access tokens, the first element of a scope is always the database
+const (
+	CurrentDBScope = "current"
+	ArchiveDBScope = "archive"
+	ReadScope      = "read"
+	WriteScope     = "write"
+)
+
+// AccessTokenTTL is the lifetime of a JWT access token, ACCESS_TOKEN_TTL_MINUTES (default 15)
+func AccessTokenTTL() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("ACCESS_TOKEN_TTL_MINUTES"))
+	if err != nil || minutes <= 0 {
+		minutes = 15
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// RefreshTokenTTL is the lifetime of a session's refresh token, REFRESH_TOKEN_TTL_DAYS (default 30)
+func RefreshTokenTTL() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("REFRESH_TOKEN_TTL_DAYS"))
+	if err != nil || days <= 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// ParseUserAgent extracts a browser and operating system name from a User-Agent header
+func ParseUserAgent(userAgent string) (string, string) {
+	browser := "Unknown"
+	switch {
+	case strings.Contains(userAgent, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(userAgent, "OPR/") || strings.Contains(userAgent, "Opera"):
+		browser = "Opera"
+	case strings.Contains(userAgent, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(userAgent, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(userAgent, "Safari/"):
+		browser = "Safari"
+	case userAgent != "":
+		browser = TruncateString(strings.SplitN(userAgent, " ", 2)[0], 250)
+	}
+
+	operatingSystem := "Unknown"
+	switch {
+	case strings.Contains(userAgent, "Android"):
+		operatingSystem = "Android"
+	case strings.Contains(userAgent, "iPhone") || strings.Contains(userAgent, "iPad"):
+		operatingSystem = "iOS"
+	case strings.Contains(userAgent, "Windows"):
+		operatingSystem = "Windows"
+	case strings.Contains(userAgent, "Mac OS"):
+		operatingSystem = "macOS"
+	case strings.Contains(userAgent, "Linux"):
+		operatingSystem = "Linux"
+	}
+
+	return browser, operatingSystem
+}
+
+// CreateSession stores a new session for the user in o_tokens and returns it with the plain refresh token
+func CreateSession(c *gin.Context, user models.OUser, scope []string, ttl time.Duration) (models.OToken, string, error) {
+	refreshToken := SecureRandomString(64)
+	browser, operatingSystem := ParseUserAgent(c.GetHeader("User-Agent"))
+
+	session := models.OToken{
+		UserID:      user.UID,
+		Token:       Sha256Hash(refreshToken),
+		Scope:       strings.Join(scope, ","),
+		ExpiryDate:  time.Now().Add(ttl),
+		DeviceID:    TruncateString(c.GetHeader("X-Device-ID"), 245),
+		BrowserName: browser,
+		IPAddress:   c.ClientIP(),
+		OS:          operatingSystem,
+		Status:      models.ValidToken,
+	}
+
+	if err := inits.CurrentDB.Create(&session).Error; err != nil {
+		return session, "", err
+	}
+
+	return session, refreshToken, nil
+}
+
+// IssueAccessToken signs a short-lived JWT bound to the session sid
+func IssueAccessToken(userID int, sessionID uint, scope []string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"uid":   userID,
+		"sid":   sessionID,
+		"scope": scope,
+		"exp":   time.Now().Add(AccessTokenTTL()).Unix(),
+	})
+
+	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+}
+
+// BuildTokenResponse assembles the token payload returned by login and refresh
+func BuildTokenResponse(session models.OToken, accessToken string, refreshToken string) schemas.UserTokenSchema {
+	return schemas.UserTokenSchema{
+		Token:            accessToken,
+		ExpiresIn:        int(AccessTokenTTL().Seconds()),
+		TokenType:        "Bearer",
+		Scope:            SessionScope(session),
+		RefreshToken:     refreshToken,
+		RefreshExpiresIn: int(time.Until(session.ExpiryDate).Seconds()),
+	}
+}
+
+// storedSessionScope returns the scope stored on a session, before archive sessions are made read-only
+func storedSessionScope(session models.OToken) []string {
+	if session.Scope == "" {
+		return []string{CurrentDBScope, ReadScope, WriteScope}
+	}
+	return strings.Split(session.Scope, ",")
+}
+
+// IsFullSession reports whether a session came from a login with write access, archive sessions included,
+// as opposed to a read-only token
+func IsFullSession(session models.OToken) bool {
+	return ScopeContains(storedSessionScope(session), WriteScope)
+}
+
+// SessionScope returns the scope a session's access tokens carry
+func SessionScope(session models.OToken) []string {
+	return EffectiveScope(storedSessionScope(session))
+}
+
+// EffectiveScope normalises a scope: an unknown database falls back to current and
+// archived data is read-only, so write is dropped from archive scopes
+func EffectiveScope(scope []string) []string {
+	effective := []string{CurrentDBScope}
+	if len(scope) > 0 && scope[0] == ArchiveDBScope {
+		effective[0] = ArchiveDBScope
+	}
+
+	for i, s := range scope {
+		if i == 0 || (s != ReadScope && s != WriteScope) || ScopeContains(effective, s) {
+			continue
+		}
+		if s == WriteScope && effective[0] == ArchiveDBScope {
+			continue
+		}
+		effective = append(effective, s)
+	}
+
+	return effective
+}
+
+// ScopeContains reports whether scope includes s
+func ScopeContains(scope []string, s string) bool {
+	for _, item := range scope {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SwitchSessionDB points the session at another database. The read and write scopes the session
+// was created with are kept, so switching back from the read-only archive restores write access.
+func SwitchSessionDB(session models.OToken, db string) ([]string, error) {
+	stored := storedSessionScope(session)
+	scope := append([]string{db}, stored[1:]...)
+	if err := UpdateSessionScope(session, scope); err != nil {
+		return nil, err
+	}
+	return EffectiveScope(scope), nil
+}
+
+// FindActiveSession returns the user's session if it is still valid and not expired
+func FindActiveSession(sessionID uint, userID int) (models.OToken, error) {
+	var session models.OToken
+	err := inits.CurrentDB.Where("uid = ? AND user_id = ? AND status = ? AND expiry_date > ?", sessionID, userID, models.ValidToken, time.Now()).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return session, ErrInvalidSession
+	}
+	return session, err
+}
+
+// RefreshSession exchanges a refresh token for a new one on the same session, the old refresh token stops working.
+// Presenting the refresh token that was rotated out means it was copied, the session is revoked and
+// ErrRefreshTokenReused returned with it.
+func RefreshSession(refreshToken string) (models.OToken, string, error) {
+	var session models.OToken
+	hash := Sha256Hash(refreshToken)
+	err := inits.CurrentDB.Where("token = ? AND status = ? AND expiry_date > ?", hash, models.ValidToken, time.Now()).First(&session).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return session, "", err
+		}
+		if err := inits.CurrentDB.Where("prev_token = ? AND status = ?", hash, models.ValidToken).First(&session).Error; err != nil {
+			return session, "", ErrInvalidSession
+		}
+		if err := RevokeSession(session.UID, session.UserID); err != nil && !errors.Is(err, ErrInvalidSession) {
+			return session, "", err
+		}
+		return session, "", ErrRefreshTokenReused
+	}
+
+	newRefreshToken := SecureRandomString(64)
+	result := inits.CurrentDB.Model(&models.OToken{}).
+		Where("uid = ? AND token = ?", session.UID, session.Token).
+		Updates(map[string]interface{}{"token": Sha256Hash(newRefreshToken), "prev_token": session.Token, "usages": gorm.Expr("usages + 1")})
+	if result.Error != nil {
+		return session, "", result.Error
+	}
+
+	// another request rotated the token first
+	if result.RowsAffected == 0 {
+		return session, "", ErrInvalidSession
+	}
+
+	session.Usages++
+	return session, newRefreshToken, nil
+}
+
+// UpdateSessionScope changes the scope carried by a session's future access tokens
+func UpdateSessionScope(session models.OToken, scope []string) error {
+	return inits.CurrentDB.Model(&models.OToken{}).Where("uid = ?", session.UID).Update("scope", strings.Join(scope, ",")).Error
+}
+
+// TouchSession records the session's last use, at most once a minute to spare the database
+func TouchSession(session models.OToken) {
+	if session.LastUsed != nil && time.Since(*session.LastUsed) < time.Minute {
+		return
+	}
+
+	if err := inits.CurrentDB.Model(&models.OToken{}).Where("uid = ?", session.UID).Update("last_used", time.Now()).Error; err != nil {
+		fmt.Println("Error updating session last use:", err)
+	}
+}
+
+// RevokeSession revokes one of the user's sessions, returns ErrInvalidSession if it is not an active session of the user
+func RevokeSession(sessionID uint, userID int) error {
+	result := inits.CurrentDB.Model(&models.OToken{}).
+		Where("uid = ? AND user_id = ? AND status = ?", sessionID, userID, models.ValidToken).
+		Update("status", models.RevokedToken)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidSession
+	}
+	return nil
+}
+
+// RevokeUserSessions revokes every active session of the user except exceptSessionID (0 revokes all)
+func RevokeUserSessions(userID int, exceptSessionID uint) (int64, error) {
+	query := inits.CurrentDB.Model(&models.OToken{}).Where("user_id = ? AND status = ?", userID, models.ValidToken)
+	if exceptSessionID > 0 {
+		query = query.Where("uid != ?", exceptSessionID)
+	}
+
+	result := query.Update("status", models.RevokedToken)
+	return result.RowsAffected, result.Error
+}
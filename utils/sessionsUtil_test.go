@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEffectiveScope(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope []string
+		want  []string
+	}{
+		{"empty", nil, []string{"current"}},
+		{"current read write", []string{"current", "read", "write"}, []string{"current", "read", "write"}},
+		{"current read only", []string{"current", "read"}, []string{"current", "read"}},
+		{"archive drops write", []string{"archive", "read", "write"}, []string{"archive", "read"}},
+		{"archive write only", []string{"archive", "write"}, []string{"archive"}},
+		{"unknown database falls back to current", []string{"other", "read", "write"}, []string{"current", "read", "write"}},
+		{"first item is always the database", []string{"read", "write"}, []string{"current", "write"}},
+		{"unknown scopes are dropped", []string{"current", "read", "admin", "write"}, []string{"current", "read", "write"}},
+		{"duplicates are dropped", []string{"current", "read", "read", "write", "write"}, []string{"current", "read", "write"}},
+		{"database named again later is dropped", []string{"current", "archive", "read"}, []string{"current", "read"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EffectiveScope(tt.scope); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EffectiveScope(%v) = %v, want %v", tt.scope, got, tt.want)
+			}
+		})
+	}
+}
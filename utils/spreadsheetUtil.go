@@ -0,0 +1,221 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ErrUnsupportedSpreadsheet = errors.New("only .csv and .xlsx files are supported")
+var ErrSpreadsheetTooLarge = errors.New("spreadsheet has too many rows or columns")
+
+// xlsxMaxColumns is the widest sheet Excel itself allows, column XFD
+const xlsxMaxColumns = 16384
+
+// xlsxMaxEntryBytes caps how much of one workbook part is decompressed, a small file can inflate to gigabytes
+const xlsxMaxEntryBytes = 100 << 20
+
+// ReadSpreadsheet returns the rows of a CSV file or of the first sheet of an XLSX workbook, picked by file extension.
+// Files with more than maxRows rows, counting the header, are refused with ErrSpreadsheetTooLarge before they are
+// read in full.
+func ReadSpreadsheet(fileName string, content []byte, maxRows int) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		return readCSV(content, maxRows)
+	case ".xlsx":
+		return readXLSX(content, maxRows)
+	}
+	return nil, ErrUnsupportedSpreadsheet
+}
+
+func readCSV(content []byte, maxRows int) ([][]string, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var rows [][]string
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == maxRows {
+			return nil, ErrSpreadsheetTooLarge
+		}
+		rows = append(rows, row)
+	}
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is a shared or inline string, rich text comes as several runs
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var text strings.Builder
+	for _, run := range t.Runs {
+		text.WriteString(run.Text)
+	}
+	return text.String()
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Number int `xml:"r,attr"`
+		Cells  []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func readZipXML(files map[string]*zip.File, name string, target interface{}) error {
+	file, ok := files[name]
+	if !ok {
+		return io.ErrUnexpectedEOF
+	}
+	if file.UncompressedSize64 > xlsxMaxEntryBytes {
+		return ErrSpreadsheetTooLarge
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	// the declared size can be wrong, the reader stops at the cap regardless
+	return xml.NewDecoder(io.LimitReader(reader, xlsxMaxEntryBytes)).Decode(target)
+}
+
+// readXLSX reads the first sheet of a workbook, only what an import needs: cell values as text
+func readXLSX(content []byte, maxRows int) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	// the first sheet is whatever the workbook lists first, not necessarily sheet1.xml
+	sheetPath := "xl/worksheets/sheet1.xml"
+	var workbook xlsxWorkbook
+	var relationships xlsxRelationships
+	if readZipXML(files, "xl/workbook.xml", &workbook) == nil && readZipXML(files, "xl/_rels/workbook.xml.rels", &relationships) == nil && len(workbook.Sheets) > 0 {
+		for _, relationship := range relationships.Relationships {
+			if relationship.ID == workbook.Sheets[0].ID {
+				sheetPath = path.Join("xl", strings.TrimPrefix(relationship.Target, "/xl/"))
+				break
+			}
+		}
+	}
+
+	var sharedStrings struct {
+		Items []xlsxText `xml:"si"`
+	}
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := readZipXML(files, "xl/sharedStrings.xml", &sharedStrings); err != nil {
+			return nil, err
+		}
+	}
+
+	var sheet xlsxSheet
+	if err := readZipXML(files, sheetPath, &sheet); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(sheet.Rows))
+	for _, sheetRow := range sheet.Rows {
+		// row and column numbers are checked before anything is allocated for them
+		if sheetRow.Number > maxRows || len(rows) >= maxRows {
+			return nil, ErrSpreadsheetTooLarge
+		}
+
+		// empty rows are left out of the sheet, keep them so row numbers match what the user sees
+		for sheetRow.Number > len(rows)+1 {
+			rows = append(rows, []string{})
+		}
+
+		row := []string{}
+		for i, cell := range sheetRow.Cells {
+			column := i
+			if index := xlsxColumnIndex(cell.Ref); index >= 0 {
+				column = index
+			}
+			if column >= xlsxMaxColumns {
+				return nil, ErrSpreadsheetTooLarge
+			}
+			for len(row) <= column {
+				row = append(row, "")
+			}
+
+			switch cell.Type {
+			case "s":
+				if index, err := strconv.Atoi(cell.Value); err == nil && index < len(sharedStrings.Items) {
+					row[column] = sharedStrings.Items[index].String()
+				}
+			case "inlineStr":
+				row[column] = cell.Inline.String()
+			case "", "n":
+				// large numbers such as phone numbers are written in exponent form
+				if number, err := strconv.ParseFloat(cell.Value, 64); err == nil && strings.ContainsAny(cell.Value, "eE") {
+					row[column] = strconv.FormatFloat(number, 'f', -1, 64)
+				} else {
+					row[column] = cell.Value
+				}
+			default:
+				row[column] = cell.Value
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// xlsxColumnIndex turns the letters of a cell reference such as "AB12" into a zero based column index,
+// references past the last column Excel allows give xlsxMaxColumns
+func xlsxColumnIndex(ref string) int {
+	index := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A'+1)
+		if index > xlsxMaxColumns {
+			return xlsxMaxColumns
+		}
+	}
+	return index - 1
+}
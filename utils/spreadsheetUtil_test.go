@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// buildXLSX zips the given workbook parts, a part named "!big:<name>" is declared larger than may be decompressed
+func buildXLSX(t *testing.T, parts map[string]string) []byte {
+	var out bytes.Buffer
+	archive := zip.NewWriter(&out)
+	for name, content := range parts {
+		if strings.HasPrefix(name, "!big:") {
+			header := &zip.FileHeader{Name: strings.TrimPrefix(name, "!big:"), Method: zip.Store, UncompressedSize64: xlsxMaxEntryBytes + 1}
+			writer, err := archive.CreateRaw(header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writer.Write([]byte(content))
+			continue
+		}
+		writer, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer.Write([]byte(content))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func sheetXML(rows string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?><worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` + rows + `</sheetData></worksheet>`
+}
+
+func TestReadXLSX(t *testing.T) {
+	sharedStrings := `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><si><t>fullName</t></si><si><t>primaryMobile</t></si><si><r><t>Jane </t></r><r><t>Doe</t></r></si></sst>`
+	workbook := `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Leads" sheetId="1" r:id="rId2"/></sheets></workbook>`
+	relationships := `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Target="/xl/worksheets/leads.xml"/></Relationships>`
+
+	tests := []struct {
+		name    string
+		parts   map[string]string
+		maxRows int
+		want    [][]string
+		wantErr error
+	}{
+		{
+			name: "shared, rich and inline strings",
+			parts: map[string]string{
+				"xl/sharedStrings.xml": sharedStrings,
+				"xl/worksheets/sheet1.xml": sheetXML(`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>` +
+					`<row r="2"><c r="A2" t="s"><v>2</v></c><c r="B2" t="inlineStr"><is><t>0712345678</t></is></c></row>`),
+			},
+			maxRows: 10,
+			want:    [][]string{{"fullName", "primaryMobile"}, {"Jane Doe", "0712345678"}},
+		},
+		{
+			name:    "numbers in exponent form",
+			parts:   map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row r="1"><c r="A1"><v>2.54712345678E11</v></c><c r="B1" t="n"><v>42</v></c></row>`)},
+			maxRows: 10,
+			want:    [][]string{{"254712345678", "42"}},
+		},
+		{
+			name:    "skipped rows and columns are kept",
+			parts:   map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row r="1"><c r="A1" t="inlineStr"><is><t>a</t></is></c></row><row r="3"><c r="C3" t="inlineStr"><is><t>c</t></is></c></row>`)},
+			maxRows: 10,
+			want:    [][]string{{"a"}, {}, {"", "", "c"}},
+		},
+		{
+			name: "first sheet of the workbook",
+			parts: map[string]string{
+				"xl/workbook.xml":            workbook,
+				"xl/_rels/workbook.xml.rels": relationships,
+				"xl/worksheets/sheet1.xml":   sheetXML(`<row r="1"><c r="A1" t="inlineStr"><is><t>other</t></is></c></row>`),
+				"xl/worksheets/leads.xml":    sheetXML(`<row r="1"><c r="A1" t="inlineStr"><is><t>leads</t></is></c></row>`),
+			},
+			maxRows: 10,
+			want:    [][]string{{"leads"}},
+		},
+		{
+			name:    "rows up to the cap",
+			parts:   map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row r="1"><c r="A1"><v>1</v></c></row><row r="2"><c r="A2"><v>2</v></c></row>`)},
+			maxRows: 2,
+			want:    [][]string{{"1"}, {"2"}},
+		},
+		{
+			name:    "more rows than the cap",
+			parts:   map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row r="1"><c r="A1"><v>1</v></c></row><row r="2"><c r="A2"><v>2</v></c></row><row r="3"><c r="A3"><v>3</v></c></row>`)},
+			maxRows: 2,
+			wantErr: ErrSpreadsheetTooLarge,
+		},
+		{
+			name:    "row number past the cap",
+			parts:   map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row r="1048576"><c r="A1048576"><v>1</v></c></row>`)},
+			maxRows: 10,
+			wantErr: ErrSpreadsheetTooLarge,
+		},
+		{
+			name:    "last column Excel allows",
+			parts:   map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row r="1"><c r="XFD1"><v>1</v></c></row>`)},
+			maxRows: 10,
+		},
+		{
+			name:    "column past the last one",
+			parts:   map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row r="1"><c r="XFE1"><v>1</v></c></row>`)},
+			maxRows: 10,
+			wantErr: ErrSpreadsheetTooLarge,
+		},
+		{
+			name:    "huge column reference",
+			parts:   map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row r="1"><c r="ZZZZZZZZZZZZZZZZ1"><v>1</v></c></row>`)},
+			maxRows: 10,
+			wantErr: ErrSpreadsheetTooLarge,
+		},
+		{
+			name:    "part declared too large to decompress",
+			parts:   map[string]string{"!big:xl/worksheets/sheet1.xml": sheetXML("")},
+			maxRows: 10,
+			wantErr: ErrSpreadsheetTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readXLSX(buildXLSX(t, tt.parts), tt.maxRows)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("readXLSX() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readXLSX() error = %v", err)
+			}
+			if tt.want == nil {
+				if len(rows) != 1 || len(rows[0]) != xlsxMaxColumns || rows[0][xlsxMaxColumns-1] != "1" {
+					t.Errorf("readXLSX() did not put the value in the last column")
+				}
+				return
+			}
+			if !reflect.DeepEqual(rows, tt.want) {
+				t.Errorf("readXLSX() = %q, want %q", rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSpreadsheet(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		content  string
+		maxRows  int
+		want     [][]string
+		wantErr  error
+	}{
+		{"csv with a byte order mark", "leads.CSV", "\xef\xbb\xbffullName, primaryMobile\nJane Doe,0712345678\n", 10, [][]string{{"fullName", "primaryMobile"}, {"Jane Doe", "0712345678"}}, nil},
+		{"csv rows may differ in length", "leads.csv", "a,b\nc\n", 10, [][]string{{"a", "b"}, {"c"}}, nil},
+		{"csv more rows than the cap", "leads.csv", "a\nb\nc\n", 2, nil, ErrSpreadsheetTooLarge},
+		{"unsupported extension", "leads.xls", "a,b", 10, nil, ErrUnsupportedSpreadsheet},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := ReadSpreadsheet(tt.fileName, []byte(tt.content), tt.maxRows)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReadSpreadsheet() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(rows, tt.want) {
+				t.Errorf("ReadSpreadsheet() = %q, want %q", rows, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"errors"
+	"super-lender/inits"
+	"super-lender/models"
+	"super-lender/schemas"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ActiveStaffBranchCondition selects o_staff_branches rows in effect today, alias is the table alias with its dot
+func ActiveStaffBranchCondition(alias string) string {
+	return alias + "status = 1 AND (" + alias + "start_date IS NULL OR " + alias + "start_date <= CURDATE()) AND (" + alias + "end_date IS NULL OR " + alias + "end_date >= CURDATE())"
+}
+
+// AssignStaffBranch gives the staff member access to a branch between the dates, an assignment that has
+// not ended yet is updated rather than duplicated
+func AssignStaffBranch(tx *gorm.DB, userID int, branch int, startDate *time.Time, endDate *time.Time, addedBy int) (models.OStaffBranch, error) {
+	var staffBranch models.OStaffBranch
+
+	err := tx.Where("agent = ? AND branch = ? AND status = 1 AND (end_date IS NULL OR end_date >= CURDATE())", userID, branch).First(&staffBranch).Error
+	if err == nil {
+		err = tx.Model(&models.OStaffBranch{}).Where("uid = ?", staffBranch.UID).
+			Updates(map[string]interface{}{"start_date": startDate, "end_date": endDate}).Error
+		staffBranch.StartDate = startDate
+		staffBranch.EndDate = endDate
+		return staffBranch, err
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return staffBranch, err
+	}
+
+	staffBranch = models.OStaffBranch{Agent: userID, Branch: branch, StartDate: startDate, EndDate: endDate, AddedBy: addedBy, Status: 1}
+	err = tx.Create(&staffBranch).Error
+	return staffBranch, err
+}
+
+// AssignStaffBranches gives the staff member open ended access to the branches on top of their home branch
+func AssignStaffBranches(tx *gorm.DB, userID int, branches []int, addedBy int) error {
+	for _, branch := range branches {
+		if _, err := AssignStaffBranch(tx, userID, branch, nil, nil, addedBy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnassignStaffBranch ends the staff member's assignments to the branch on endDate, or today when it is nil.
+// Assignments that have not started by then are cancelled.
+func UnassignStaffBranch(userID int, branch int, endDate *time.Time) (int64, error) {
+	end := time.Now().In(loc)
+	if endDate != nil {
+		end = *endDate
+	}
+	endDay := end.Format(DateFormat)
+
+	var affected int64
+	err := inits.CurrentDB.Transaction(func(tx *gorm.DB) error {
+		base := tx.Model(&models.OStaffBranch{}).Where("agent = ? AND branch = ? AND status = 1 AND (end_date IS NULL OR end_date > ?)", userID, branch, endDay)
+
+		cancelled := base.Session(&gorm.Session{}).Where("start_date > ?", endDay).Update("status", 0)
+		if cancelled.Error != nil {
+			return cancelled.Error
+		}
+
+		ended := base.Session(&gorm.Session{}).Update("end_date", endDay)
+		if ended.Error != nil {
+			return ended.Error
+		}
+
+		affected = cancelled.RowsAffected + ended.RowsAffected
+		return nil
+	})
+
+	return affected, err
+}
+
+func StaffBranchesQueryBuilder(db *gorm.DB, userID, branch int, activeOnly bool) *gorm.DB {
+	query := db.Table("o_staff_branches sb")
+	query = query.Joins("LEFT JOIN o_users u ON u.uid = sb.agent")
+	query = query.Joins("LEFT JOIN o_branches b ON b.uid = sb.branch")
+	query = query.Select("sb.uid, sb.agent, u.name AS agent_name, sb.branch, b.name AS branch_name, IFNULL(DATE_FORMAT(sb.start_date, '%Y-%m-%d'), '') AS start_date, IFNULL(DATE_FORMAT(sb.end_date, '%Y-%m-%d'), '') AS end_date, DATE_FORMAT(sb.added_date, '%Y-%m-%d %H:%i:%s') AS added_date, sb.status, (" + ActiveStaffBranchCondition("sb.") + ") AS active")
+
+	if userID > 0 {
+		query = query.Where("sb.agent = ?", userID)
+	}
+	if branch > 0 {
+		query = query.Where("sb.branch = ?", branch)
+	}
+	if activeOnly {
+		query = query.Where(ActiveStaffBranchCondition("sb."))
+	} else {
+		query = query.Where("sb.status = 1")
+	}
+
+	return query.Order("sb.uid DESC")
+}
+
+// BranchStaffQueryBuilder lists the active staff of a branch, whether it is their home branch or they are assigned to it
+func BranchStaffQueryBuilder(db *gorm.DB, branch int) *gorm.DB {
+	query := db.Table("o_users u")
+	query = query.Joins("LEFT JOIN o_user_groups ug ON ug.uid = u.user_group")
+	query = query.Joins("LEFT JOIN o_staff_branches sb ON sb.agent = u.uid AND sb.branch = ? AND "+ActiveStaffBranchCondition("sb."), branch)
+	query = query.Select("u.uid, u.name, u.email, ug.name AS user_group, u.branch = ? AS home_branch, IFNULL(DATE_FORMAT(MIN(sb.start_date), '%Y-%m-%d'), '') AS start_date, IFNULL(DATE_FORMAT(MAX(sb.end_date), '%Y-%m-%d'), '') AS end_date", branch)
+	query = query.Where("u.status = ? AND (u.branch = ? OR sb.uid IS NOT NULL)", models.Active, branch)
+	query = query.Group("u.uid, u.name, u.email, ug.name, u.branch")
+
+	return query.Order("u.name ASC")
+}
+
+// closedLoanStatuses are loans whose officers are no longer worked on and stay as they were in a portfolio transfer
+var closedLoanStatuses = []models.LoanStatus{models.Cleared, models.Rejected, models.WrittenOff, models.Reversed}
+
+// TransferPortfolio moves the customers and open loans of one staff member to another in a single transaction,
+// limited to one branch when branch > 0
+func TransferPortfolio(fromUserID int, toUserID int, branch int) (schemas.PortfolioTransferResultSchema, error) {
+	var result schemas.PortfolioTransferResultSchema
+
+	err := inits.CurrentDB.Transaction(func(tx *gorm.DB) error {
+		customers := tx.Model(&models.OCustomer{}).Where("current_agent = ?", fromUserID)
+		if branch > 0 {
+			customers = customers.Where("branch = ?", branch)
+		}
+		updated := customers.Update("current_agent", toUserID)
+		if updated.Error != nil {
+			return updated.Error
+		}
+		result.Customers = updated.RowsAffected
+
+		for column, count := range map[string]*int64{"current_lo": &result.LoansAsLO, "current_co": &result.LoansAsCO} {
+			loans := tx.Model(&models.OLoan{}).Where(column+" = ? AND status NOT IN ?", fromUserID, closedLoanStatuses)
+			if branch > 0 {
+				loans = loans.Where("current_branch = ?", branch)
+			}
+			updated := loans.Update(column, toUserID)
+			if updated.Error != nil {
+				return updated.Error
+			}
+			*count = updated.RowsAffected
+		}
+
+		return nil
+	})
+
+	return result, err
+}
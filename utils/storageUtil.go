@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var ErrObjectNotFound = errors.New("object not found in storage")
+
+// Storage keeps files by key, keys use forward slashes whatever the driver
+type Storage interface {
+	Put(key string, content io.Reader) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// LocalStorage keeps files on the local filesystem under Root
+type LocalStorage struct {
+	Root string
+}
+
+// path maps a key to a file under Root, cleaning it first so a key cannot leave Root
+func (s LocalStorage) path(key string) string {
+	return filepath.Join(s.Root, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+func (s LocalStorage) Put(key string, content io.Reader) error {
+	target := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(target), 0750); err != nil {
+		return err
+	}
+
+	// write to a temporary file first so readers never see half a file
+	file, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, content); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), target)
+}
+
+func (s LocalStorage) Get(key string) (io.ReadCloser, error) {
+	file, err := os.Open(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	return file, err
+}
+
+func (s LocalStorage) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// GetStorage returns the driver named in STORAGE_DRIVER, only "local" (the default, rooted at STORAGE_PATH) exists for now
+func GetStorage() (Storage, error) {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_DRIVER"))) {
+	case "", "local":
+		return LocalStorage{Root: DefaultIfEmpty(os.Getenv("STORAGE_PATH"), "storage")}, nil
+	}
+	return nil, fmt.Errorf("unknown storage driver %q", os.Getenv("STORAGE_DRIVER"))
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 key of the RFC 6238 test vectors, "12345678901234567890", in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTP(t *testing.T) {
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		now      int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"rfc vector 59", rfc6238Secret, "287082", 59, 1, true},
+		{"rfc vector 1111111109", rfc6238Secret, "081804", 1111111109, 37037036, true},
+		{"rfc vector 1234567890", rfc6238Secret, "005924", 1234567890, 41152263, true},
+		{"previous period is accepted", rfc6238Secret, "287082", 89, 1, true},
+		{"next period is accepted", rfc6238Secret, "287082", 29, 1, true},
+		{"two periods late is refused", rfc6238Secret, "287082", 119, 0, false},
+		{"wrong code", rfc6238Secret, "287083", 59, 0, false},
+		{"short code", rfc6238Secret, "28708", 59, 0, false},
+		{"long code", rfc6238Secret, "2870820", 59, 0, false},
+		{"empty code", rfc6238Secret, "", 59, 0, false},
+		{"lower case secret with spaces", " gezdgnbvgy3tqojqgezdgnbvgy3tqojq ", "287082", 59, 1, true},
+		{"invalid secret", "not base32!", "287082", 59, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(tt.secret, tt.code, time.Unix(tt.now, 0))
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("ValidateTOTP(%q, %q, %d) = %d, %v, want %d, %v", tt.secret, tt.code, tt.now, step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPGeneratedSecret(t *testing.T) {
+	secret := GenerateTOTPSecret()
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() = %q, not base32: %v", secret, err)
+	}
+
+	now := time.Now()
+	code := totpCode(key, now.Unix()/totpPeriod)
+	if _, ok := ValidateTOTP(secret, code, now); !ok {
+		t.Errorf("ValidateTOTP rejected the current code %q of a generated secret", code)
+	}
+}
@@ -0,0 +1,242 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"super-lender/inits"
+	"super-lender/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidChallenge = errors.New("login challenge is invalid or has expired")
+var ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+var ErrTwoFactorSetupExpired = errors.New("two-factor setup has expired, start it again")
+
+const (
+	loginChallengeTTL         = 5 * time.Minute
+	loginChallengeMaxAttempts = 5
+	// TwoFactorSetupTTL matches the login codes, the OTP message states it
+	TwoFactorSetupTTL  = loginChallengeTTL
+	recoveryCodesCount = 10
+)
+
+// GetTwoFactor returns the user's second factor, ok is false if the user never set one up
+func GetTwoFactor(userID int) (models.OUserTwoFactor, bool) {
+	var twoFactor models.OUserTwoFactor
+	if err := inits.CurrentDB.Where("user_id = ?", userID).First(&twoFactor).Error; err != nil {
+		return twoFactor, false
+	}
+	return twoFactor, true
+}
+
+// IsTwoFactorRequiredByGroup reports whether the user's group enforces 2FA
+func IsTwoFactorRequiredByGroup(user models.OUser) bool {
+	var userGroup models.OUserGroup
+	if err := inits.CurrentDB.Where("uid = ?", user.UserGroup).First(&userGroup).Error; err != nil {
+		return false
+	}
+	return userGroup.Require2FA == 1
+}
+
+// IsTwoFactorRequired reports whether a login must be completed with a second factor
+func IsTwoFactorRequired(user models.OUser) bool {
+	if twoFactor, ok := GetTwoFactor(user.UID); ok && twoFactor.Enabled == 1 {
+		return true
+	}
+	return IsTwoFactorRequiredByGroup(user)
+}
+
+// SendOTP delivers a one-time code by sms or email
+func SendOTP(user models.OUser, method models.TwoFactorMethod, code string) error {
+	message := fmt.Sprintf("Your verification code is %s. It expires in %d minutes.", code, int(loginChallengeTTL.Minutes()))
+	if method == models.EmailTwoFactor {
+		return GetEmailNotifier().Notify(user, "Verification code", message)
+	}
+	return SMSNotifier{Gateway: GetSMSGateway()}.Notify(user, "Verification code", message)
+}
+
+// StartLoginChallenge records a login awaiting its second factor and sends the OTP when the
+// method is sms or email. Users in a group that enforces 2FA without having enrolled get an sms OTP.
+func StartLoginChallenge(user models.OUser) (string, models.TwoFactorMethod, error) {
+	method := models.SMSTwoFactor
+	if twoFactor, ok := GetTwoFactor(user.UID); ok && twoFactor.Enabled == 1 {
+		method = twoFactor.Method
+	}
+
+	challengeToken := SecureRandomString(48)
+	challenge := models.OLoginChallenge{
+		UserID:     user.UID,
+		Token:      Sha256Hash(challengeToken),
+		Method:     method,
+		ExpiryDate: time.Now().Add(loginChallengeTTL),
+		Status:     models.PendingLoginChallenge,
+	}
+
+	var code string
+	if method != models.TOTPTwoFactor {
+		code = SecureRandomNumber(6)
+		challenge.Code = Sha256Hash(code)
+	}
+
+	if err := inits.CurrentDB.Create(&challenge).Error; err != nil {
+		return "", method, err
+	}
+
+	if code != "" {
+		if err := SendOTP(user, method, code); err != nil {
+			return "", method, err
+		}
+	}
+
+	return challengeToken, method, nil
+}
+
+// VerifyLoginChallenge checks the second factor for a pending login and returns the user it belongs to
+func VerifyLoginChallenge(challengeToken string, code string) (models.OUser, error) {
+	var user models.OUser
+	var challenge models.OLoginChallenge
+
+	err := inits.CurrentDB.Where("token = ? AND status = ? AND expiry_date > ?", Sha256Hash(challengeToken), models.PendingLoginChallenge, time.Now()).First(&challenge).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return user, ErrInvalidChallenge
+		}
+		return user, err
+	}
+
+	if err := inits.CurrentDB.First(&user, challenge.UserID).Error; err != nil {
+		return user, err
+	}
+
+	code = strings.TrimSpace(code)
+	valid := false
+	switch challenge.Method {
+	case models.TOTPTwoFactor:
+		valid = VerifyTOTPForUser(user.UID, code)
+	default:
+		valid = subtle.ConstantTimeCompare([]byte(challenge.Code), []byte(Sha256Hash(code))) == 1
+	}
+
+	if !valid {
+		valid = UseRecoveryCode(user.UID, code)
+	}
+
+	if !valid {
+		status := models.PendingLoginChallenge
+		if challenge.Attempts+1 >= loginChallengeMaxAttempts {
+			status = models.FailedLoginChallenge
+		}
+		inits.CurrentDB.Model(&models.OLoginChallenge{}).Where("uid = ?", challenge.UID).
+			Updates(map[string]interface{}{"attempts": gorm.Expr("attempts + 1"), "status": status})
+		return user, ErrInvalidTwoFactorCode
+	}
+
+	result := inits.CurrentDB.Model(&models.OLoginChallenge{}).
+		Where("uid = ? AND status = ?", challenge.UID, models.PendingLoginChallenge).
+		Update("status", models.CompletedLoginChallenge)
+	if result.Error != nil {
+		return user, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return user, ErrInvalidChallenge
+	}
+
+	return user, nil
+}
+
+// VerifyTOTPForUser checks a TOTP code against the user's secret and refuses codes already used
+func VerifyTOTPForUser(userID int, code string) bool {
+	twoFactor, ok := GetTwoFactor(userID)
+	if !ok || twoFactor.Method != models.TOTPTwoFactor {
+		return false
+	}
+
+	step, valid := ValidateTOTP(twoFactor.Secret, code, time.Now())
+	if !valid || step <= twoFactor.LastUsedStep {
+		return false
+	}
+
+	result := inits.CurrentDB.Model(&models.OUserTwoFactor{}).
+		Where("uid = ? AND last_used_step < ?", twoFactor.UID, step).
+		Update("last_used_step", step)
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// ConfirmTwoFactorSetup checks the code that confirms a pending setup, an sms/email enrolment code or
+// the first TOTP code. Like a login challenge the setup expires and is discarded after too many failed
+// attempts, the user then has to start it again.
+func ConfirmTwoFactorSetup(twoFactor models.OUserTwoFactor, code string) error {
+	if twoFactor.Secret == "" || twoFactor.SetupExpiry == nil || time.Now().After(*twoFactor.SetupExpiry) ||
+		twoFactor.SetupAttempts >= loginChallengeMaxAttempts {
+		return ErrTwoFactorSetupExpired
+	}
+
+	code = strings.TrimSpace(code)
+	valid := false
+	if twoFactor.Method == models.TOTPTwoFactor {
+		valid = VerifyTOTPForUser(twoFactor.UserID, code)
+	} else {
+		valid = subtle.ConstantTimeCompare([]byte(twoFactor.Secret), []byte(Sha256Hash(code))) == 1
+	}
+
+	if !valid {
+		updates := map[string]interface{}{"setup_attempts": gorm.Expr("setup_attempts + 1")}
+		if twoFactor.SetupAttempts+1 >= loginChallengeMaxAttempts {
+			updates["secret"] = ""
+		}
+		inits.CurrentDB.Model(&models.OUserTwoFactor{}).Where("uid = ?", twoFactor.UID).Updates(updates)
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+// GenerateRecoveryCodes replaces the user's recovery codes and returns the new plain codes
+func GenerateRecoveryCodes(userID int) ([]string, error) {
+	codes := make([]string, recoveryCodesCount)
+	hashes := make([]string, recoveryCodesCount)
+	for i := range codes {
+		code := strings.ToLower(SecureRandomString(5) + "-" + SecureRandomString(5))
+		codes[i] = code
+		hashes[i] = Sha256Hash(code)
+	}
+
+	err := inits.CurrentDB.Model(&models.OUserTwoFactor{}).Where("user_id = ?", userID).Update("recovery_codes", strings.Join(hashes, ",")).Error
+	return codes, err
+}
+
+// UseRecoveryCode consumes one of the user's recovery codes
+func UseRecoveryCode(userID int, code string) bool {
+	twoFactor, ok := GetTwoFactor(userID)
+	if !ok || twoFactor.RecoveryCodes == "" || code == "" {
+		return false
+	}
+
+	codeHash := Sha256Hash(strings.ToLower(code))
+	hashes := strings.Split(twoFactor.RecoveryCodes, ",")
+	for i, hash := range hashes {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(codeHash)) != 1 {
+			continue
+		}
+
+		remaining := append(hashes[:i:i], hashes[i+1:]...)
+		result := inits.CurrentDB.Model(&models.OUserTwoFactor{}).
+			Where("uid = ? AND recovery_codes = ?", twoFactor.UID, twoFactor.RecoveryCodes).
+			Update("recovery_codes", strings.Join(remaining, ","))
+		return result.Error == nil && result.RowsAffected == 1
+	}
+
+	return false
+}
+
+// CountRecoveryCodes returns how many unused recovery codes the user has left
+func CountRecoveryCodes(twoFactor models.OUserTwoFactor) int {
+	if twoFactor.RecoveryCodes == "" {
+		return 0
+	}
+	return len(strings.Split(twoFactor.RecoveryCodes, ","))
+}
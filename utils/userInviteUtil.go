@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"super-lender/inits"
+	"super-lender/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidInvite = errors.New("invitation is invalid, used or expired")
+
+// InviteTTL is how long an activation link stays valid, INVITE_TTL_HOURS (default 72)
+func InviteTTL() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("INVITE_TTL_HOURS"))
+	if err != nil || hours <= 0 {
+		hours = 72
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// CreateUserInvite stores a new activation token for the user, cancelling any earlier one, and returns the plain token
+func CreateUserInvite(user models.OUser, channel string, invitedBy int) (string, time.Time, error) {
+	token := SecureRandomString(40)
+	expiry := time.Now().Add(InviteTTL())
+
+	err := inits.CurrentDB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.OUserInvite{}).Where("user_id = ? AND status = ?", user.UID, models.PendingInvite).Update("status", models.CancelledInvite).Error
+		if err != nil {
+			return err
+		}
+
+		invite := models.OUserInvite{
+			UserID:     user.UID,
+			TokenHash:  Sha256Hash(token),
+			Channel:    channel,
+			ExpiryDate: expiry,
+			InvitedBy:  invitedBy,
+			Status:     models.PendingInvite,
+		}
+		return tx.Create(&invite).Error
+	})
+	if err != nil {
+		return "", expiry, err
+	}
+
+	return token, expiry, nil
+}
+
+// SendUserInvite delivers the activation link, or the bare token when ACTIVATION_URL is not set
+func SendUserInvite(user models.OUser, channel string, token string, expiry time.Time) error {
+	notifier := GetNotifier(channel)
+	if notifier == nil || notifier.Channel() == "inapp" {
+		return fmt.Errorf("unsupported channel %s", channel)
+	}
+
+	link := token
+	if activationURL := os.Getenv("ACTIVATION_URL"); activationURL != "" {
+		link = fmt.Sprintf("%s?token=%s", activationURL, token)
+	}
+
+	message := fmt.Sprintf("Hello %s, an account has been created for you. Activate it and set your password here: %s. The link expires on %s.", user.Name, link, expiry.In(loc).Format(DateTimeFormat))
+
+	return notifier.Notify(user, "Activate your account", message)
+}
+
+// AcceptUserInvite checks an activation token, marks it used and activates the invited user with the
+// given password hash, both in one transaction so a failed activation leaves the link usable
+func AcceptUserInvite(token string, passwordHash string) (models.OUser, error) {
+	var invite models.OUserInvite
+	var user models.OUser
+
+	err := inits.CurrentDB.Where("token_hash = ? AND status = ?", Sha256Hash(token), models.PendingInvite).First(&invite).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return user, ErrInvalidInvite
+		}
+		return user, err
+	}
+	if time.Now().After(invite.ExpiryDate) {
+		return user, ErrInvalidInvite
+	}
+
+	if err := inits.CurrentDB.Where("uid = ? AND status = ?", invite.UserID, models.InvitedUser).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return user, ErrInvalidInvite
+		}
+		return user, err
+	}
+
+	err = inits.CurrentDB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.OUserInvite{}).
+			Where("uid = ? AND status = ?", invite.UID, models.PendingInvite).
+			Updates(map[string]interface{}{"status": models.AcceptedInvite, "accepted_date": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidInvite
+		}
+
+		result = tx.Model(&models.OUser{}).Where("uid = ? AND status = ?", user.UID, models.InvitedUser).
+			Updates(map[string]interface{}{"pass1": passwordHash, "status": models.Active})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidInvite
+		}
+		return nil
+	})
+
+	return user, err
+}
@@ -1,6 +1,32 @@
 package utils
 
-import "gorm.io/gorm"
+import (
+	"errors"
+	"strings"
+	"super-lender/inits"
+	"super-lender/models"
+
+	"gorm.io/gorm"
+)
+
+// FindUserByEmailOrPhone looks up a user by email address or phone number
+func FindUserByEmailOrPhone(username string) (models.OUser, error) {
+	var user models.OUser
+	username = strings.TrimSpace(username)
+
+	if IsValidEmail(username) {
+		err := inits.CurrentDB.Where("email = ?", username).First(&user).Error
+		return user, err
+	}
+
+	phone := MakePhoneValid(username)
+	if !IsPhoneValid(phone) {
+		return user, errors.New("invalid username")
+	}
+
+	err := inits.CurrentDB.Where("phone = ?", phone).First(&user).Error
+	return user, err
+}
 
 func FindManyUsersQueryBuilder(db *gorm.DB, userGroup, branch, status int, searchTerm, queryType string) *gorm.DB {
 	query := db.Table("o_users u")
@@ -27,3 +53,25 @@ func FindManyUsersQueryBuilder(db *gorm.DB, userGroup, branch, status int, searc
 
 	return query
 }
+
+func LoginHistoryQueryBuilder(db *gorm.DB, userID, outcome int, from, to, queryType string) *gorm.DB {
+	query := db.Table("o_login_history h")
+	if queryType == "count" {
+		query = query.Select("h.uid")
+	} else {
+		query = query.Select("h.uid, h.username, h.ip_address, h.user_agent, h.outcome, h.reason, DATE_FORMAT(h.login_date, '%Y-%m-%d %H:%i:%s') AS login_date")
+	}
+
+	query = query.Where("h.user_id = ?", userID)
+	if outcome > 0 {
+		query = query.Where("h.outcome = ?", outcome)
+	}
+	if from != "" {
+		query = query.Where("h.login_date >= ?", from+" 00:00:00")
+	}
+	if to != "" {
+		query = query.Where("h.login_date <= ?", to+" 23:59:59")
+	}
+
+	return query
+}